@@ -0,0 +1,133 @@
+package dbpivot
+
+import (
+	"context"
+	"db-pivot/internal/diff"
+	"db-pivot/internal/migration"
+	"fmt"
+	"sort"
+)
+
+// BaselineOptions controls Baseline.
+type BaselineOptions struct {
+	// Version is recorded as applied. Migrations up to and including it
+	// are considered part of the existing schema.
+	Version string
+	// Script writes the CREATE statements of the current schema as
+	// migration Version, so a new database can be built from it.
+	Script bool
+	// Name names the script file. Empty means "baseline".
+	Name     string
+	Metadata Metadata
+}
+
+// BaselineResult reports what Baseline did.
+type BaselineResult struct {
+	// Migration is the script written when BaselineOptions.Script is set
+	// and the schema is not empty.
+	Migration *Migration
+	// Recorded lists the versions marked as applied.
+	Recorded []string
+}
+
+// Baseline adopts a database whose schema predates dbpivot. It records
+// opts.Version, and every known migration before it, as applied without
+// running anything, and captures a snapshot, so that Apply only runs newer
+// migrations and Diff starts from the current schema.
+//
+// The baseline script has no Down section: rolling it back would drop the
+// whole schema.
+func (p *Pivot) Baseline(ctx context.Context, opts BaselineOptions) (BaselineResult, error) {
+	var result BaselineResult
+	if !migration.ValidVersion(opts.Version) {
+		return result, fmt.Errorf("invalid baseline version %q: versions are all digits", opts.Version)
+	}
+	if err := p.InitContext(ctx); err != nil {
+		return result, err
+	}
+	migs, err := p.collectMigrations()
+	if err != nil {
+		return result, err
+	}
+	exists := false
+	for _, m := range migs {
+		if migration.CompareVersions(m.version, opts.Version) == 0 {
+			exists = true
+		}
+	}
+
+	if opts.Script {
+		if exists {
+			return result, fmt.Errorf("migration %s already exists", opts.Version)
+		}
+		schema, err := p.db.GetSchema(ctx)
+		if err != nil {
+			return result, fmt.Errorf("failed to capture current schema: %v", err)
+		}
+		strategy := &diff.DefaultDiffStrategy{Filter: p.filter}
+		changes, err := strategy.Compare(map[string]interface{}{}, schema)
+		if err != nil {
+			return result, fmt.Errorf("failed to compare schemas: %v", err)
+		}
+		if len(changes) > 0 {
+			name := opts.Name
+			if name == "" {
+				name = "baseline"
+			}
+			mig, err := migration.GenerateMigration(changes, p.cfg.MigrationDir, GenerateOptions{
+				Name:         name,
+				Metadata:     opts.Metadata,
+				Version:      opts.Version,
+				Irreversible: true,
+			})
+			if err != nil {
+				return result, fmt.Errorf("failed to generate baseline script: %v", err)
+			}
+			result.Migration = &mig
+			migs = append(migs, pendingMigration{version: mig.Version, sqlMig: &mig})
+			exists = true
+		}
+	}
+	if !exists {
+		meta := opts.Metadata
+		if meta.Description == "" {
+			meta.Description = "Baseline"
+		}
+		migs = append(migs, pendingMigration{
+			version: opts.Version,
+			sqlMig:  &Migration{Version: opts.Version, Name: "baseline", Metadata: meta},
+		})
+	}
+
+	sort.Slice(migs, func(i, j int) bool {
+		return migration.CompareVersions(migs[i].version, migs[j].version) < 0
+	})
+	for _, m := range migs {
+		if migration.CompareVersions(m.version, opts.Version) > 0 {
+			continue
+		}
+		done, err := p.db.IsMigrationApplied(ctx, m.version)
+		if err != nil {
+			return result, err
+		}
+		if done {
+			continue
+		}
+		record := Migration{Version: m.version}
+		if m.sqlMig != nil {
+			record = *m.sqlMig
+		} else {
+			record.Checksum = m.goMig.Checksum()
+			record.Metadata.Description = m.goMig.Description
+		}
+		if err := migration.MarkApplied(ctx, p.db, record); err != nil {
+			return result, err
+		}
+		result.Recorded = append(result.Recorded, m.version)
+	}
+
+	if err := p.db.CaptureSnapshot(ctx, p.cfg.SnapshotDir); err != nil {
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,291 @@
+// Package dbpivot is the public API for programs that embed dbpivot. The
+// dbpivot command line tool is built on top of it.
+package dbpivot
+
+import (
+	"context"
+	"db-pivot/internal/config"
+	"db-pivot/internal/db"
+	"db-pivot/internal/diff"
+	"db-pivot/internal/filter"
+	"db-pivot/internal/migration"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+)
+
+// Config describes the database and the directories dbpivot works with.
+type Config = config.Config
+
+// Environment is a named database in Config.Environments.
+type Environment = config.Environment
+
+// Change is a single schema difference reported by Diff.
+type Change = diff.Change
+
+// Migration is a migration script produced by Generate.
+type Migration = migration.Migration
+
+// GenerateOptions name and describe a migration written by GenerateWith.
+type GenerateOptions = migration.GenerateOptions
+
+// Metadata is the header block of a migration file.
+type Metadata = migration.Metadata
+
+// ErrNoChanges is returned by Generate when the schema matches the latest snapshot.
+var ErrNoChanges = errors.New("dbpivot: no schema changes detected")
+
+// Pivot is a connection to a database managed by dbpivot.
+type Pivot struct {
+	cfg        Config
+	db         *db.DBManager
+	migrations fs.FS
+	snapshots  fs.FS
+	filter     *filter.Filter
+
+	statementTimeout time.Duration
+	lockWaitTimeout  time.Duration
+	lockRetries      int
+	logf             func(format string, args ...interface{})
+	offline          bool
+}
+
+// Option customizes a Pivot created by Open.
+type Option func(*Pivot)
+
+// WithMigrationFS reads migrations from fsys instead of cfg.MigrationDir.
+// Files are expected at the root of fsys, so an embedded directory should be
+// passed through fs.Sub:
+//
+//	//go:embed migrations/*.sql
+//	var embedded embed.FS
+//
+//	migrations, _ := fs.Sub(embedded, "migrations")
+//	p, err := dbpivot.Open(cfg, dbpivot.WithMigrationFS(migrations))
+func WithMigrationFS(fsys fs.FS) Option {
+	return func(p *Pivot) {
+		p.migrations = fsys
+	}
+}
+
+// WithSnapshotFS reads snapshots from fsys instead of cfg.SnapshotDir.
+// New snapshots are still written to cfg.SnapshotDir.
+func WithSnapshotFS(fsys fs.FS) Option {
+	return func(p *Pivot) {
+		p.snapshots = fsys
+	}
+}
+
+// WithStatementTimeout limits how long each statement of a SQL migration may
+// run. When it expires the statement is cancelled on the server and the
+// migration fails with an interruption error.
+func WithStatementTimeout(timeout time.Duration) Option {
+	return func(p *Pivot) {
+		p.statementTimeout = timeout
+	}
+}
+
+// WithLockWait bounds how long each statement of a SQL migration waits for
+// metadata locks by setting lock_wait_timeout, so that an ALTER TABLE
+// queued behind a long transaction fails instead of stalling every query
+// on the table. A statement that times out is retried up to retries times,
+// waiting longer before each retry.
+func WithLockWait(timeout time.Duration, retries int) Option {
+	return func(p *Pivot) {
+		p.lockWaitTimeout = timeout
+		p.lockRetries = retries
+	}
+}
+
+// WithLogger reports the progress of long operations, such as the row copy
+// of an online schema change, through logf. log.Printf fits.
+func WithLogger(logf func(format string, args ...interface{})) Option {
+	return func(p *Pivot) {
+		p.logf = logf
+	}
+}
+
+// WithoutDatabase opens the Pivot without connecting, leaving the connection
+// unresolved, for work that only reads migration and snapshot files, such
+// as Lint without Changes. Methods that need the database fail.
+func WithoutDatabase() Option {
+	return func(p *Pivot) {
+		p.offline = true
+	}
+}
+
+// Open connects to the database described by cfg. The connection string is
+// resolved as by Config.Resolve, so cfg may use discrete credentials,
+// ${VAR} references or a password file instead of a full DSN.
+func Open(cfg Config, opts ...Option) (*Pivot, error) {
+	return OpenContext(context.Background(), cfg, opts...)
+}
+
+// OpenContext is like Open but gives up connecting when ctx is done.
+func OpenContext(ctx context.Context, cfg Config, opts ...Option) (*Pivot, error) {
+	objects, err := filter.New(cfg.Include, cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	p := &Pivot{
+		cfg:        cfg,
+		migrations: os.DirFS(cfg.MigrationDir),
+		snapshots:  os.DirFS(cfg.SnapshotDir),
+		filter:     objects,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.offline {
+		return p, nil
+	}
+	if p.cfg, err = cfg.Resolve(); err != nil {
+		return nil, fmt.Errorf("failed to resolve connection: %v", err)
+	}
+	cfg = p.cfg
+	dbManager, err := db.NewDBManagerContext(ctx, cfg.DBMS, cfg.Connection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	dbManager.SetStatementTimeout(p.statementTimeout)
+	dbManager.SetLockWait(p.lockWaitTimeout, p.lockRetries, p.logf)
+	dbManager.SetSchemas(cfg.Schemas)
+	dbManager.SetFilter(p.filter)
+	p.db = dbManager
+	return p, nil
+}
+
+// Init creates the snapshot and migration directories and the
+// schema_migrations table.
+func (p *Pivot) Init() error {
+	return p.InitContext(context.Background())
+}
+
+// InitContext is like Init but gives up creating the table when ctx is done.
+func (p *Pivot) InitContext(ctx context.Context) error {
+	for _, dir := range []string{p.cfg.SnapshotDir, p.cfg.MigrationDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %v", dir, err)
+		}
+	}
+	if err := p.db.InitVersionTable(ctx); err != nil {
+		return fmt.Errorf("failed to initialize version table: %v", err)
+	}
+	return nil
+}
+
+// Close closes the database connection.
+func (p *Pivot) Close() error {
+	if p.db == nil {
+		return nil
+	}
+	return p.db.Close()
+}
+
+// Snapshot writes the current database schema to the snapshot directory.
+func (p *Pivot) Snapshot() error {
+	return p.SnapshotContext(context.Background())
+}
+
+// SnapshotContext is like Snapshot but stops reading the schema when ctx is done.
+func (p *Pivot) SnapshotContext(ctx context.Context) error {
+	return p.db.CaptureSnapshot(ctx, p.cfg.SnapshotDir)
+}
+
+// Diff compares the current database schema with the latest snapshot.
+func (p *Pivot) Diff() ([]Change, error) {
+	return p.DiffContext(context.Background())
+}
+
+// DiffContext is like Diff but stops reading the schema when ctx is done.
+func (p *Pivot) DiffContext(ctx context.Context) ([]Change, error) {
+	prevSnapshot, err := loadPreviousSnapshot(p.snapshots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load previous snapshot: %v", err)
+	}
+	currSchema, err := p.db.GetSchema(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture current schema: %v", err)
+	}
+	strategy := &diff.DefaultDiffStrategy{Filter: p.filter}
+	changes, err := strategy.Compare(prevSnapshot, currSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare schemas: %v", err)
+	}
+	return changes, nil
+}
+
+// DiffAgainst compares the schemas of two live databases and reports the
+// changes that would bring other in line with p. Neither snapshot directory
+// is consulted.
+func (p *Pivot) DiffAgainst(ctx context.Context, other *Pivot) ([]Change, error) {
+	target, err := p.db.GetSchema(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture schema: %v", err)
+	}
+	source, err := other.db.GetSchema(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture schema to compare against: %v", err)
+	}
+	strategy := &diff.DefaultDiffStrategy{Filter: p.filter}
+	changes, err := strategy.Compare(source, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare schemas: %v", err)
+	}
+	return changes, nil
+}
+
+// Generate writes a migration for the differences reported by Diff. It
+// returns ErrNoChanges if there is nothing to migrate.
+func (p *Pivot) Generate() (Migration, error) {
+	return p.GenerateContext(context.Background())
+}
+
+// GenerateContext is like Generate but stops reading the schema when ctx is done.
+func (p *Pivot) GenerateContext(ctx context.Context) (Migration, error) {
+	return p.GenerateWith(ctx, GenerateOptions{})
+}
+
+// GenerateWith is like GenerateContext but names the migration file after
+// opts.Name and writes opts.Metadata as its header.
+func (p *Pivot) GenerateWith(ctx context.Context, opts GenerateOptions) (Migration, error) {
+	changes, err := p.DiffContext(ctx)
+	if err != nil {
+		return Migration{}, err
+	}
+	if len(changes) == 0 {
+		return Migration{}, ErrNoChanges
+	}
+	mig, err := migration.GenerateMigration(changes, p.cfg.MigrationDir, opts)
+	if err != nil {
+		return Migration{}, fmt.Errorf("failed to generate migration: %v", err)
+	}
+	return mig, nil
+}
+
+func loadPreviousSnapshot(fsys fs.FS) (map[string]interface{}, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return make(map[string]interface{}), nil
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() > files[j].Name()
+	})
+	latest := files[0].Name()
+	data, err := fs.ReadFile(fsys, latest)
+	if err != nil {
+		return nil, err
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
@@ -0,0 +1,77 @@
+package dbpivot
+
+import (
+	"context"
+	"db-pivot/internal/diff"
+	"db-pivot/internal/migration"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// DumpOptions controls Dump.
+type DumpOptions struct {
+	// Format of the output. Only "sql" is supported.
+	Format string
+	// Live reads the schema from the database instead of a snapshot.
+	Live bool
+	// Snapshot is the snapshot file to render. Empty means the latest one
+	// in the snapshot directory.
+	Snapshot string
+}
+
+// Dump renders a schema as a script that creates it: tables with their
+// indexes and foreign keys, views, routines and triggers, in dependency
+// order. The script is generated like a migration from an empty database,
+// and every statement may be run again on a database that already has the
+// object, so the file can be kept in the repository next to the snapshots.
+func (p *Pivot) Dump(ctx context.Context, opts DumpOptions) ([]byte, error) {
+	if opts.Format != "" && opts.Format != "sql" {
+		return nil, fmt.Errorf("unsupported dump format %q", opts.Format)
+	}
+	schema, err := p.loadSchema(ctx, opts.Live, opts.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	strategy := &diff.DefaultDiffStrategy{Filter: p.filter}
+	changes, err := strategy.Compare(map[string]interface{}{}, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %v", err)
+	}
+	script, err := migration.Dump(changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render schema: %v", err)
+	}
+	return []byte(script), nil
+}
+
+// loadSchema reads the live schema, the snapshot file path or, when both
+// are unset, the latest snapshot.
+func (p *Pivot) loadSchema(ctx context.Context, live bool, path string) (map[string]interface{}, error) {
+	var schema map[string]interface{}
+	var err error
+	switch {
+	case live:
+		schema, err = p.db.GetSchema(ctx)
+	case path != "":
+		schema, err = readSnapshot(path)
+	default:
+		schema, err = loadPreviousSnapshot(p.snapshots)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema: %v", err)
+	}
+	return schema, nil
+}
+
+func readSnapshot(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
@@ -1,12 +1,55 @@
 package adapters
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"db-pivot/internal/filter"
+	"time"
+)
+
+// Statement is a single SQL statement and its arguments.
+type Statement struct {
+    Query string
+    Args  []interface{}
+}
+
+// LockWait bounds how long statements wait for metadata locks, such as
+// the one an ALTER TABLE needs while long transactions use the table.
+type LockWait struct {
+    // Timeout is the lock_wait_timeout of each statement; zero keeps the
+    // server's.
+    Timeout time.Duration
+    // Retries is how many times a statement that timed out is run again.
+    Retries int
+    // Logf reports retries and algorithm fallbacks; nil discards them.
+    Logf func(format string, args ...interface{})
+}
 
 type DBAdapter interface {
     Connect() error
+    ConnectContext(ctx context.Context) error
+    Close() error
+    // SetSchemas limits GetSchema to the listed schemas, keying objects as
+    // "schema.name". Empty means the schema selected by the connection.
+    SetSchemas(schemas []string)
+    // SetFilter leaves the objects f does not keep out of GetSchema.
+    SetFilter(f *filter.Filter)
     GetSchema() (map[string]interface{}, error)
+    GetSchemaContext(ctx context.Context) (map[string]interface{}, error)
     ApplyMigration(script string) error
+    // ApplyMigrationContext executes script, aborting the statement on the
+    // server when ctx is done.
+    ApplyMigrationContext(ctx context.Context, script string) error
+    // ExecStatementsContext runs stmts in order on one connection, inside a
+    // single transaction when inTx is set, allowing each statement at most
+    // timeout (zero for no limit). It returns how many statements completed.
+    ExecStatementsContext(ctx context.Context, stmts []Statement, inTx bool, timeout time.Duration) (int, error)
+    // SetLockWait bounds the lock waits of ExecStatementsContext.
+    SetLockWait(lw LockWait)
     QueryRow(query string, args ...interface{}) *sql.Row
+    QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+    QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+    BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
 
 type AdapterFactory struct{}
@@ -0,0 +1,111 @@
+package adapters
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ConnParams are the discrete parts of a connection string.
+type ConnParams struct {
+    Host     string
+    Port     int
+    User     string
+    Password string
+    Database string
+}
+
+// BuildDSN assembles a driver connection string for dbms from params.
+func BuildDSN(dbms string, params ConnParams) (string, error) {
+    switch dbms {
+    case "mysql":
+        cfg := mysql.NewConfig()
+        cfg.User = params.User
+        cfg.Passwd = params.Password
+        cfg.DBName = params.Database
+        if params.Host != "" {
+            port := params.Port
+            if port == 0 {
+                port = 3306
+            }
+            cfg.Net = "tcp"
+            cfg.Addr = net.JoinHostPort(params.Host, strconv.Itoa(port))
+        }
+        return cfg.FormatDSN(), nil
+    default:
+        return "", fmt.Errorf("unsupported DBMS: %s", dbms)
+    }
+}
+
+// SetDSNPassword returns dsn with its password replaced by password. An
+// empty password removes it.
+func SetDSNPassword(dbms, dsn, password string) (string, error) {
+    switch dbms {
+    case "mysql":
+        cfg, err := mysql.ParseDSN(dsn)
+        if err != nil {
+            return "", err
+        }
+        cfg.Passwd = password
+        return cfg.FormatDSN(), nil
+    default:
+        return "", fmt.Errorf("unsupported DBMS: %s", dbms)
+    }
+}
+
+// SetDSNParams returns dsn with the non-empty fields of params replacing
+// its own. A host without a port keeps the port of dsn, and the other way
+// around.
+func SetDSNParams(dbms, dsn string, params ConnParams) (string, error) {
+    switch dbms {
+    case "mysql":
+        cfg, err := mysql.ParseDSN(dsn)
+        if err != nil {
+            return "", err
+        }
+        if params.User != "" {
+            cfg.User = params.User
+        }
+        if params.Password != "" {
+            cfg.Passwd = params.Password
+        }
+        if params.Database != "" {
+            cfg.DBName = params.Database
+        }
+        if params.Host != "" || params.Port != 0 {
+            host, port := "localhost", "3306"
+            if cfg.Net == "tcp" {
+                if h, p, err := net.SplitHostPort(cfg.Addr); err == nil {
+                    host, port = h, p
+                }
+            }
+            if params.Host != "" {
+                host = params.Host
+            }
+            if params.Port != 0 {
+                port = strconv.Itoa(params.Port)
+            }
+            cfg.Net = "tcp"
+            cfg.Addr = net.JoinHostPort(host, port)
+        }
+        return cfg.FormatDSN(), nil
+    default:
+        return "", fmt.Errorf("unsupported DBMS: %s", dbms)
+    }
+}
+
+// DSNPassword returns the password embedded in dsn, if any.
+func DSNPassword(dbms, dsn string) (string, error) {
+    switch dbms {
+    case "mysql":
+        cfg, err := mysql.ParseDSN(dsn)
+        if err != nil {
+            return "", err
+        }
+        return cfg.Passwd, nil
+    default:
+        return "", fmt.Errorf("unsupported DBMS: %s", dbms)
+    }
+}
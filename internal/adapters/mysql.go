@@ -1,14 +1,36 @@
 package adapters
 
 import (
+	"context"
 	"database/sql"
+	"db-pivot/internal/filter"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
+// MySQL error numbers returned by servers that lack a newer
+// information_schema table or column.
+const (
+    errBadField     = 1054
+    errUnknownTable = 1109
+)
+
+// killTimeout bounds the KILL QUERY issued when a statement is cancelled.
+const killTimeout = 5 * time.Second
+
 type MySQLAdapter struct {
-    conn string
-    db   *sql.DB
+    conn    string
+    db      *sql.DB
+    schemas []string
+    filter  *filter.Filter
+
+    lockWait LockWait
 }
 
 func NewMySQLAdapter(conn string) *MySQLAdapter {
@@ -16,84 +38,558 @@ func NewMySQLAdapter(conn string) *MySQLAdapter {
 }
 
 func (m *MySQLAdapter) Connect() error {
+    return m.ConnectContext(context.Background())
+}
+
+func (m *MySQLAdapter) ConnectContext(ctx context.Context) error {
     db, err := sql.Open("mysql", m.conn)
     if err != nil {
         return err
     }
     m.db = db
-    return db.Ping()
+    return db.PingContext(ctx)
+}
+
+func (m *MySQLAdapter) Close() error {
+    if m.db == nil {
+        return nil
+    }
+    return m.db.Close()
+}
+
+// SetSchemas makes GetSchema read the listed databases instead of the one
+// selected by the connection. Objects are then keyed as "schema.name".
+func (m *MySQLAdapter) SetSchemas(schemas []string) {
+    m.schemas = schemas
+}
+
+func (m *MySQLAdapter) SetFilter(f *filter.Filter) {
+    m.filter = f
 }
 
 func (m *MySQLAdapter) GetSchema() (map[string]interface{}, error) {
-    schema := make(map[string]interface{})
+    return m.GetSchemaContext(context.Background())
+}
 
-  
-    tables, err := m.getTables()
+func (m *MySQLAdapter) GetSchemaContext(ctx context.Context) (map[string]interface{}, error) {
+    scopes, err := m.scopes(ctx)
     if err != nil {
         return nil, err
     }
 
- 
-    for _, table := range tables {
-        columns, err := m.getColumns(table)
+    // Views may read from any schema in scope, so every table and view is
+    // listed before the views are read.
+    objects := make(map[string]string)
+    for i := range scopes {
+        sc := &scopes[i]
+        sc.tables, sc.views, err = m.getTables(ctx, sc.name)
         if err != nil {
             return nil, err
         }
-        schema[table] = map[string]interface{}{
-            "columns": columns,
+        sc.tables = m.filterNames("table", *sc, sc.tables)
+        sc.views = m.filterNames("view", *sc, sc.views)
+        for _, name := range append(append([]string{}, sc.tables...), sc.views...) {
+            objects[sc.key(name)] = sc.reference(name)
+        }
+    }
+
+    schema := make(map[string]interface{})
+    for _, sc := range scopes {
+        if err := m.readSchema(ctx, sc, objects, schema); err != nil {
+            return nil, err
+        }
+    }
+    return m.filter.Apply(schema), nil
+}
+
+// filterNames drops the tables or views the filter excludes before their
+// columns and definitions are read.
+func (m *MySQLAdapter) filterNames(kind string, sc scope, names []string) []string {
+    var kept []string
+    for _, name := range names {
+        if m.filter.Match(kind, sc.key(name)) {
+            kept = append(kept, name)
+        }
+    }
+    return kept
+}
+
+// scope is one database read by GetSchema. Its objects are qualified with
+// the database name when several databases are read.
+type scope struct {
+    name      string
+    qualified bool
+    tables    []string
+    views     []string
+}
+
+// key is the snapshot key of the object name in the scope.
+func (s scope) key(name string) string {
+    if s.qualified {
+        return s.name + "." + name
+    }
+    return name
+}
+
+// reference is how view definitions refer to the object name.
+func (s scope) reference(name string) string {
+    if s.qualified {
+        return fmt.Sprintf("`%s`.`%s`", s.name, name)
+    }
+    return "`" + name + "`"
+}
+
+func (m *MySQLAdapter) scopes(ctx context.Context) ([]scope, error) {
+    if len(m.schemas) > 0 {
+        scopes := make([]scope, len(m.schemas))
+        for i, name := range m.schemas {
+            scopes[i] = scope{name: name, qualified: true}
+        }
+        return scopes, nil
+    }
+    var name sql.NullString
+    if err := m.db.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&name); err != nil {
+        return nil, err
+    }
+    if !name.Valid {
+        return nil, errors.New("no database selected; set one in the connection or list schemas in the config")
+    }
+    return []scope{{name: name.String}}, nil
+}
+
+func (m *MySQLAdapter) readSchema(ctx context.Context, sc scope, objects map[string]string, schema map[string]interface{}) error {
+    checks, err := m.getChecks(ctx, sc.name)
+    if err != nil {
+        return err
+    }
+
+    options, err := m.getTableOptions(ctx, sc.name)
+    if err != nil {
+        return err
+    }
+
+    partitions, err := m.getPartitions(ctx, sc.name)
+    if err != nil {
+        return err
+    }
+
+    indexes, err := m.getIndexes(ctx, sc.name)
+    if err != nil {
+        return err
+    }
+
+    foreignKeys, err := m.getForeignKeys(ctx, sc)
+    if err != nil {
+        return err
+    }
+
+    for _, table := range sc.tables {
+        columns, err := m.getColumns(ctx, sc.name, table)
+        if err != nil {
+            return err
+        }
+        // Indexes and foreign keys are always present, even when empty, so
+        // that snapshots taken before they were captured can be told apart.
+        tableData := map[string]interface{}{
+            "columns":      columns,
+            "indexes":      orEmpty(indexes[table]),
+            "foreign_keys": orEmpty(foreignKeys[table]),
+        }
+        if opts, ok := options[table]; ok {
+            tableData["options"] = opts
+        }
+        if scheme, ok := partitions[table]; ok {
+            tableData["partitioning"] = scheme
+        }
+        if len(checks[table]) > 0 {
+            tableData["checks"] = checks[table]
+        }
+        schema[sc.key(table)] = tableData
+    }
+
+    if len(sc.views) > 0 {
+        viewDefs, err := m.getViews(ctx, sc, objects)
+        if err != nil {
+            return err
+        }
+        for name, view := range viewDefs {
+            schema[name] = view
         }
     }
 
-    return schema, nil
+    routines, err := m.getRoutines(ctx, sc)
+    if err != nil {
+        return err
+    }
+    for key, routine := range routines {
+        schema[key] = routine
+    }
+
+    triggers, err := m.getTriggers(ctx, sc)
+    if err != nil {
+        return err
+    }
+    for key, trigger := range triggers {
+        schema[key] = trigger
+    }
+    return nil
 }
 
 func (m *MySQLAdapter) ApplyMigration(script string) error {
-    _, err := m.db.Exec(script)
+    return m.ApplyMigrationContext(context.Background(), script)
+}
+
+// ApplyMigrationContext runs script on a dedicated connection. Cancelling ctx
+// only closes the client side of a MySQL connection, so the statement is
+// also killed on the server to keep a long ALTER TABLE from running on.
+func (m *MySQLAdapter) ApplyMigrationContext(ctx context.Context, script string) error {
+    _, err := m.ExecStatementsContext(ctx, []Statement{{Query: script}}, false, 0)
     return err
 }
 
-func (m *MySQLAdapter) getTables() ([]string, error) {
-    rows, err := m.db.Query("SHOW TABLES")
+// ExecStatementsContext runs stmts in order on a dedicated connection, inside
+// one transaction when inTx is set. Each statement may run for at most
+// timeout, zero meaning no limit, and is killed on the server when it is
+// cancelled, as in ApplyMigrationContext. Lock waits are bounded and
+// retried as set by SetLockWait. It returns how many statements completed.
+func (m *MySQLAdapter) ExecStatementsContext(ctx context.Context, stmts []Statement, inTx bool, timeout time.Duration) (int, error) {
+    conn, err := m.db.Conn(ctx)
+    if err != nil {
+        return 0, err
+    }
+    defer conn.Close()
+
+    var connID int64
+    if err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&connID); err != nil {
+        return 0, err
+    }
+    if err := m.setLockWaitTimeout(ctx, conn); err != nil {
+        return 0, err
+    }
+
+    exec := conn.ExecContext
+    var tx *sql.Tx
+    if inTx {
+        if tx, err = conn.BeginTx(ctx, nil); err != nil {
+            return 0, err
+        }
+        defer tx.Rollback()
+        exec = tx.ExecContext
+    }
+
+    for i, stmt := range stmts {
+        if err := m.execRetrying(ctx, exec, connID, stmt, timeout, inTx); err != nil {
+            return i, err
+        }
+    }
+    if tx != nil {
+        if err := tx.Commit(); err != nil {
+            return len(stmts), err
+        }
+    }
+    return len(stmts), nil
+}
+
+func (m *MySQLAdapter) execKillable(ctx context.Context, exec func(context.Context, string, ...interface{}) (sql.Result, error), connID int64, stmt Statement, timeout time.Duration) error {
+    if timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, timeout)
+        defer cancel()
+    }
+    _, err := exec(ctx, stmt.Query, stmt.Args...)
+    if err != nil && ctx.Err() != nil {
+        killCtx, cancel := context.WithTimeout(context.Background(), killTimeout)
+        defer cancel()
+        if _, killErr := m.db.ExecContext(killCtx, fmt.Sprintf("KILL QUERY %d", connID)); killErr != nil {
+            return fmt.Errorf("%v (failed to kill query %d: %v)", err, connID, killErr)
+        }
+    }
+    return err
+}
+
+// getTables lists base tables and views separately. SHOW TABLES mixes them,
+// which made views look like tables in snapshots.
+func (m *MySQLAdapter) getTables(ctx context.Context, schema string) ([]string, []string, error) {
+    rows, err := m.db.QueryContext(ctx, fmt.Sprintf("SHOW FULL TABLES FROM `%s`", schema))
+    if err != nil {
+        return nil, nil, err
+    }
+    defer rows.Close()
+
+    var tables, views []string
+    for rows.Next() {
+        var name, tableType string
+        if err := rows.Scan(&name, &tableType); err != nil {
+            return nil, nil, err
+        }
+        if tableType == "VIEW" {
+            views = append(views, name)
+        } else {
+            tables = append(tables, name)
+        }
+    }
+    return tables, views, rows.Err()
+}
+
+// getViews reads the view definitions of a scope. objects maps the key of
+// every table and view in scope to how definitions refer to it, and limits
+// what each view is recorded to depend on.
+func (m *MySQLAdapter) getViews(ctx context.Context, sc scope, objects map[string]string) (map[string]interface{}, error) {
+    usage, haveUsage, err := m.getViewUsage(ctx, sc, objects)
+    if err != nil {
+        return nil, err
+    }
+    rows, err := m.db.QueryContext(ctx, `
+        SELECT TABLE_NAME, VIEW_DEFINITION, CHECK_OPTION, SECURITY_TYPE
+        FROM information_schema.VIEWS
+        WHERE TABLE_SCHEMA = ?`, sc.name)
     if err != nil {
         return nil, err
     }
     defer rows.Close()
 
-    var tables []string
+    views := make(map[string]interface{})
     for rows.Next() {
-        var table string
-        if err := rows.Scan(&table); err != nil {
+        var name, definition, checkOption, securityType sql.NullString
+        if err := rows.Scan(&name, &definition, &checkOption, &securityType); err != nil {
             return nil, err
         }
-        tables = append(tables, table)
+        key := sc.key(name.String)
+        // A single schema is stored without qualifiers; across schemas they
+        // are what tells the objects apart.
+        def := strings.TrimSpace(definition.String)
+        if !sc.qualified {
+            def = normalizeViewDefinition(def, sc.name)
+        }
+        dependsOn := usage[key]
+        if !haveUsage {
+            dependsOn = referencedObjects(def, key, objects)
+        }
+        views[key] = map[string]interface{}{
+            "type":         "view",
+            "definition":   def,
+            "checkOption":  checkOption.String,
+            "securityType": securityType.String,
+            "dependsOn":    dependsOn,
+        }
+    }
+    return views, rows.Err()
+}
+
+func sortedKeys(m map[string]string) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
     }
-    return tables, rows.Err()
+    sort.Strings(keys)
+    return keys
+}
+
+// normalizeViewDefinition strips the schema qualifier MySQL adds to every
+// table in a stored view definition, so that snapshots of the same view taken
+// from different databases compare equal.
+func normalizeViewDefinition(def, schema string) string {
+    return strings.TrimSpace(strings.ReplaceAll(def, "`"+schema+"`.", ""))
 }
 
-func (m *MySQLAdapter) getColumns(table string) (map[string]interface{}, error) {
-    rows, err := m.db.Query("SHOW COLUMNS FROM " + table)
+func (m *MySQLAdapter) getColumns(ctx context.Context, schema, table string) (map[string]interface{}, error) {
+    rows, err := m.db.QueryContext(ctx, fmt.Sprintf("SHOW FULL COLUMNS FROM `%s`.`%s`", schema, table))
     if err != nil {
         return nil, err
     }
     defer rows.Close()
 
     columns := make(map[string]interface{})
+    hasGenerated := false
+    position := 0
     for rows.Next() {
-        var field, colType, null, key, defaultVal, extra sql.NullString
-        if err := rows.Scan(&field, &colType, &null, &key, &defaultVal, &extra); err != nil {
+        var field, colType, collation, null, key, defaultVal, extra, privileges, comment sql.NullString
+        if err := rows.Scan(&field, &colType, &collation, &null, &key, &defaultVal, &extra, &privileges, &comment); err != nil {
+            return nil, err
+        }
+        position++
+        col := map[string]interface{}{
+            "type":        colType.String,
+            "null":        null.String == "YES",
+            "key":         key.String,
+            "default":     defaultVal.String,
+            "default_sql": defaultSQL(defaultVal, colType.String, extra.String),
+            "extra":       extra.String,
+            "position":    position,
+        }
+        if collation.Valid {
+            col["collation"] = collation.String
+            col["charset"] = charsetOf(collation.String)
+        }
+        if comment.String != "" {
+            col["comment"] = comment.String
+        }
+        columns[field.String] = col
+        if strings.Contains(extra.String, "VIRTUAL GENERATED") || strings.Contains(extra.String, "STORED GENERATED") {
+            hasGenerated = true
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    if hasGenerated {
+        if err := m.addGenerationExpressions(ctx, schema, table, columns); err != nil {
             return nil, err
         }
-        columns[field.String] = map[string]interface{}{
-            "type":    colType.String,
-            "null":    null.String == "YES",
-            "key":     key.String,
-            "default": defaultVal.String,
-            "extra":   extra.String,
+    }
+    return columns, nil
+}
+
+// defaultSQL renders a column default as it is written after DEFAULT, or
+// "" when the column has none. "default" in the snapshot cannot tell an
+// empty string from no default; this can.
+func defaultSQL(def sql.NullString, colType, extra string) string {
+    if !def.Valid {
+        return ""
+    }
+    value := def.String
+    upper := strings.ToUpper(value)
+    switch {
+    case strings.Contains(extra, "DEFAULT_GENERATED"):
+        if strings.HasPrefix(upper, "CURRENT_TIMESTAMP") || strings.HasPrefix(upper, "NOW(") || strings.HasPrefix(upper, "LOCALTIME") {
+            return value
         }
+        return "(" + value + ")"
+    case strings.HasPrefix(upper, "CURRENT_TIMESTAMP"):
+        return value
+    case strings.HasPrefix(colType, "bit"), numericType.MatchString(colType):
+        return value
+    }
+    return "'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(value) + "'"
+}
+
+var numericType = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|integer|bigint|decimal|numeric|float|double|real)\b`)
+
+func orEmpty(m map[string]interface{}) map[string]interface{} {
+    if m == nil {
+        return map[string]interface{}{}
     }
-    return columns, rows.Err()
+    return m
+}
+
+// getTableOptions reads engine, row format, default charset and collation,
+// and comment of every base table.
+func (m *MySQLAdapter) getTableOptions(ctx context.Context, schema string) (map[string]map[string]interface{}, error) {
+    rows, err := m.db.QueryContext(ctx, `
+        SELECT TABLE_NAME, ENGINE, ROW_FORMAT, TABLE_COLLATION, TABLE_COMMENT
+        FROM information_schema.TABLES
+        WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE'`, schema)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    options := make(map[string]map[string]interface{})
+    for rows.Next() {
+        var name, engine, rowFormat, collation, comment sql.NullString
+        if err := rows.Scan(&name, &engine, &rowFormat, &collation, &comment); err != nil {
+            return nil, err
+        }
+        options[name.String] = map[string]interface{}{
+            "engine":    engine.String,
+            "rowFormat": strings.ToUpper(rowFormat.String),
+            "charset":   charsetOf(collation.String),
+            "collation": collation.String,
+            "comment":   comment.String,
+        }
+    }
+    return options, rows.Err()
+}
+
+// charsetOf returns the character set of a MySQL collation, which is always
+// the collation name up to the first underscore.
+func charsetOf(collation string) string {
+    charset, _, _ := strings.Cut(collation, "_")
+    return charset
+}
+
+// addGenerationExpressions fills in the expression of generated columns,
+// which SHOW COLUMNS only flags in Extra.
+func (m *MySQLAdapter) addGenerationExpressions(ctx context.Context, schema, table string, columns map[string]interface{}) error {
+    rows, err := m.db.QueryContext(ctx, `
+        SELECT COLUMN_NAME, GENERATION_EXPRESSION, EXTRA
+        FROM information_schema.COLUMNS
+        WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND GENERATION_EXPRESSION <> ''`, schema, table)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var name, expr, extra string
+        if err := rows.Scan(&name, &expr, &extra); err != nil {
+            return err
+        }
+        col, ok := columns[name].(map[string]interface{})
+        if !ok {
+            continue
+        }
+        storage := "VIRTUAL"
+        if strings.Contains(extra, "STORED") {
+            storage = "STORED"
+        }
+        col["generated"] = expr
+        col["storage"] = storage
+    }
+    return rows.Err()
+}
+
+// getChecks reads CHECK constraints, grouped by table. Servers older than
+// MySQL 8.0.16 have no CHECK_CONSTRAINTS table and report none.
+func (m *MySQLAdapter) getChecks(ctx context.Context, schema string) (map[string]map[string]interface{}, error) {
+    rows, err := m.db.QueryContext(ctx, `
+        SELECT tc.TABLE_NAME, tc.CONSTRAINT_NAME, cc.CHECK_CLAUSE, tc.ENFORCED
+        FROM information_schema.TABLE_CONSTRAINTS tc
+        JOIN information_schema.CHECK_CONSTRAINTS cc
+          ON cc.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA AND cc.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+        WHERE tc.TABLE_SCHEMA = ? AND tc.CONSTRAINT_TYPE = 'CHECK'`, schema)
+    if err != nil {
+        var myErr *mysql.MySQLError
+        if errors.As(err, &myErr) && (myErr.Number == errUnknownTable || myErr.Number == errBadField) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    defer rows.Close()
+
+    checks := make(map[string]map[string]interface{})
+    for rows.Next() {
+        var table, name, clause, enforced string
+        if err := rows.Scan(&table, &name, &clause, &enforced); err != nil {
+            return nil, err
+        }
+        def := fmt.Sprintf("CHECK %s", clause)
+        if !strings.HasPrefix(clause, "(") {
+            def = fmt.Sprintf("CHECK (%s)", clause)
+        }
+        if enforced == "NO" {
+            def += " NOT ENFORCED"
+        }
+        if checks[table] == nil {
+            checks[table] = make(map[string]interface{})
+        }
+        checks[table][name] = def
+    }
+    return checks, rows.Err()
 }
 
 func (m *MySQLAdapter) QueryRow(query string, args ...interface{}) *sql.Row {
-    return m.db.QueryRow(query, args...)
-}
\ No newline at end of file
+    return m.QueryRowContext(context.Background(), query, args...)
+}
+
+func (m *MySQLAdapter) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+    return m.db.QueryRowContext(ctx, query, args...)
+}
+
+func (m *MySQLAdapter) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+    return m.db.QueryContext(ctx, query, args...)
+}
+
+func (m *MySQLAdapter) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+    return m.db.BeginTx(ctx, opts)
+}
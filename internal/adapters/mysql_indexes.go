@@ -0,0 +1,114 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// getIndexes reads the indexes of every table, grouped by table. Each index
+// lists its key parts in order: a column, a column prefix such as
+// "name(10)" or a functional expression in parentheses, followed by " DESC"
+// for descending parts.
+func (m *MySQLAdapter) getIndexes(ctx context.Context, schema string) (map[string]map[string]interface{}, error) {
+    query := `
+        SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, COLUMN_NAME, SUB_PART, INDEX_TYPE, COLLATION, %s
+        FROM information_schema.STATISTICS
+        WHERE TABLE_SCHEMA = ?
+        ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`
+    rows, err := m.db.QueryContext(ctx, fmt.Sprintf(query, "EXPRESSION"), schema)
+    var myErr *mysql.MySQLError
+    if errors.As(err, &myErr) && myErr.Number == errBadField {
+        // Functional key parts arrived in MySQL 8.0.13.
+        rows, err = m.db.QueryContext(ctx, fmt.Sprintf(query, "NULL"), schema)
+    }
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    indexes := make(map[string]map[string]interface{})
+    for rows.Next() {
+        var table, name, column, indexType, collation, expression sql.NullString
+        var nonUnique int
+        var subPart sql.NullInt64
+        if err := rows.Scan(&table, &name, &nonUnique, &column, &subPart, &indexType, &collation, &expression); err != nil {
+            return nil, err
+        }
+        part := column.String
+        if expression.Valid && expression.String != "" {
+            part = "(" + expression.String + ")"
+        } else if subPart.Valid {
+            part = fmt.Sprintf("%s(%d)", column.String, subPart.Int64)
+        }
+        if collation.String == "D" {
+            part += " DESC"
+        }
+        if indexes[table.String] == nil {
+            indexes[table.String] = make(map[string]interface{})
+        }
+        idx, ok := indexes[table.String][name.String].(map[string]interface{})
+        if !ok {
+            idx = map[string]interface{}{
+                "unique":  nonUnique == 0,
+                "type":    indexType.String,
+                "columns": []interface{}{},
+            }
+            indexes[table.String][name.String] = idx
+        }
+        idx["columns"] = append(idx["columns"].([]interface{}), part)
+    }
+    return indexes, rows.Err()
+}
+
+// getForeignKeys reads the foreign keys of every table, grouped by table.
+// The referenced table is keyed like snapshot tables, and qualified with
+// its schema when it lives in a schema other than the one being read.
+func (m *MySQLAdapter) getForeignKeys(ctx context.Context, sc scope) (map[string]map[string]interface{}, error) {
+    rows, err := m.db.QueryContext(ctx, `
+        SELECT k.TABLE_NAME, k.CONSTRAINT_NAME, k.COLUMN_NAME,
+               k.REFERENCED_TABLE_SCHEMA, k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME,
+               r.UPDATE_RULE, r.DELETE_RULE
+        FROM information_schema.KEY_COLUMN_USAGE k
+        JOIN information_schema.REFERENTIAL_CONSTRAINTS r
+          ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME
+         AND r.TABLE_NAME = k.TABLE_NAME
+        WHERE k.TABLE_SCHEMA = ? AND k.REFERENCED_TABLE_NAME IS NOT NULL
+        ORDER BY k.TABLE_NAME, k.CONSTRAINT_NAME, k.ORDINAL_POSITION`, sc.name)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    keys := make(map[string]map[string]interface{})
+    for rows.Next() {
+        var table, name, column, refSchema, refTable, refColumn, onUpdate, onDelete string
+        if err := rows.Scan(&table, &name, &column, &refSchema, &refTable, &refColumn, &onUpdate, &onDelete); err != nil {
+            return nil, err
+        }
+        if keys[table] == nil {
+            keys[table] = make(map[string]interface{})
+        }
+        fk, ok := keys[table][name].(map[string]interface{})
+        if !ok {
+            references := sc.key(refTable)
+            if refSchema != sc.name {
+                references = refSchema + "." + refTable
+            }
+            fk = map[string]interface{}{
+                "references":         references,
+                "columns":            []interface{}{},
+                "referenced_columns": []interface{}{},
+                "on_update":          onUpdate,
+                "on_delete":          onDelete,
+            }
+            keys[table][name] = fk
+        }
+        fk["columns"] = append(fk["columns"].([]interface{}), column)
+        fk["referenced_columns"] = append(fk["referenced_columns"].([]interface{}), refColumn)
+    }
+    return keys, rows.Err()
+}
@@ -0,0 +1,125 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL error numbers of a statement that gave up waiting for a lock and of
+// ALTER TABLE algorithms or lock levels the server cannot honour.
+const (
+    errLockWaitTimeout         = 1205
+    errUnknownAlterAlgorithm   = 1800
+    errAlterNotSupported       = 1845
+    errAlterNotSupportedReason = 1846
+)
+
+// lockRetryBackoff is the wait before the first retry of a statement that
+// timed out waiting for a lock. It doubles with each retry.
+const lockRetryBackoff = time.Second
+
+var (
+    // algorithmClause matches the ALGORITHM clause, and the LOCK clause
+    // after it, that a statement ends with.
+    algorithmClause = regexp.MustCompile(`(?i)\s*,\s*ALGORITHM\s*=\s*(\w+)(?:\s*,\s*LOCK\s*=\s*\w+)?\s*;?\s*$`)
+    implicitCommit  = regexp.MustCompile(`(?i)^\s*(ALTER|CREATE|DROP|RENAME|TRUNCATE)\b`)
+)
+
+// SetLockWait makes ExecStatementsContext bound how long each statement
+// waits for locks and retry the ones that time out.
+func (m *MySQLAdapter) SetLockWait(lw LockWait) {
+    m.lockWait = lw
+}
+
+// setLockWaitTimeout sets lock_wait_timeout, in whole seconds, for the
+// statements run on conn.
+func (m *MySQLAdapter) setLockWaitTimeout(ctx context.Context, conn *sql.Conn) error {
+    if m.lockWait.Timeout <= 0 {
+        return nil
+    }
+    seconds := int64(math.Ceil(m.lockWait.Timeout.Seconds()))
+    if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET SESSION lock_wait_timeout = %d", seconds)); err != nil {
+        return fmt.Errorf("failed to set lock_wait_timeout: %v", err)
+    }
+    return nil
+}
+
+// execRetrying runs stmt through execKillable. A statement that times out
+// waiting for a metadata lock is run again after a growing pause, unless
+// it is part of a transaction that the timeout may have rolled back. An
+// ALTER TABLE whose ALGORITHM the server rejects is run again with a
+// weaker one: INSTANT falls back to INPLACE without locking, and that to
+// whatever the server picks.
+func (m *MySQLAdapter) execRetrying(ctx context.Context, exec func(context.Context, string, ...interface{}) (sql.Result, error), connID int64, stmt Statement, timeout time.Duration, inTx bool) error {
+    backoff := lockRetryBackoff
+    for retries := 0; ; {
+        err := m.execKillable(ctx, exec, connID, stmt, timeout)
+        var myErr *mysql.MySQLError
+        if err == nil || ctx.Err() != nil || !errors.As(err, &myErr) {
+            return err
+        }
+        switch myErr.Number {
+        case errLockWaitTimeout:
+            if retries >= m.lockWait.Retries || inTx && !implicitCommit.MatchString(stmt.Query) {
+                return err
+            }
+            retries++
+            m.logf("Lock wait timeout on %s; retry %d of %d in %s", summarize(stmt.Query), retries, m.lockWait.Retries, backoff)
+            select {
+            case <-ctx.Done():
+                return err
+            case <-time.After(backoff):
+            }
+            backoff *= 2
+        case errUnknownAlterAlgorithm, errAlterNotSupported, errAlterNotSupportedReason:
+            query, weaker, ok := weakerAlgorithm(stmt.Query)
+            if !ok {
+                return err
+            }
+            m.logf("WARNING: %s: %s; retrying %s", summarize(stmt.Query), myErr.Message, weaker)
+            stmt.Query = query
+        default:
+            return err
+        }
+    }
+}
+
+// weakerAlgorithm relaxes the ALGORITHM clause query ends with. weaker
+// describes the result for the log.
+func weakerAlgorithm(query string) (relaxed, weaker string, ok bool) {
+    match := algorithmClause.FindStringSubmatchIndex(query)
+    if match == nil {
+        return query, "", false
+    }
+    rest := query[:match[0]]
+    if strings.EqualFold(query[match[2]:match[3]], "INSTANT") {
+        return rest + ", ALGORITHM=INPLACE, LOCK=NONE", "with ALGORITHM=INPLACE, LOCK=NONE", true
+    }
+    return rest, "without ALGORITHM and LOCK", true
+}
+
+func (m *MySQLAdapter) logf(format string, args ...interface{}) {
+    if m.lockWait.Logf != nil {
+        m.lockWait.Logf(format, args...)
+    }
+}
+
+// summarize shortens a statement to its first line for logs.
+func summarize(query string) string {
+    query = strings.TrimSpace(query)
+    if i := strings.IndexByte(query, '\n'); i >= 0 {
+        query = query[:i] + " ..."
+    }
+    if len(query) > 80 {
+        query = query[:77] + "..."
+    }
+    return query
+}
@@ -0,0 +1,44 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+)
+
+// getPartitions reads the partitioning scheme and partition list of every
+// partitioned table. Subpartitions are not captured.
+func (m *MySQLAdapter) getPartitions(ctx context.Context, schema string) (map[string]map[string]interface{}, error) {
+    rows, err := m.db.QueryContext(ctx, `
+        SELECT DISTINCT TABLE_NAME, PARTITION_NAME, PARTITION_ORDINAL_POSITION,
+               PARTITION_METHOD, PARTITION_EXPRESSION, PARTITION_DESCRIPTION
+        FROM information_schema.PARTITIONS
+        WHERE TABLE_SCHEMA = ? AND PARTITION_NAME IS NOT NULL
+        ORDER BY TABLE_NAME, PARTITION_ORDINAL_POSITION`, schema)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    partitioning := make(map[string]map[string]interface{})
+    for rows.Next() {
+        var table, name, method, expression, description sql.NullString
+        var position int
+        if err := rows.Scan(&table, &name, &position, &method, &expression, &description); err != nil {
+            return nil, err
+        }
+        scheme, ok := partitioning[table.String]
+        if !ok {
+            scheme = map[string]interface{}{
+                "method":     method.String,
+                "expression": expression.String,
+                "partitions": []interface{}{},
+            }
+            partitioning[table.String] = scheme
+        }
+        scheme["partitions"] = append(scheme["partitions"].([]interface{}), map[string]interface{}{
+            "name":   name.String,
+            "values": description.String,
+        })
+    }
+    return partitioning, rows.Err()
+}
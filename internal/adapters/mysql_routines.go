@@ -0,0 +1,149 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// definerClause matches the DEFINER=user@host clause of SHOW CREATE output.
+// It is dropped from the stored statement so that the same routine created
+// by different users compares equal; the definer is kept separately.
+var definerClause = regexp.MustCompile("DEFINER=(`[^`]*`|[^@\\s]*)@(`[^`]*`|\\S*)\\s+")
+
+// getRoutines reads stored procedures and functions, keyed in the snapshot
+// as "procedure:name" and "function:name" since they do not share the
+// table namespace. Across several schemas the name is "schema.name".
+func (m *MySQLAdapter) getRoutines(ctx context.Context, sc scope) (map[string]interface{}, error) {
+    rows, err := m.db.QueryContext(ctx, `
+        SELECT ROUTINE_NAME, ROUTINE_TYPE, DEFINER, ROUTINE_DEFINITION
+        FROM information_schema.ROUTINES
+        WHERE ROUTINE_SCHEMA = ?`, sc.name)
+    if err != nil {
+        return nil, err
+    }
+    type routine struct {
+        name, kind, definer, body string
+    }
+    var found []routine
+    for rows.Next() {
+        var name, kind, definer, body sql.NullString
+        if err := rows.Scan(&name, &kind, &definer, &body); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        found = append(found, routine{name.String, strings.ToLower(kind.String), definer.String, body.String})
+    }
+    if err := rows.Close(); err != nil {
+        return nil, err
+    }
+
+    routines := make(map[string]interface{})
+    for _, r := range found {
+        create, err := m.showCreateRoutine(ctx, sc, r.kind, r.name)
+        if err != nil {
+            return nil, err
+        }
+        params, returns, err := m.getParameters(ctx, sc.name, r.name, r.kind)
+        if err != nil {
+            return nil, err
+        }
+        routines[r.kind+":"+sc.key(r.name)] = map[string]interface{}{
+            "type":       r.kind,
+            "name":       r.name,
+            "definer":    r.definer,
+            "parameters": params,
+            "returns":    returns,
+            "body":       r.body,
+            "create":     create,
+        }
+    }
+    return routines, nil
+}
+
+// showCreateRoutine returns the CREATE statement of a routine. Across
+// several schemas the routine name is qualified so the statement creates it
+// in the right one.
+func (m *MySQLAdapter) showCreateRoutine(ctx context.Context, sc scope, kind, name string) (string, error) {
+    var routineName, sqlMode, create, charset, collation, dbCollation sql.NullString
+    query := fmt.Sprintf("SHOW CREATE %s `%s`.`%s`", strings.ToUpper(kind), sc.name, name)
+    err := m.db.QueryRowContext(ctx, query).Scan(&routineName, &sqlMode, &create, &charset, &collation, &dbCollation)
+    if err != nil {
+        return "", fmt.Errorf("failed to read %s %s: %v", kind, name, err)
+    }
+    stmt := strings.TrimSpace(definerClause.ReplaceAllString(create.String, ""))
+    if sc.qualified {
+        header := fmt.Sprintf("%s `%s`", strings.ToUpper(kind), name)
+        stmt = strings.Replace(stmt, header, fmt.Sprintf("%s %s", strings.ToUpper(kind), sc.reference(name)), 1)
+    }
+    return stmt, nil
+}
+
+func (m *MySQLAdapter) getParameters(ctx context.Context, schema, name, kind string) (string, string, error) {
+    rows, err := m.db.QueryContext(ctx, `
+        SELECT ORDINAL_POSITION, PARAMETER_MODE, PARAMETER_NAME, DTD_IDENTIFIER
+        FROM information_schema.PARAMETERS
+        WHERE SPECIFIC_SCHEMA = ? AND SPECIFIC_NAME = ? AND ROUTINE_TYPE = ?
+        ORDER BY ORDINAL_POSITION`, schema, name, strings.ToUpper(kind))
+    if err != nil {
+        return "", "", err
+    }
+    defer rows.Close()
+
+    var params []string
+    var returns string
+    for rows.Next() {
+        var pos int
+        var mode, paramName, dataType sql.NullString
+        if err := rows.Scan(&pos, &mode, &paramName, &dataType); err != nil {
+            return "", "", err
+        }
+        if pos == 0 {
+            returns = dataType.String
+            continue
+        }
+        param := strings.TrimSpace(fmt.Sprintf("%s %s %s", mode.String, paramName.String, dataType.String))
+        params = append(params, param)
+    }
+    return strings.Join(params, ", "), returns, rows.Err()
+}
+
+// getTriggers reads triggers, keyed in the snapshot as "trigger:name" or
+// "trigger:schema.name" across several schemas.
+func (m *MySQLAdapter) getTriggers(ctx context.Context, sc scope) (map[string]interface{}, error) {
+    rows, err := m.db.QueryContext(ctx, `
+        SELECT TRIGGER_NAME, ACTION_TIMING, EVENT_MANIPULATION, EVENT_OBJECT_TABLE,
+               ACTION_ORDER, ACTION_STATEMENT, DEFINER
+        FROM information_schema.TRIGGERS
+        WHERE TRIGGER_SCHEMA = ?
+        ORDER BY EVENT_OBJECT_TABLE, ACTION_TIMING, EVENT_MANIPULATION, ACTION_ORDER`, sc.name)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    triggers := make(map[string]interface{})
+    for rows.Next() {
+        var name, timing, event, table, statement, definer sql.NullString
+        var order int
+        if err := rows.Scan(&name, &timing, &event, &table, &order, &statement, &definer); err != nil {
+            return nil, err
+        }
+        create := fmt.Sprintf("CREATE TRIGGER %s %s %s ON %s FOR EACH ROW %s",
+            sc.key(name.String), timing.String, event.String, sc.key(table.String), strings.TrimSpace(statement.String))
+        triggers["trigger:"+sc.key(name.String)] = map[string]interface{}{
+            "type":    "trigger",
+            "name":    name.String,
+            "table":   sc.key(table.String),
+            "timing":  timing.String,
+            "event":   event.String,
+            "order":   order,
+            "definer": definer.String,
+            "body":    strings.TrimSpace(statement.String),
+            "create":  create,
+        }
+    }
+    return triggers, rows.Err()
+}
@@ -0,0 +1,76 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// tablePosition matches the keywords a table reference follows in a view
+// definition, with the parentheses MySQL wraps joins in.
+var tablePosition = regexp.MustCompile(`(?i)\b(?:from|join)\s*[(\s]*`)
+
+// getViewUsage reads the tables and views each view of a scope reads from,
+// as snapshot keys limited to objects. ok is false on servers older than
+// MySQL 8.0.13, which have no VIEW_TABLE_USAGE table.
+func (m *MySQLAdapter) getViewUsage(ctx context.Context, sc scope, objects map[string]string) (usage map[string][]interface{}, ok bool, err error) {
+    rows, err := m.db.QueryContext(ctx, `
+        SELECT VIEW_NAME, TABLE_SCHEMA, TABLE_NAME
+        FROM information_schema.VIEW_TABLE_USAGE
+        WHERE VIEW_SCHEMA = ?
+        ORDER BY VIEW_NAME, TABLE_SCHEMA, TABLE_NAME`, sc.name)
+    if err != nil {
+        var myErr *mysql.MySQLError
+        if errors.As(err, &myErr) && myErr.Number == errUnknownTable {
+            return nil, false, nil
+        }
+        return nil, false, err
+    }
+    defer rows.Close()
+
+    usage = make(map[string][]interface{})
+    for rows.Next() {
+        var view, schema, table string
+        if err := rows.Scan(&view, &schema, &table); err != nil {
+            return nil, false, err
+        }
+        key := sc.key(view)
+        used := schema + "." + table
+        if !sc.qualified {
+            if schema != sc.name {
+                continue
+            }
+            used = table
+        }
+        if _, inScope := objects[used]; inScope && used != key {
+            usage[key] = append(usage[key], used)
+        }
+    }
+    return usage, true, rows.Err()
+}
+
+// referencedObjects finds the objects a view definition reads from by
+// looking for their references right after FROM or JOIN, so that a column
+// or alias sharing a table's name is not taken for it. It stands in for
+// VIEW_TABLE_USAGE on older servers.
+func referencedObjects(def, key string, objects map[string]string) []interface{} {
+    var used []interface{}
+    for _, obj := range sortedKeys(objects) {
+        if obj == key {
+            continue
+        }
+        ref := objects[obj]
+        for _, m := range tablePosition.FindAllStringIndex(def, -1) {
+            rest := def[m[1]:]
+            // `other`.`t` is a table of another schema, not `other`.
+            if strings.HasPrefix(rest, ref) && !strings.HasPrefix(rest[len(ref):], ".") {
+                used = append(used, obj)
+                break
+            }
+        }
+    }
+    return used
+}
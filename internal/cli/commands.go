@@ -1,18 +1,19 @@
 package cli
 
 import (
-	"crypto/sha256"
+	"context"
+	"db-pivot"
+	"db-pivot/internal/adapters"
 	"db-pivot/internal/config"
-	"db-pivot/internal/db"
-	"db-pivot/internal/diff"
-	"db-pivot/internal/migration"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"os"
+	"os/signal"
+	"os/user"
 	"path/filepath"
-	"sort"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -22,6 +23,43 @@ var (
     connFlag     string
     snapshotDir  string
     migrationDir string
+    credsFlags   config.Credentials
+    schemasFlag  string
+    includeFlag  string
+    excludeFlag  string
+    passwordEnv  string
+
+    timeoutFlag          time.Duration
+    statementTimeoutFlag time.Duration
+    lockWaitTimeoutFlag  time.Duration
+    lockRetriesFlag      int
+
+    envFlag     string
+    againstFlag string
+    configFlag  string
+
+    nameFlag          string
+    authorFlag        string
+    descriptionFlag   string
+    tagsFlag          []string
+    noTransactionFlag bool
+    dependsOnFlag     []string
+
+    fromFlag         string
+    historyTableFlag string
+    toFlag           string
+
+    versionFlag string
+    scriptFlag  bool
+
+    formatFlag       string
+    liveFlag         bool
+    snapshotFileFlag string
+    outputFlag       string
+    dialectFlag      string
+    analyzeFlag      bool
+    lintFormatFlag   string
+    changesFlag      bool
 )
 
 var rootCmd = &cobra.Command{
@@ -42,36 +80,127 @@ func init() {
     rootCmd.AddCommand(migrateCmd)
     rootCmd.AddCommand(applyCmd)
     rootCmd.AddCommand(rollbackCmd)
-
-    initCmd.Flags().StringVarP(&dbmsFlag, "dbms", "d", "mysql", "Database management system (e.g., mysql)")
-    initCmd.Flags().StringVarP(&connFlag, "connection", "c", "", "Database connection string (required)")
-    initCmd.Flags().StringVarP(&snapshotDir, "snapshot-dir", "s", ".schema_manager/snapshots", "Directory for snapshots")
-    initCmd.Flags().StringVarP(&migrationDir, "migration-dir", "m", ".schema_manager/migrations", "Directory for migrations")
-    initCmd.MarkFlagRequired("connection")
+    rootCmd.AddCommand(statusCmd)
+    rootCmd.AddCommand(planCmd)
+    rootCmd.AddCommand(importCmd)
+    rootCmd.AddCommand(exportCmd)
+    rootCmd.AddCommand(baselineCmd)
+    rootCmd.AddCommand(dumpCmd)
+    rootCmd.AddCommand(translateCmd)
+    rootCmd.AddCommand(lintCmd)
+
+    rootCmd.AddCommand(configCmd)
+
+    flags := rootCmd.PersistentFlags()
+    flags.StringVar(&configFlag, "config", "", "Config file (default: .schema_manager/config.{json,yaml,yml,toml} in this or a parent directory)")
+    flags.StringVarP(&envFlag, "env", "e", "", "Named environment from the config file (e.g., staging)")
+    flags.DurationVar(&timeoutFlag, "timeout", 0, "Abort the command after this long (e.g., 10m); 0 disables")
+    flags.DurationVar(&statementTimeoutFlag, "statement-timeout", 0, "Abort any single migration statement after this long (e.g., 30s); 0 disables")
+    flags.DurationVar(&lockWaitTimeoutFlag, "lock-wait-timeout", 5*time.Second, "Give up waiting for a metadata lock after this long; 0 keeps the server's lock_wait_timeout")
+    flags.IntVar(&lockRetriesFlag, "lock-retries", 3, "Retry a statement that timed out waiting for a lock this many times, backing off between attempts")
+
+    // Config overrides. They take precedence over DBPIVOT_* environment
+    // variables, which take precedence over the config file.
+    flags.StringVarP(&dbmsFlag, "dbms", "d", "mysql", "Database management system (e.g., mysql)")
+    flags.StringVarP(&connFlag, "connection", "c", "", "Database connection string; ${VAR} references are kept, literal passwords are not saved")
+    flags.StringVar(&credsFlags.Host, "host", "", "Database host, instead of --connection")
+    flags.IntVar(&credsFlags.Port, "port", 0, "Database port")
+    flags.StringVar(&credsFlags.User, "user", "", "Database user")
+    flags.StringVar(&credsFlags.Password, "password", "", "Database password; never saved by init")
+    flags.StringVar(&credsFlags.PasswordFile, "password-file", "", "File to read the database password from at runtime")
+    flags.StringVar(&credsFlags.Database, "database", "", "Database name")
+    flags.StringVar(&schemasFlag, "schemas", "", "Comma separated databases to manage together; object names are then schema-qualified")
+    flags.StringVar(&includeFlag, "include", "", "Comma separated glob or /regex/ patterns of objects to manage; others are ignored")
+    flags.StringVar(&excludeFlag, "exclude", "", "Comma separated glob or /regex/ patterns of objects to ignore")
+    flags.StringVarP(&snapshotDir, "snapshot-dir", "s", ".schema_manager/snapshots", "Directory for snapshots")
+    flags.StringVarP(&migrationDir, "migration-dir", "m", ".schema_manager/migrations", "Directory for migrations")
+
+    initCmd.Flags().StringVar(&passwordEnv, "password-env", "", "Environment variable to read the database password from at runtime")
+
+    migrateCmd.Flags().StringVarP(&nameFlag, "name", "n", "", "Name of the migration file, e.g. add_users_email")
+    migrateCmd.Flags().StringVar(&authorFlag, "author", "", "Author recorded in the migration header (default: current user)")
+    migrateCmd.Flags().StringVar(&descriptionFlag, "description", "", "Description recorded in the migration header (default: from --name)")
+    migrateCmd.Flags().StringSliceVar(&tagsFlag, "tags", nil, "Tags recorded in the migration header")
+    migrateCmd.Flags().BoolVar(&noTransactionFlag, "no-transaction", false, "Apply the migration statement by statement instead of in one transaction")
+    migrateCmd.Flags().StringSliceVar(&dependsOnFlag, "depends-on", nil, "Versions that must be applied before this migration")
+
+    planCmd.Flags().BoolVar(&analyzeFlag, "analyze", false, "Estimate the impact and duration of each statement from table sizes")
+
+    importCmd.Flags().StringVar(&fromFlag, "from", "", "Tool the migrations come from: "+strings.Join(dbpivot.ImportFormats(), ", "))
+    importCmd.Flags().StringVar(&historyTableFlag, "history-table", "", "History table of the tool, if not its default")
+    importCmd.MarkFlagRequired("from")
+
+    exportCmd.Flags().StringVar(&toFlag, "to", "", "Tool to write migrations for: "+strings.Join(dbpivot.ExportFormats(), ", "))
+    exportCmd.MarkFlagRequired("to")
+
+    baselineCmd.Flags().StringVar(&versionFlag, "version", "", "Version to mark as applied, along with every older migration")
+    baselineCmd.Flags().BoolVar(&scriptFlag, "script", false, "Also write the CREATE statements of the current schema as that migration")
+    baselineCmd.Flags().StringVarP(&nameFlag, "name", "n", "", "Name of the baseline script (default: baseline)")
+    baselineCmd.Flags().StringVar(&authorFlag, "author", "", "Author recorded in the script header (default: current user)")
+    baselineCmd.MarkFlagRequired("version")
+
+    dumpCmd.Flags().StringVar(&formatFlag, "format", "sql", "Output format (sql)")
+    dumpCmd.Flags().BoolVar(&liveFlag, "live", false, "Read the schema from the database instead of the latest snapshot")
+    dumpCmd.Flags().StringVar(&snapshotFileFlag, "snapshot", "", "Snapshot file to render instead of the latest one")
+    dumpCmd.Flags().StringVarP(&outputFlag, "output", "o", "", "File to write (default: standard output)")
+
+    translateCmd.Flags().StringVar(&dialectFlag, "to", "postgres", "System to translate to: "+strings.Join(dbpivot.TranslateDialects(), ", "))
+    translateCmd.Flags().BoolVar(&liveFlag, "live", false, "Read the schema from the database instead of the latest snapshot")
+    translateCmd.Flags().StringVar(&snapshotFileFlag, "snapshot", "", "Snapshot file to translate instead of the latest one")
+    translateCmd.Flags().StringVar(&authorFlag, "author", "", "Author recorded in the migration header (default: current user)")
+
+    lintCmd.Flags().StringVar(&lintFormatFlag, "format", "human", "Report format: "+strings.Join(dbpivot.LintFormats(), ", "))
+    lintCmd.Flags().StringVarP(&outputFlag, "output", "o", "", "File to write the report to (default: standard output)")
+    lintCmd.Flags().BoolVar(&changesFlag, "changes", false, "Also lint the migration migrate would generate from the changes since the latest snapshot (needs the database)")
+
+    diffCmd.Flags().StringVar(&againstFlag, "against", "", "Compare the live schema with another environment instead of the last snapshot")
 }
 
 var initCmd = &cobra.Command{
     Use:   "init",
     Short: "Initialize schema manager",
     Run: func(cmd *cobra.Command, args []string) {
-        if err := createDirectories(); err != nil {
+        if connFlag == "" && credsFlags.Host == "" {
+            log.Fatalf("Either --connection or --host is required")
+        }
+        path := configFlag
+        if path == "" {
+            path = config.DefaultPath
+        }
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
             log.Fatalf("Failed to create directories: %v", err)
         }
+        warnUnsavedPassword()
+        if passwordEnv != "" {
+            credsFlags.Password = "${" + passwordEnv + "}"
+        }
         cfg := config.Config{
             DBMS:         dbmsFlag,
             Connection:   connFlag,
+            Credentials:  credsFlags,
+            Schemas:      schemaList(),
             SnapshotDir:  snapshotDir,
             MigrationDir: migrationDir,
         }
-        if err := config.InitConfig(cfg); err != nil {
+        if envFlag != "" {
+            cfg = addEnvironment(path, envFlag)
+        }
+        if err := config.InitConfig(path, cfg); err != nil {
             log.Fatalf("Failed to initialize config: %v", err)
         }
-        dbManager, err := db.NewDBManager(dbmsFlag, connFlag)
+        cfg, err := cfg.ForEnvironment(envFlag)
         if err != nil {
-            log.Fatalf("Failed to connect to database: %v", err)
+            log.Fatalf("%v", err)
         }
-        if err := dbManager.InitVersionTable(); err != nil {
-            log.Fatalf("Failed to initialize version table: %v", err)
+        ctx, cancel := commandContext()
+        defer cancel()
+        p, err := dbpivot.OpenContext(ctx, cfg, pivotOptions()...)
+        if err != nil {
+            log.Fatalf("%v", err)
+        }
+        defer p.Close()
+        if err := p.InitContext(ctx); err != nil {
+            log.Fatalf("%v", err)
         }
         log.Println("Schema manager initialized successfully")
     },
@@ -81,15 +210,11 @@ var snapshotCmd = &cobra.Command{
     Use:   "snapshot",
     Short: "Capture current database schema",
     Run: func(cmd *cobra.Command, args []string) {
-        cfg, err := config.LoadConfig()
-        if err != nil {
-            log.Fatalf("Failed to load config: %v", err)
-        }
-        dbManager, err := db.NewDBManager(cfg.DBMS, cfg.Connection)
-        if err != nil {
-            log.Fatalf("Failed to connect to database: %v", err)
-        }
-        if err := dbManager.CaptureSnapshot(cfg.SnapshotDir); err != nil {
+        ctx, cancel := commandContext()
+        defer cancel()
+        p := openPivot(ctx)
+        defer p.Close()
+        if err := p.SnapshotContext(ctx); err != nil {
             log.Fatalf("Failed to capture snapshot: %v", err)
         }
         log.Println("Schema snapshot captured successfully")
@@ -100,26 +225,21 @@ var diffCmd = &cobra.Command{
     Use:   "diff",
     Short: "Compare current schema with previous snapshot",
     Run: func(cmd *cobra.Command, args []string) {
-        cfg, err := config.LoadConfig()
-        if err != nil {
-            log.Fatalf("Failed to load config: %v", err)
-        }
-        prevSnapshot, err := loadPreviousSnapshot(cfg.SnapshotDir)
-        if err != nil {
-            log.Fatalf("Failed to load previous snapshot: %v", err)
-        }
-        dbManager, err := db.NewDBManager(cfg.DBMS, cfg.Connection)
-        if err != nil {
-            log.Fatalf("Failed to connect to database: %v", err)
-        }
-        currSchema, err := dbManager.GetSchema()
-        if err != nil {
-            log.Fatalf("Failed to capture current schema: %v", err)
+        ctx, cancel := commandContext()
+        defer cancel()
+        p := openPivot(ctx)
+        defer p.Close()
+        var changes []dbpivot.Change
+        var err error
+        if againstFlag != "" {
+            other := openPivotFor(ctx, againstFlag)
+            defer other.Close()
+            changes, err = p.DiffAgainst(ctx, other)
+        } else {
+            changes, err = p.DiffContext(ctx)
         }
-        strategy := &diff.DefaultDiffStrategy{}
-        changes, err := strategy.Compare(prevSnapshot, currSchema)
         if err != nil {
-            log.Fatalf("Failed to compare schemas: %v", err)
+            log.Fatalf("%v", err)
         }
         if len(changes) == 0 {
             log.Println("No changes detected")
@@ -127,6 +247,9 @@ var diffCmd = &cobra.Command{
             log.Println("Detected changes:")
             for _, change := range changes {
                 log.Printf("- %s %s: %s", change.Type, change.Object, change.Detail)
+                if change.Warning != "" {
+                    log.Printf("  WARNING: %s", change.Warning)
+                }
             }
         }
     },
@@ -136,36 +259,31 @@ var migrateCmd = &cobra.Command{
     Use:   "migrate",
     Short: "Generate migration script based on schema changes",
     Run: func(cmd *cobra.Command, args []string) {
-        cfg, err := config.LoadConfig()
-        if err != nil {
-            log.Fatalf("Failed to load config: %v", err)
-        }
-        prevSnapshot, err := loadPreviousSnapshot(cfg.SnapshotDir)
-        if err != nil {
-            log.Fatalf("Failed to load previous snapshot: %v", err)
-        }
-        dbManager, err := db.NewDBManager(cfg.DBMS, cfg.Connection)
-        if err != nil {
-            log.Fatalf("Failed to connect to database: %v", err)
-        }
-        currSchema, err := dbManager.GetSchema()
-        if err != nil {
-            log.Fatalf("Failed to capture current schema: %v", err)
-        }
-        strategy := &diff.DefaultDiffStrategy{}
-        changes, err := strategy.Compare(prevSnapshot, currSchema)
-        if err != nil {
-            log.Fatalf("Failed to compare schemas: %v", err)
-        }
-        if len(changes) == 0 {
+        ctx, cancel := commandContext()
+        defer cancel()
+        p := openPivot(ctx)
+        defer p.Close()
+        mig, err := p.GenerateWith(ctx, dbpivot.GenerateOptions{
+            Name: nameFlag,
+            Metadata: dbpivot.Metadata{
+                Author:        authorOrDefault(),
+                Description:   descriptionOrDefault(),
+                Tags:          tagsFlag,
+                NoTransaction: noTransactionFlag,
+                DependsOn:     dependsOnFlag,
+            },
+        })
+        if errors.Is(err, dbpivot.ErrNoChanges) {
             log.Println("No migrations needed")
             return
         }
-        mig, err := migration.GenerateMigration(changes, cfg.MigrationDir)
         if err != nil {
-            log.Fatalf("Failed to generate migration: %v", err)
+            log.Fatalf("%v", err)
+        }
+        log.Printf("Migration script generated: %s", mig.FileName())
+        for _, warning := range mig.Warnings {
+            log.Printf("WARNING: %s", warning)
         }
-        log.Printf("Migration script generated: %s_migration.sql", mig.Version)
     },
 }
 
@@ -173,21 +291,21 @@ var applyCmd = &cobra.Command{
     Use:   "apply",
     Short: "Apply pending migrations",
     Run: func(cmd *cobra.Command, args []string) {
-        cfg, err := config.LoadConfig()
-        if err != nil {
-            log.Fatalf("Failed to load config: %v", err)
-        }
+        ctx, cancel := commandContext()
+        defer cancel()
+        p := openPivot(ctx)
+        defer p.Close()
 
-        dbManager, err := db.NewDBManager(cfg.DBMS, cfg.Connection)
-        if err != nil {
-            log.Fatalf("Failed to connect to database: %v", err)
+        applied, err := p.Apply(ctx, dbpivot.ApplyOptions{})
+        for _, version := range applied {
+            log.Printf("Migration %s applied successfully", version)
         }
-
-        if err := applyMigrations(dbManager, cfg.MigrationDir); err != nil {
+        if err != nil {
+            reportInterruption(err)
             log.Fatalf("Failed to apply migrations: %v", err)
         }
 
-        if err := dbManager.CaptureSnapshot(cfg.SnapshotDir); err != nil {
+        if err := p.SnapshotContext(ctx); err != nil {
             log.Fatalf("Failed to capture post-migration snapshot: %v", err)
         }
 
@@ -195,132 +313,436 @@ var applyCmd = &cobra.Command{
     },
 }
 
-
 var rollbackCmd = &cobra.Command{
     Use:   "rollback",
     Short: "Rollback the last applied migration",
     Run: func(cmd *cobra.Command, args []string) {
-        cfg, err := config.LoadConfig()
+        ctx, cancel := commandContext()
+        defer cancel()
+        p := openPivot(ctx)
+        defer p.Close()
+
+        rolledBack, err := p.Rollback(ctx, dbpivot.RollbackOptions{Steps: 1})
         if err != nil {
-            log.Fatalf("Failed to load config: %v", err)
+            reportInterruption(err)
+            log.Fatalf("%v", err)
+        }
+        if len(rolledBack) == 0 {
+            log.Println("No migrations to rollback")
+            return
+        }
+
+        if err := p.SnapshotContext(ctx); err != nil {
+            log.Fatalf("Failed to capture post-rollback snapshot: %v", err)
+        }
+
+        for _, version := range rolledBack {
+            log.Printf("Migration %s rolled back successfully", version)
         }
+    },
+}
+
+var statusCmd = &cobra.Command{
+    Use:   "status",
+    Short: "Show applied and pending migrations",
+    Run: func(cmd *cobra.Command, args []string) {
+        ctx, cancel := commandContext()
+        defer cancel()
+        p := openPivot(ctx)
+        defer p.Close()
 
-        dbManager, err := db.NewDBManager(cfg.DBMS, cfg.Connection)
+        statuses, err := p.StatusContext(ctx)
         if err != nil {
-            log.Fatalf("Failed to connect to database: %v", err)
+            log.Fatalf("Failed to get migration status: %v", err)
         }
+        if len(statuses) == 0 {
+            log.Println("No migrations found")
+            return
+        }
+        for _, s := range statuses {
+            state := "pending"
+            if s.Applied {
+                state = "applied"
+            }
+            log.Printf("%s [%s] %s", s.Version, s.Source, state)
+        }
+    },
+}
+
+var planCmd = &cobra.Command{
+    Use:   "plan",
+    Short: "Show the statements apply would run",
+    Run: func(cmd *cobra.Command, args []string) {
+        ctx, cancel := commandContext()
+        defer cancel()
+        p := openPivot(ctx)
+        defer p.Close()
 
-        lastVersion, err := dbManager.GetLastAppliedMigration()
+        planned, err := p.Plan(ctx, dbpivot.PlanOptions{Analyze: analyzeFlag})
         if err != nil {
-            log.Fatalf("Failed to get last applied migration: %v", err)
+            log.Fatalf("Failed to plan migrations: %v", err)
         }
-        if lastVersion == "" {
-            log.Println("No migrations to rollback")
+        if len(planned) == 0 {
+            log.Println("No pending migrations")
             return
         }
+        for _, mig := range planned {
+            if mig.Source == "go" {
+                log.Printf("%s [go] %s: statements are only known when it runs", mig.Version, mig.Name)
+                continue
+            }
+            log.Printf("%s [sql] %s: %d statements", mig.Version, mig.Name, len(mig.Statements))
+            for i, stmt := range mig.Statements {
+                log.Printf("  %s", stmt)
+                if i >= len(mig.Analysis) {
+                    continue
+                }
+                a := mig.Analysis[i]
+                if a.Table == "" {
+                    log.Printf("    %s, %s: %s", a.Impact, a.Duration, a.Reason)
+                    continue
+                }
+                size := "does not exist yet"
+                if a.Size != nil {
+                    size = a.Size.String()
+                }
+                log.Printf("    %s (%s): %s, %s: %s", a.Table, size, a.Impact, a.Duration, a.Reason)
+            }
+        }
+    },
+}
 
-        scriptPath := filepath.Join(cfg.MigrationDir, fmt.Sprintf("%s_migration.sql", lastVersion))
-        script, err := os.ReadFile(scriptPath)
+var importCmd = &cobra.Command{
+    Use:   "import <dir>",
+    Short: "Convert another tool's migrations and history into dbpivot migrations",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        ctx, cancel := commandContext()
+        defer cancel()
+        p := openPivot(ctx)
+        defer p.Close()
+
+        result, err := p.Import(ctx, dbpivot.ImportOptions{
+            From:         fromFlag,
+            Dir:          args[0],
+            HistoryTable: historyTableFlag,
+        })
+        for _, warning := range result.Warnings {
+            log.Printf("WARNING: %s", warning)
+        }
         if err != nil {
-            log.Fatalf("Failed to read migration file %s: %v", lastVersion, err)
+            log.Fatalf("Failed to import migrations: %v", err)
         }
+        log.Printf("Imported %d migrations, %d marked as applied", len(result.Written), len(result.Recorded))
+    },
+}
+
+var exportCmd = &cobra.Command{
+    Use:   "export <dir>",
+    Short: "Write the migrations in another tool's layout",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        ctx, cancel := commandContext()
+        defer cancel()
+        p := openPivot(ctx)
+        defer p.Close()
 
-        mig := migration.Migration{
-            Version:  lastVersion,
-            UpScript: string(script),
-            Checksum: fmt.Sprintf("%x", sha256.Sum256(script)),
+        result, err := p.Export(dbpivot.ExportOptions{To: toFlag, Dir: args[0]})
+        for _, warning := range result.Warnings {
+            log.Printf("WARNING: %s", warning)
         }
- 
-        if err := migration.RollbackMigration(dbManager, mig); err != nil {
-            log.Fatalf("Failed to rollback migration %s: %v", lastVersion, err)
+        if err != nil {
+            log.Fatalf("Failed to export migrations: %v", err)
         }
- 
-        if err := dbManager.CaptureSnapshot(cfg.SnapshotDir); err != nil {
-            log.Fatalf("Failed to capture post-rollback snapshot: %v", err)
+        log.Printf("Exported %d files to %s", len(result.Written), args[0])
+    },
+}
+
+var baselineCmd = &cobra.Command{
+    Use:   "baseline",
+    Short: "Mark an existing schema as migrated up to a version",
+    Run: func(cmd *cobra.Command, args []string) {
+        ctx, cancel := commandContext()
+        defer cancel()
+        p := openPivot(ctx)
+        defer p.Close()
+
+        result, err := p.Baseline(ctx, dbpivot.BaselineOptions{
+            Version: versionFlag,
+            Script:  scriptFlag,
+            Name:    nameFlag,
+            Metadata: dbpivot.Metadata{
+                Author:      authorOrDefault(),
+                Description: "Baseline of the existing schema",
+            },
+        })
+        if err != nil {
+            log.Fatalf("Failed to create baseline: %v", err)
+        }
+        if result.Migration != nil {
+            log.Printf("Baseline script written: %s", result.Migration.FileName())
         }
+        for _, version := range result.Recorded {
+            log.Printf("Migration %s marked as applied", version)
+        }
+        log.Println("Baseline created successfully")
+    },
+}
 
-        log.Printf("Migration %s rolled back successfully", lastVersion)
+var dumpCmd = &cobra.Command{
+    Use:   "dump",
+    Short: "Render the schema as a CREATE script",
+    Run: func(cmd *cobra.Command, args []string) {
+        ctx, cancel := commandContext()
+        defer cancel()
+        p := openPivot(ctx)
+        defer p.Close()
+
+        script, err := p.Dump(ctx, dbpivot.DumpOptions{
+            Format:   formatFlag,
+            Live:     liveFlag,
+            Snapshot: snapshotFileFlag,
+        })
+        if err != nil {
+            log.Fatalf("Failed to dump schema: %v", err)
+        }
+        if outputFlag == "" {
+            os.Stdout.Write(script)
+            return
+        }
+        if err := os.WriteFile(outputFlag, script, 0644); err != nil {
+            log.Fatalf("Failed to write %s: %v", outputFlag, err)
+        }
+        log.Printf("Schema written to %s", outputFlag)
     },
 }
 
-func createDirectories() error {
-    dirs := []string{".schema_manager", snapshotDir, migrationDir}
-    for _, dir := range dirs {
-        if err := os.MkdirAll(dir, 0755); err != nil {
-            return err
+var translateCmd = &cobra.Command{
+    Use:   "translate <dir>",
+    Short: "Translate the MySQL schema into another system's DDL",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        ctx, cancel := commandContext()
+        defer cancel()
+        p := openPivot(ctx)
+        defer p.Close()
+
+        result, err := p.Translate(ctx, dbpivot.TranslateOptions{
+            To:       dialectFlag,
+            Dir:      args[0],
+            Live:     liveFlag,
+            Snapshot: snapshotFileFlag,
+            Metadata: dbpivot.Metadata{Author: authorOrDefault()},
+        })
+        if err != nil {
+            log.Fatalf("Failed to translate schema: %v", err)
         }
-    }
-    return nil
+        for _, issue := range result.Unmapped {
+            log.Printf("NOT MAPPED: %s", issue)
+        }
+        log.Printf("Script written: %s", result.Script)
+        log.Printf("Migration written: %s", result.Migration)
+        if len(result.Unmapped) > 0 {
+            log.Printf("%d constructs could not be mapped exactly; review them before running the script", len(result.Unmapped))
+        }
+    },
+}
+
+var lintCmd = &cobra.Command{
+    Use:   "lint [file...]",
+    Short: "Check migrations for risky or incompatible statements",
+    Run: func(cmd *cobra.Command, args []string) {
+        ctx, cancel := commandContext()
+        defer cancel()
+        // Only the pending changes need the database, so that a CI job
+        // without one can lint the migration files.
+        var p *dbpivot.Pivot
+        if changesFlag {
+            p = openPivot(ctx)
+        } else {
+            p = openOffline(ctx)
+        }
+        defer p.Close()
+
+        findings, err := p.Lint(ctx, dbpivot.LintOptions{Files: args, Changes: changesFlag})
+        if err != nil {
+            log.Fatalf("Failed to lint migrations: %v", err)
+        }
+        out := os.Stdout
+        if outputFlag != "" {
+            if out, err = os.Create(outputFlag); err != nil {
+                log.Fatalf("Failed to create report: %v", err)
+            }
+        }
+        err = dbpivot.WriteLintReport(out, lintFormatFlag, findings)
+        if out != os.Stdout {
+            if closeErr := out.Close(); err == nil {
+                err = closeErr
+            }
+        }
+        if err != nil {
+            log.Fatalf("Failed to write report: %v", err)
+        }
+        failed := 0
+        for _, f := range findings {
+            if f.Severity == dbpivot.LintError {
+                failed++
+            }
+        }
+        if failed > 0 {
+            log.Fatalf("%d lint errors", failed)
+        }
+    },
+}
+
+func openPivot(ctx context.Context) *dbpivot.Pivot {
+    return openPivotWith(ctx, loadOptions())
 }
 
-func loadPreviousSnapshot(snapshotDir string) (map[string]interface{}, error) {
-    files, err := os.ReadDir(snapshotDir)
+// openOffline opens the project without connecting to the database, for
+// commands that only read migration and snapshot files.
+func openOffline(ctx context.Context) *dbpivot.Pivot {
+    cfg, _, err := config.LoadUnresolved(loadOptions())
     if err != nil {
-        return nil, err
+        log.Fatalf("Failed to load config: %v", err)
     }
-    if len(files) == 0 {
-        return make(map[string]interface{}), nil
-    }
-    sort.Slice(files, func(i, j int) bool {
-        return files[i].Name() > files[j].Name()
-    })
-    latest := files[0].Name()
-    data, err := os.ReadFile(filepath.Join(snapshotDir, latest))
+    p, err := dbpivot.OpenContext(ctx, cfg, append(pivotOptions(), dbpivot.WithoutDatabase())...)
     if err != nil {
-        return nil, err
+        log.Fatalf("%v", err)
     }
-    var schema map[string]interface{}
-    if err := json.Unmarshal(data, &schema); err != nil {
-        return nil, err
-    }
-    return schema, nil
+    return p
+}
+
+// openPivotFor opens another environment, as for diff --against. Command
+// line overrides only apply to the primary environment.
+func openPivotFor(ctx context.Context, env string) *dbpivot.Pivot {
+    return openPivotWith(ctx, config.LoadOptions{Path: configFlag, Env: env})
 }
 
-func applyMigrations(dbManager *db.DBManager, migrationDir string) error {
-    files, err := os.ReadDir(migrationDir)
+func openPivotWith(ctx context.Context, opts config.LoadOptions) *dbpivot.Pivot {
+    cfg, err := config.LoadConfig(opts)
+    if err != nil {
+        log.Fatalf("Failed to load config: %v", err)
+    }
+    p, err := dbpivot.OpenContext(ctx, cfg, pivotOptions()...)
     if err != nil {
-        return fmt.Errorf("failed to read migration directory: %v", err)
+        log.Fatalf("%v", err)
     }
+    return p
+}
 
-    var migrationFiles []string
-    for _, file := range files {
-        if strings.HasSuffix(file.Name(), ".sql") {
-            migrationFiles = append(migrationFiles, file.Name())
+// loadOptions returns the config file, environment and overrides given on
+// the command line.
+func loadOptions() config.LoadOptions {
+    opts := config.LoadOptions{Path: configFlag, Env: envFlag, Flags: make(map[string]string)}
+    for _, f := range config.Fields {
+        if flag := rootCmd.PersistentFlags().Lookup(f.Name); flag != nil && flag.Changed {
+            opts.Flags[f.Name] = flag.Value.String()
         }
     }
+    return opts
+}
 
-    sort.Strings(migrationFiles)
-
-    for _, file := range migrationFiles {
-        version := strings.TrimSuffix(file, "_migration.sql")
-        applied, err := dbManager.IsMigrationApplied(version)
-        if err != nil {
-            return err
+// addEnvironment adds the connection given to init as a named environment,
+// keeping the rest of an existing config file.
+func addEnvironment(path, name string) config.Config {
+    cfg, err := config.ReadConfig(path)
+    if err != nil {
+        if !os.IsNotExist(err) {
+            log.Fatalf("Failed to load config: %v", err)
         }
-        if applied {
-            log.Printf("Migration %s already applied, skipping", version)
-            continue
+        cfg = config.Config{
+            DBMS:         dbmsFlag,
+            SnapshotDir:  snapshotDir,
+            MigrationDir: migrationDir,
         }
+    }
+    if cfg.Environments == nil {
+        cfg.Environments = make(map[string]config.Environment)
+    }
+    cfg.Environments[name] = config.Environment{
+        DBMS:        dbmsFlag,
+        Connection:  connFlag,
+        Credentials: credsFlags,
+        Schemas:     schemaList(),
+    }
+    return cfg
+}
 
-        script, err := os.ReadFile(filepath.Join(migrationDir, file))
-        if err != nil {
-            return fmt.Errorf("failed to read migration file %s: %v", file, err)
-        }
+// schemaList splits --schemas into the schema names given to init.
+func schemaList() []string {
+    return strings.FieldsFunc(schemasFlag, func(r rune) bool {
+        return r == ',' || r == ' '
+    })
+}
 
-        mig := migration.Migration{
-            Version:  version,
-            UpScript: string(script),
-            Checksum: fmt.Sprintf("%x", sha256.Sum256(script)),
+// warnUnsavedPassword tells the user when a literal password given to init
+// was dropped from the config file and nothing will supply it later.
+func warnUnsavedPassword() {
+    if credsFlags.PasswordFile != "" || passwordEnv != "" {
+        return
+    }
+    if credsFlags.Password == "" {
+        if connFlag == "" {
+            return
         }
-
-        if err := migration.ApplyMigration(dbManager, mig); err != nil {
-            return fmt.Errorf("failed to apply migration %s: %v", version, err)
+        if password, err := adapters.DSNPassword(dbmsFlag, connFlag); err != nil || password == "" {
+            return
         }
+    }
+    log.Println("Warning: the password was not saved to the config file; use --password-file, --password-env or ${VAR} in the connection string")
+}
+
+// authorOrDefault returns --author, or the name of the current user.
+func authorOrDefault() string {
+    if authorFlag != "" {
+        return authorFlag
+    }
+    if u, err := user.Current(); err == nil {
+        return u.Username
+    }
+    return ""
+}
+
+// descriptionOrDefault returns --description, or --name spelled out.
+func descriptionOrDefault() string {
+    if descriptionFlag != "" {
+        return descriptionFlag
+    }
+    return strings.ReplaceAll(nameFlag, "_", " ")
+}
 
-        log.Printf("Migration %s applied successfully", version)
+func pivotOptions() []dbpivot.Option {
+    return []dbpivot.Option{
+        dbpivot.WithStatementTimeout(statementTimeoutFlag),
+        dbpivot.WithLockWait(lockWaitTimeoutFlag, lockRetriesFlag),
+        dbpivot.WithLogger(log.Printf),
     }
+}
 
-    return nil
+// commandContext returns a context that is cancelled on SIGINT or SIGTERM
+// and, when --timeout is set, once the timeout expires. A second signal
+// falls back to the default behaviour and kills the process.
+func commandContext() (context.Context, context.CancelFunc) {
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    go func() {
+        <-ctx.Done()
+        stop()
+    }()
+    if timeoutFlag <= 0 {
+        return ctx, stop
+    }
+    ctx, cancel := context.WithTimeout(ctx, timeoutFlag)
+    return ctx, func() {
+        cancel()
+        stop()
+    }
 }
 
- 
\ No newline at end of file
+func reportInterruption(err error) {
+    var interrupted *dbpivot.InterruptedError
+    if errors.As(err, &interrupted) {
+        log.Printf("Migration %s was interrupted after %d of %d statements; the database may be partially migrated",
+            interrupted.Version, interrupted.Executed, interrupted.Total)
+    }
+}
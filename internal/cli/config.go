@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"db-pivot/internal/config"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var configFormatFlag string
+
+var configCmd = &cobra.Command{
+    Use:   "config",
+    Short: "Inspect the configuration",
+}
+
+var configShowCmd = &cobra.Command{
+    Use:   "show",
+    Short: "Print the effective configuration with passwords redacted",
+    Run: func(cmd *cobra.Command, args []string) {
+        cfg, path, err := config.LoadUnresolved(loadOptions())
+        if err != nil {
+            log.Fatalf("Failed to load config: %v", err)
+        }
+        if resolved, err := cfg.Resolve(); err != nil {
+            log.Printf("Warning: connection cannot be resolved: %v", err)
+        } else {
+            cfg = resolved
+        }
+        data, err := config.Marshal(cfg.Redacted(), configFormatFlag)
+        if err != nil {
+            log.Fatalf("Failed to print config: %v", err)
+        }
+        log.Printf("Config file: %s", path)
+        fmt.Fprint(os.Stdout, string(data))
+        if !strings.HasSuffix(string(data), "\n") {
+            fmt.Fprintln(os.Stdout)
+        }
+    },
+}
+
+func init() {
+    configCmd.AddCommand(configShowCmd)
+    configShowCmd.Flags().StringVarP(&configFormatFlag, "format", "f", "json", "Output format: json, yaml or toml")
+}
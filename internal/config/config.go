@@ -1,33 +1,176 @@
 package config
 
 import (
-	"encoding/json"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
 )
 
 type Config struct {
-    DBMS         string `json:"dbms"`
-    Connection   string `json:"connection"`
-    SnapshotDir  string `json:"snapshotDir"`
-    MigrationDir string `json:"migrationDir"`
+    DBMS       string `json:"dbms"`
+    Connection string `json:"connection,omitempty"`
+    Credentials
+    // Schemas lists the databases to manage when the project spans more
+    // than one. Snapshots and migrations then qualify every object name.
+    Schemas      []string               `json:"schemas,omitempty"`
+    // Include and Exclude select the objects to manage by name, as glob
+    // patterns or /regular expressions/. schema_migrations is always
+    // excluded.
+    Include      []string               `json:"include,omitempty"`
+    Exclude      []string               `json:"exclude,omitempty"`
+    SnapshotDir  string                 `json:"snapshotDir"`
+    MigrationDir string                 `json:"migrationDir"`
+    Environments map[string]Environment `json:"environments,omitempty"`
+    // Online enables online schema changes for large tables.
+    Online *Online `json:"online,omitempty"`
+    // Lint configures the rules of dbpivot lint.
+    Lint *Lint `json:"lint,omitempty"`
 }
 
-func InitConfig(cfg Config) error {
-    data, err := json.MarshalIndent(cfg, "", "  ")
+// Environment is a named database, such as dev, staging or prod. Empty
+// fields fall back to the top-level value of Config.
+type Environment struct {
+    DBMS       string `json:"dbms,omitempty"`
+    Connection string `json:"connection,omitempty"`
+    Credentials
+    Schemas      []string `json:"schemas,omitempty"`
+    SnapshotDir  string   `json:"snapshotDir,omitempty"`
+    MigrationDir string   `json:"migrationDir,omitempty"`
+    Online       *Online  `json:"online,omitempty"`
+}
+
+// ForEnvironment returns the configuration for the named environment with
+// its overrides applied. An empty name returns the top-level configuration.
+func (c Config) ForEnvironment(name string) (Config, error) {
+    if name == "" {
+        return c, nil
+    }
+    env, ok := c.Environments[name]
+    if !ok {
+        return Config{}, fmt.Errorf("unknown environment %q (available: %s)", name, strings.Join(c.EnvironmentNames(), ", "))
+    }
+    resolved := c
+    resolved.Environments = nil
+    if env.DBMS != "" {
+        resolved.DBMS = env.DBMS
+    }
+    if env.Connection != "" {
+        resolved.Connection = env.Connection
+    } else if env.Credentials.formsConnection() {
+        // The environment describes its own database, so the top-level
+        // connection string, which Resolve would prefer, must not leak in.
+        resolved.Connection = ""
+    }
+    resolved.Credentials = c.Credentials.merge(env.Credentials)
+    if len(env.Schemas) > 0 {
+        resolved.Schemas = env.Schemas
+    }
+    if env.SnapshotDir != "" {
+        resolved.SnapshotDir = env.SnapshotDir
+    }
+    if env.MigrationDir != "" {
+        resolved.MigrationDir = env.MigrationDir
+    }
+    if env.Online != nil {
+        resolved.Online = env.Online
+    }
+    return resolved, nil
+}
+
+// EnvironmentNames returns the configured environment names in sorted order.
+func (c Config) EnvironmentNames() []string {
+    names := make([]string, 0, len(c.Environments))
+    for name := range c.Environments {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// InitConfig writes cfg to path, in the format given by its extension.
+// Passwords are never persisted: literal passwords are stripped from the
+// connection string and the Password fields, leaving ${VAR} references and
+// password files in place.
+func InitConfig(path string, cfg Config) error {
+    cfg, err := withoutSecrets(cfg)
     if err != nil {
         return err
     }
-    return os.WriteFile(".schema_manager/config.json", data, 0644)
+    data, err := encode(path, cfg)
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(path, data, 0644)
 }
 
-func LoadConfig() (Config, error) {
-    data, err := os.ReadFile(".schema_manager/config.json")
+// ReadConfig reads the config file at path as written, without selecting an
+// environment, applying overrides or resolving the connection string.
+func ReadConfig(path string) (Config, error) {
+    data, err := os.ReadFile(path)
     if err != nil {
         return Config{}, err
     }
-    var cfg Config
-    if err := json.Unmarshal(data, &cfg); err != nil {
+    return decode(path, data)
+}
+
+// LoadOptions select the config file and what overrides it.
+type LoadOptions struct {
+    // Path is the config file. Empty means Discover from the working directory.
+    Path string
+    // Env is the environment to select; empty means the top level.
+    Env string
+    // Flags are command line overrides keyed by field name (see Fields).
+    Flags map[string]string
+}
+
+// LoadConfig reads the config file, selects the environment and resolves the
+// final connection string. Each field is taken from, in order of
+// precedence, opts.Flags, the DBPIVOT_* environment variables, and the file.
+// Relative paths in the file are relative to the project root, the directory
+// holding .schema_manager, so commands work from any subfolder.
+func LoadConfig(opts LoadOptions) (Config, error) {
+    cfg, _, err := LoadUnresolved(opts)
+    if err != nil {
         return Config{}, err
     }
-    return cfg, nil
-}
\ No newline at end of file
+    return cfg.Resolve()
+}
+
+// LoadUnresolved is like LoadConfig but leaves the connection unresolved and
+// also returns the path of the config file that was read.
+func LoadUnresolved(opts LoadOptions) (Config, string, error) {
+    path := opts.Path
+    if path == "" {
+        path = os.Getenv(EnvPrefix + "CONFIG")
+    }
+    if path == "" {
+        found, err := Discover()
+        if err != nil {
+            return Config{}, "", err
+        }
+        path = found
+    }
+    cfg, err := ReadConfig(path)
+    if err != nil {
+        return Config{}, "", err
+    }
+
+    env := opts.Env
+    if env == "" {
+        env = os.Getenv(EnvPrefix + "ENV")
+    }
+    cfg, err = cfg.ForEnvironment(env)
+    if err != nil {
+        return Config{}, "", err
+    }
+    cfg = cfg.rebase(projectRoot(path))
+
+    if err := cfg.applyEnv(); err != nil {
+        return Config{}, "", err
+    }
+    if err := cfg.applyFlags(opts.Flags); err != nil {
+        return Config{}, "", err
+    }
+    return cfg, path, nil
+}
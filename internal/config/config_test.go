@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestForEnvironmentConnection(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "config.json")
+    data := `{
+        "dbms": "mysql",
+        "connection": "dev@tcp(dev-db:3306)/app",
+        "environments": {
+            "staging": {"connection": "stage@tcp(stage-db:3306)/app"},
+            "prod": {"host": "prod-db", "user": "deploy", "database": "app"},
+            "ci": {"password": "secret"}
+        }
+    }`
+    if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+        t.Fatal(err)
+    }
+    cfg, err := ReadConfig(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        env  string
+        want string
+    }{
+        {"", "dev@tcp(dev-db:3306)/app"},
+        {"staging", "stage@tcp(stage-db:3306)/app"},
+        {"prod", "deploy@tcp(prod-db:3306)/app"},
+        {"ci", "dev:secret@tcp(dev-db:3306)/app"},
+    }
+    for _, tt := range tests {
+        env, err := cfg.ForEnvironment(tt.env)
+        if err != nil {
+            t.Fatalf("ForEnvironment(%q): %v", tt.env, err)
+        }
+        resolved, err := env.Resolve()
+        if err != nil {
+            t.Fatalf("Resolve(%q): %v", tt.env, err)
+        }
+        if resolved.Connection != tt.want {
+            t.Errorf("environment %q connects to %q, want %q", tt.env, resolved.Connection, tt.want)
+        }
+    }
+
+    // An override of one field changes only that part of the connection
+    // string, keeping its parameters.
+    overrides := []struct {
+        name  string
+        flags map[string]string
+        env   map[string]string
+        want  string
+    }{
+        {name: "host", flags: map[string]string{"host": "other-db"}, want: "dev@tcp(other-db:3306)/app?parseTime=true"},
+        {name: "port", flags: map[string]string{"port": "3307"}, want: "dev@tcp(dev-db:3307)/app?parseTime=true"},
+        {name: "user", flags: map[string]string{"user": "admin"}, want: "admin@tcp(dev-db:3306)/app?parseTime=true"},
+        {name: "database from the environment", env: map[string]string{EnvPrefix + "DATABASE": "app_test"}, want: "dev@tcp(dev-db:3306)/app_test?parseTime=true"},
+        {
+            name:  "connection and host",
+            flags: map[string]string{"connection": "ci@tcp(ci-db:3306)/app", "host": "other-db"},
+            want:  "ci@tcp(ci-db:3306)/app",
+        },
+    }
+    for _, tt := range overrides {
+        t.Run(tt.name, func(t *testing.T) {
+            for name, value := range tt.env {
+                t.Setenv(name, value)
+            }
+            cfg := Config{DBMS: "mysql", Connection: "dev@tcp(dev-db:3306)/app?parseTime=true"}
+            if err := cfg.applyEnv(); err != nil {
+                t.Fatal(err)
+            }
+            if err := cfg.applyFlags(tt.flags); err != nil {
+                t.Fatal(err)
+            }
+            resolved, err := cfg.Resolve()
+            if err != nil {
+                t.Fatal(err)
+            }
+            if resolved.Connection != tt.want {
+                t.Errorf("connects to %q, want %q", resolved.Connection, tt.want)
+            }
+        })
+    }
+}
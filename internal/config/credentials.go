@@ -0,0 +1,249 @@
+package config
+
+import (
+	"db-pivot/internal/adapters"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Credentials describe a connection without a full connection string.
+// Every field may reference environment variables as ${NAME}, and the
+// password can be read from PasswordFile instead of being stored.
+type Credentials struct {
+    Host         string `json:"host,omitempty"`
+    Port         int    `json:"port,omitempty"`
+    User         string `json:"user,omitempty"`
+    Password     string `json:"password,omitempty"`
+    PasswordFile string `json:"passwordFile,omitempty"`
+    Database     string `json:"database,omitempty"`
+}
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+func (c Credentials) merge(override Credentials) Credentials {
+    if override.Host != "" {
+        c.Host = override.Host
+    }
+    if override.Port != 0 {
+        c.Port = override.Port
+    }
+    if override.User != "" {
+        c.User = override.User
+    }
+    if override.Password != "" || override.PasswordFile != "" {
+        c.Password = override.Password
+        c.PasswordFile = override.PasswordFile
+    }
+    if override.Database != "" {
+        c.Database = override.Database
+    }
+    return c
+}
+
+// formsConnection tells whether c sets a field that a connection string
+// is built from. The password alone does not, since it is also grafted onto
+// a connection string.
+func (c Credentials) formsConnection() bool {
+    return c.Host != "" || c.Port != 0 || c.User != "" || c.Database != ""
+}
+
+func (c Credentials) isZero() bool {
+    return c == Credentials{}
+}
+
+// Resolve returns cfg with Connection holding the final connection string.
+// ${NAME} references are expanded, the password is taken from Password or
+// PasswordFile, and when Connection is empty it is assembled from the
+// discrete fields. The discrete fields are cleared so that resolving twice
+// is harmless.
+func (c Config) Resolve() (Config, error) {
+    online, err := c.Online.resolve()
+    if err != nil {
+        return Config{}, err
+    }
+    c.Online = online
+    if c.Connection == "" && c.Credentials.isZero() {
+        return c, nil
+    }
+    conn, err := interpolate(c.Connection)
+    if err != nil {
+        return Config{}, fmt.Errorf("connection: %v", err)
+    }
+    creds, err := c.Credentials.interpolate()
+    if err != nil {
+        return Config{}, err
+    }
+    password, err := creds.password()
+    if err != nil {
+        return Config{}, err
+    }
+
+    if conn == "" {
+        conn, err = adapters.BuildDSN(c.DBMS, adapters.ConnParams{
+            Host:     creds.Host,
+            Port:     creds.Port,
+            User:     creds.User,
+            Password: password,
+            Database: creds.Database,
+        })
+        if err != nil {
+            return Config{}, fmt.Errorf("failed to build connection string: %v", err)
+        }
+    } else if password != "" {
+        conn, err = adapters.SetDSNPassword(c.DBMS, conn, password)
+        if err != nil {
+            return Config{}, fmt.Errorf("failed to set connection password: %v", err)
+        }
+    }
+
+    c.Connection = conn
+    c.Credentials = Credentials{}
+    return c, nil
+}
+
+func (c Credentials) interpolate() (Credentials, error) {
+    fields := []struct {
+        name string
+        val  *string
+    }{
+        {"host", &c.Host},
+        {"user", &c.User},
+        {"password", &c.Password},
+        {"passwordFile", &c.PasswordFile},
+        {"database", &c.Database},
+    }
+    for _, f := range fields {
+        expanded, err := interpolate(*f.val)
+        if err != nil {
+            return Credentials{}, fmt.Errorf("%s: %v", f.name, err)
+        }
+        *f.val = expanded
+    }
+    return c, nil
+}
+
+func (c Credentials) password() (string, error) {
+    if c.PasswordFile == "" {
+        return c.Password, nil
+    }
+    data, err := os.ReadFile(c.PasswordFile)
+    if err != nil {
+        return "", fmt.Errorf("failed to read password file: %v", err)
+    }
+    return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// interpolate expands ${NAME} references. Unlike os.ExpandEnv it leaves a
+// bare $ alone, since passwords and DSNs may contain one, and it fails on
+// unset variables instead of silently producing an empty string.
+func interpolate(s string) (string, error) {
+    var missing []string
+    out := envRef.ReplaceAllStringFunc(s, func(ref string) string {
+        name := envRef.FindStringSubmatch(ref)[1]
+        val, ok := os.LookupEnv(name)
+        if !ok {
+            missing = append(missing, name)
+        }
+        return val
+    })
+    if len(missing) > 0 {
+        return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+    }
+    return out, nil
+}
+
+const redacted = "****"
+
+// Redacted returns c with every literal password masked, for display.
+// ${VAR} references are shown as written.
+func (c Config) Redacted() Config {
+    c.Connection = redactDSN(c.DBMS, c.Connection)
+    c.Credentials = c.Credentials.redacted()
+    c.Online = c.Online.redacted(c.DBMS)
+    if c.Environments != nil {
+        envs := make(map[string]Environment, len(c.Environments))
+        for name, env := range c.Environments {
+            dbms := env.DBMS
+            if dbms == "" {
+                dbms = c.DBMS
+            }
+            env.Connection = redactDSN(dbms, env.Connection)
+            env.Credentials = env.Credentials.redacted()
+            env.Online = env.Online.redacted(dbms)
+            envs[name] = env
+        }
+        c.Environments = envs
+    }
+    return c
+}
+
+func (c Credentials) redacted() Credentials {
+    if c.Password != "" && !envRef.MatchString(c.Password) {
+        c.Password = redacted
+    }
+    return c
+}
+
+func redactDSN(dbms, conn string) string {
+    if conn == "" || envRef.MatchString(conn) {
+        return conn
+    }
+    password, err := adapters.DSNPassword(dbms, conn)
+    if err != nil {
+        return redacted
+    }
+    if password == "" {
+        return conn
+    }
+    masked, err := adapters.SetDSNPassword(dbms, conn, redacted)
+    if err != nil {
+        return redacted
+    }
+    return masked
+}
+
+// withoutSecrets drops literal passwords from cfg and its environments.
+func withoutSecrets(cfg Config) (Config, error) {
+    var err error
+    if cfg.Connection, cfg.Credentials, err = stripSecrets(cfg.DBMS, cfg.Connection, cfg.Credentials); err != nil {
+        return Config{}, err
+    }
+    if cfg.Environments != nil {
+        envs := make(map[string]Environment, len(cfg.Environments))
+        for name, env := range cfg.Environments {
+            dbms := env.DBMS
+            if dbms == "" {
+                dbms = cfg.DBMS
+            }
+            if env.Connection, env.Credentials, err = stripSecrets(dbms, env.Connection, env.Credentials); err != nil {
+                return Config{}, fmt.Errorf("environment %s: %v", name, err)
+            }
+            envs[name] = env
+        }
+        cfg.Environments = envs
+    }
+    return cfg, nil
+}
+
+func stripSecrets(dbms, conn string, creds Credentials) (string, Credentials, error) {
+    if !envRef.MatchString(creds.Password) {
+        creds.Password = ""
+    }
+    if conn == "" || envRef.MatchString(conn) {
+        return conn, creds, nil
+    }
+    password, err := adapters.DSNPassword(dbms, conn)
+    if err != nil {
+        return "", Credentials{}, fmt.Errorf("invalid connection string: %v", err)
+    }
+    if password == "" {
+        return conn, creds, nil
+    }
+    conn, err = adapters.SetDSNPassword(dbms, conn, "")
+    if err != nil {
+        return "", Credentials{}, err
+    }
+    return conn, creds, nil
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Dir is the directory, at the project root, that holds the config file.
+const Dir = ".schema_manager"
+
+// DefaultPath is where init writes the config file unless told otherwise.
+var DefaultPath = filepath.Join(Dir, "config.json")
+
+// fileNames are the config file names Discover looks for, in order.
+var fileNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// Discover looks for a config file in .schema_manager of the working
+// directory and then of each parent directory.
+func Discover() (string, error) {
+    wd, err := os.Getwd()
+    if err != nil {
+        return "", err
+    }
+    for dir := wd; ; dir = filepath.Dir(dir) {
+        for _, name := range fileNames {
+            path := filepath.Join(dir, Dir, name)
+            if _, err := os.Stat(path); err == nil {
+                return path, nil
+            }
+        }
+        if filepath.Dir(dir) == dir {
+            break
+        }
+    }
+    return "", fmt.Errorf("no %s/config.{json,yaml,yml,toml} found in %s or any parent directory", Dir, wd)
+}
+
+// projectRoot returns the directory relative paths in the config file at
+// path are resolved against.
+func projectRoot(path string) string {
+    dir := filepath.Dir(path)
+    if filepath.Base(dir) == Dir {
+        return filepath.Dir(dir)
+    }
+    return dir
+}
+
+// rebase makes the relative paths of c relative to root.
+func (c Config) rebase(root string) Config {
+    for _, p := range []*string{&c.SnapshotDir, &c.MigrationDir, &c.PasswordFile} {
+        if *p != "" && !filepath.IsAbs(*p) && !envRef.MatchString(*p) {
+            *p = filepath.Join(root, *p)
+        }
+    }
+    return c
+}
+
+// YAML and TOML are decoded into a generic map and re-encoded as JSON so
+// that the json tags on Config remain the single description of the format.
+func decode(path string, data []byte) (Config, error) {
+    var cfg Config
+    switch ext := strings.ToLower(filepath.Ext(path)); ext {
+    case ".json":
+        if err := json.Unmarshal(data, &cfg); err != nil {
+            return Config{}, fmt.Errorf("%s: %v", path, err)
+        }
+        return cfg, nil
+    case ".yaml", ".yml":
+        var raw map[string]interface{}
+        if err := yaml.Unmarshal(data, &raw); err != nil {
+            return Config{}, fmt.Errorf("%s: %v", path, err)
+        }
+        return fromMap(path, raw)
+    case ".toml":
+        var raw map[string]interface{}
+        if err := toml.Unmarshal(data, &raw); err != nil {
+            return Config{}, fmt.Errorf("%s: %v", path, err)
+        }
+        return fromMap(path, raw)
+    default:
+        return Config{}, fmt.Errorf("%s: unsupported config format %q", path, ext)
+    }
+}
+
+func fromMap(path string, raw map[string]interface{}) (Config, error) {
+    data, err := json.Marshal(raw)
+    if err != nil {
+        return Config{}, fmt.Errorf("%s: %v", path, err)
+    }
+    var cfg Config
+    if err := json.Unmarshal(data, &cfg); err != nil {
+        return Config{}, fmt.Errorf("%s: %v", path, err)
+    }
+    return cfg, nil
+}
+
+func encode(path string, cfg Config) ([]byte, error) {
+    data, err := Marshal(cfg, strings.TrimPrefix(filepath.Ext(path), "."))
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    return data, nil
+}
+
+// Marshal encodes cfg as json, yaml or toml.
+func Marshal(cfg Config, format string) ([]byte, error) {
+    data, err := json.MarshalIndent(cfg, "", "  ")
+    if err != nil {
+        return nil, err
+    }
+    format = strings.ToLower(format)
+    if format == "json" {
+        return data, nil
+    }
+    var raw map[string]interface{}
+    if err := json.Unmarshal(data, &raw); err != nil {
+        return nil, err
+    }
+    raw = integers(raw).(map[string]interface{})
+    switch format {
+    case "yaml", "yml":
+        return yaml.Marshal(raw)
+    case "toml":
+        var buf bytes.Buffer
+        if err := toml.NewEncoder(&buf).Encode(raw); err != nil {
+            return nil, err
+        }
+        return buf.Bytes(), nil
+    default:
+        return nil, fmt.Errorf("unsupported config format %q", format)
+    }
+}
+
+// integers turns the whole float64 values produced by encoding/json back
+// into integers, so that a port is written as 3306 rather than 3306.0.
+func integers(v interface{}) interface{} {
+    switch v := v.(type) {
+    case map[string]interface{}:
+        for k, val := range v {
+            v[k] = integers(val)
+        }
+        return v
+    case float64:
+        if v == math.Trunc(v) {
+            return int64(v)
+        }
+        return v
+    default:
+        return v
+    }
+}
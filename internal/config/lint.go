@@ -0,0 +1,11 @@
+package config
+
+// Lint configures dbpivot lint for the project. Environments share it.
+type Lint struct {
+    // Rules sets the severity of rules by ID: "error", "warning", "info" or
+    // "off". Rules left out keep their default severity.
+    Rules map[string]string `json:"rules,omitempty"`
+    // Since skips the migrations older than this version, such as those
+    // written before the project adopted lint.
+    Since string `json:"since,omitempty"`
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Online configures online schema changes of large MySQL tables. An online
+// ALTER TABLE runs against an empty copy of the table, copies the rows over
+// in chunks while triggers carry new writes across, and swaps the copy in
+// with an atomic RENAME TABLE.
+type Online struct {
+    // ThresholdRows runs every ALTER TABLE of a table estimated to hold at
+    // least this many rows online. Zero leaves it to the migrations whose
+    // header says "-- online: true".
+    ThresholdRows int64 `json:"thresholdRows,omitempty"`
+    // ChunkSize is the number of rows copied by each statement. Zero means
+    // 1000.
+    ChunkSize int `json:"chunkSize,omitempty"`
+    // MaxRowsPerSecond caps the copy rate. Zero means no limit.
+    MaxRowsPerSecond int `json:"maxRowsPerSecond,omitempty"`
+    // Replicas are the connection strings of replicas whose lag throttles
+    // the copy. ${VAR} references are expanded.
+    Replicas []string `json:"replicas,omitempty"`
+    // MaxReplicaLag pauses the copy while a replica is further behind, as
+    // a duration such as "5s". Empty means DefaultMaxReplicaLag.
+    MaxReplicaLag string `json:"maxReplicaLag,omitempty"`
+}
+
+// DefaultMaxReplicaLag is the replica lag at which the copy pauses unless
+// Online.MaxReplicaLag says otherwise.
+const DefaultMaxReplicaLag = 5 * time.Second
+
+// ReplicaLag returns MaxReplicaLag as a duration.
+func (o Online) ReplicaLag() (time.Duration, error) {
+    if o.MaxReplicaLag == "" {
+        return DefaultMaxReplicaLag, nil
+    }
+    lag, err := time.ParseDuration(o.MaxReplicaLag)
+    if err != nil || lag <= 0 {
+        return 0, fmt.Errorf("invalid online.maxReplicaLag %q", o.MaxReplicaLag)
+    }
+    return lag, nil
+}
+
+// resolve expands ${VAR} references in the replica connection strings.
+func (o *Online) resolve() (*Online, error) {
+    if o == nil {
+        return nil, nil
+    }
+    resolved := *o
+    resolved.Replicas = make([]string, len(o.Replicas))
+    for i, conn := range o.Replicas {
+        expanded, err := interpolate(conn)
+        if err != nil {
+            return nil, fmt.Errorf("online.replicas: %v", err)
+        }
+        resolved.Replicas[i] = expanded
+    }
+    return &resolved, nil
+}
+
+// redacted masks the passwords of the replica connection strings.
+func (o *Online) redacted(dbms string) *Online {
+    if o == nil {
+        return nil
+    }
+    masked := *o
+    masked.Replicas = make([]string, len(o.Replicas))
+    for i, conn := range o.Replicas {
+        masked.Replicas[i] = redactDSN(dbms, conn)
+    }
+    return &masked
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"db-pivot/internal/adapters"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix prefixes the environment variables that override the config file.
+const EnvPrefix = "DBPIVOT_"
+
+// Field is a top-level config value that can be overridden from the command
+// line or the environment.
+type Field struct {
+    Name   string // flag name, e.g. "snapshot-dir"
+    EnvVar string // e.g. "DBPIVOT_SNAPSHOT_DIR"
+    set    func(c *Config, value string) error
+}
+
+// Fields lists every overridable config value. The online and lint sections
+// are read from the config file only.
+var Fields = []Field{
+    stringField("dbms", func(c *Config) *string { return &c.DBMS }),
+    stringField("connection", func(c *Config) *string { return &c.Connection }),
+    stringField("host", func(c *Config) *string { return &c.Host }),
+    {Name: "port", EnvVar: EnvPrefix + "PORT", set: func(c *Config, value string) error {
+        port, err := strconv.Atoi(value)
+        if err != nil {
+            return fmt.Errorf("invalid port %q", value)
+        }
+        c.Port = port
+        return nil
+    }},
+    stringField("user", func(c *Config) *string { return &c.User }),
+    stringField("password", func(c *Config) *string { return &c.Password }),
+    stringField("password-file", func(c *Config) *string { return &c.PasswordFile }),
+    stringField("database", func(c *Config) *string { return &c.Database }),
+    listField("schemas", func(c *Config) *[]string { return &c.Schemas }),
+    listField("include", func(c *Config) *[]string { return &c.Include }),
+    listField("exclude", func(c *Config) *[]string { return &c.Exclude }),
+    stringField("snapshot-dir", func(c *Config) *string { return &c.SnapshotDir }),
+    stringField("migration-dir", func(c *Config) *string { return &c.MigrationDir }),
+}
+
+func stringField(name string, ptr func(c *Config) *string) Field {
+    return Field{
+        Name:   name,
+        EnvVar: EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_")),
+        set: func(c *Config, value string) error {
+            *ptr(c) = value
+            return nil
+        },
+    }
+}
+
+// listField is a list given as comma separated values.
+func listField(name string, ptr func(c *Config) *[]string) Field {
+    return Field{
+        Name:   name,
+        EnvVar: EnvPrefix + strings.ToUpper(name),
+        set: func(c *Config, value string) error {
+            *ptr(c) = splitList(value)
+            return nil
+        },
+    }
+}
+
+func (c *Config) applyEnv() error {
+    set := make(map[string]bool)
+    for _, f := range Fields {
+        if value, ok := os.LookupEnv(f.EnvVar); ok {
+            if err := f.set(c, value); err != nil {
+                return fmt.Errorf("%s: %v", f.EnvVar, err)
+            }
+            set[f.Name] = true
+        }
+    }
+    if err := c.overrideConnection(set); err != nil {
+        return fmt.Errorf("connection: %v", err)
+    }
+    return nil
+}
+
+func (c *Config) applyFlags(flags map[string]string) error {
+    set := make(map[string]bool)
+    for _, f := range Fields {
+        if value, ok := flags[f.Name]; ok {
+            if err := f.set(c, value); err != nil {
+                return fmt.Errorf("--%s: %v", f.Name, err)
+            }
+            set[f.Name] = true
+        }
+    }
+    if err := c.overrideConnection(set); err != nil {
+        return fmt.Errorf("connection: %v", err)
+    }
+    return nil
+}
+
+// overrideConnection writes the overrides in set of the fields a
+// connection string is built from into the connection string of a lower
+// layer, since Resolve prefers the connection string and would ignore them.
+// The rest of the connection string, such as its parameters, is kept.
+func (c *Config) overrideConnection(set map[string]bool) error {
+    if set["connection"] || c.Connection == "" {
+        return nil
+    }
+    var params adapters.ConnParams
+    for name := range set {
+        switch name {
+        case "host":
+            params.Host = c.Host
+        case "port":
+            params.Port = c.Port
+        case "user":
+            params.User = c.User
+        case "database":
+            params.Database = c.Database
+        }
+    }
+    if params == (adapters.ConnParams{}) {
+        return nil
+    }
+    conn, err := adapters.SetDSNParams(c.DBMS, c.Connection, params)
+    if err != nil {
+        return err
+    }
+    c.Connection = conn
+    return nil
+}
+
+// splitList splits a comma separated value, dropping empty items.
+func splitList(value string) []string {
+    var items []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
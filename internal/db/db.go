@@ -1,43 +1,130 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"db-pivot/internal/adapters"
+	"db-pivot/internal/filter"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 type DBManager struct {
-    adapter adapters.DBAdapter
+    adapter          adapters.DBAdapter
+    statementTimeout time.Duration
+
+    versionTableUpgraded bool
 }
 
 func NewDBManager(dbms, conn string) (*DBManager, error) {
+    return NewDBManagerContext(context.Background(), dbms, conn)
+}
+
+func NewDBManagerContext(ctx context.Context, dbms, conn string) (*DBManager, error) {
     factory := &adapters.AdapterFactory{}
     adapter := factory.CreateAdapter(dbms, conn)
     if adapter == nil {
         return nil, fmt.Errorf("unsupported DBMS: %s", dbms)
     }
-    if err := adapter.Connect(); err != nil {
+    if err := adapter.ConnectContext(ctx); err != nil {
+        adapter.Close()
         return nil, err
     }
     return &DBManager{adapter: adapter}, nil
 }
 
-func (d *DBManager) InitVersionTable() error {
+// SetStatementTimeout limits how long each statement run through
+// ApplyMigration may take. Zero disables the limit.
+func (d *DBManager) SetStatementTimeout(timeout time.Duration) {
+    d.statementTimeout = timeout
+}
+
+// SetLockWait bounds how long each statement run through ExecStatements
+// waits for metadata locks, and how many times a statement that timed out
+// is retried. A zero timeout keeps the server's lock_wait_timeout.
+func (d *DBManager) SetLockWait(timeout time.Duration, retries int, logf func(format string, args ...interface{})) {
+    d.adapter.SetLockWait(adapters.LockWait{Timeout: timeout, Retries: retries, Logf: logf})
+}
+
+// SetSchemas makes GetSchema and CaptureSnapshot read the listed schemas
+// instead of the one selected by the connection.
+func (d *DBManager) SetSchemas(schemas []string) {
+    d.adapter.SetSchemas(schemas)
+}
+
+// SetFilter leaves the objects f does not keep out of GetSchema and
+// CaptureSnapshot.
+func (d *DBManager) SetFilter(f *filter.Filter) {
+    d.adapter.SetFilter(f)
+}
+
+func (d *DBManager) Close() error {
+    return d.adapter.Close()
+}
+
+func (d *DBManager) InitVersionTable(ctx context.Context) error {
     query := `
         CREATE TABLE IF NOT EXISTS schema_migrations (
             version VARCHAR(50) PRIMARY KEY,
             applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
             description TEXT,
-            checksum VARCHAR(64)
+            checksum VARCHAR(64),
+            name VARCHAR(255),
+            author VARCHAR(255),
+            tags TEXT,
+            no_transaction BOOLEAN NOT NULL DEFAULT FALSE,
+            depends_on TEXT
         )`
-    return d.adapter.ApplyMigration(query)
+    if err := d.adapter.ApplyMigrationContext(ctx, query); err != nil {
+        return err
+    }
+    return d.UpgradeVersionTable(ctx)
+}
+
+// versionColumns are the schema_migrations columns added after the table
+// was first released, with their definitions.
+var versionColumns = []struct{ name, definition string }{
+    {"name", "VARCHAR(255)"},
+    {"author", "VARCHAR(255)"},
+    {"tags", "TEXT"},
+    {"no_transaction", "BOOLEAN NOT NULL DEFAULT FALSE"},
+    {"depends_on", "TEXT"},
+}
+
+// UpgradeVersionTable adds the columns that hold migration metadata to a
+// schema_migrations table created by an older version. It only checks once
+// per DBManager.
+func (d *DBManager) UpgradeVersionTable(ctx context.Context) error {
+    if d.versionTableUpgraded {
+        return nil
+    }
+    for _, col := range versionColumns {
+        var count int
+        err := d.adapter.QueryRowContext(ctx, `
+            SELECT COUNT(*) FROM information_schema.COLUMNS
+            WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'schema_migrations' AND COLUMN_NAME = ?`, col.name).Scan(&count)
+        if err != nil {
+            return fmt.Errorf("failed to inspect schema_migrations: %v", err)
+        }
+        if count > 0 {
+            continue
+        }
+        query := fmt.Sprintf("ALTER TABLE schema_migrations ADD COLUMN %s %s", col.name, col.definition)
+        if err := d.adapter.ApplyMigrationContext(ctx, query); err != nil {
+            return fmt.Errorf("failed to add column %s to schema_migrations: %v", col.name, err)
+        }
+    }
+    d.versionTableUpgraded = true
+    return nil
 }
 
-func (d *DBManager) CaptureSnapshot(snapshotDir string) error {
-    schema, err := d.adapter.GetSchema()
+func (d *DBManager) CaptureSnapshot(ctx context.Context, snapshotDir string) error {
+    schema, err := d.adapter.GetSchemaContext(ctx)
     if err != nil {
         return fmt.Errorf("failed to get schema: %v", err)
     }
@@ -53,34 +140,81 @@ func (d *DBManager) CaptureSnapshot(snapshotDir string) error {
     return nil
 }
 
-func (d *DBManager) GetSchema() (map[string]interface{}, error) {
-    return d.adapter.GetSchema()
+func (d *DBManager) GetSchema(ctx context.Context) (map[string]interface{}, error) {
+    return d.adapter.GetSchemaContext(ctx)
+}
+
+func (d *DBManager) ApplyMigration(ctx context.Context, script string) error {
+    if d.statementTimeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, d.statementTimeout)
+        defer cancel()
+    }
+    return d.adapter.ApplyMigrationContext(ctx, script)
+}
+
+// ExecStatements runs stmts in order on one connection, in a single
+// transaction when inTx is set, with the statement timeout applied to each.
+// It returns how many statements completed.
+func (d *DBManager) ExecStatements(ctx context.Context, stmts []adapters.Statement, inTx bool) (int, error) {
+    return d.adapter.ExecStatementsContext(ctx, stmts, inTx, d.statementTimeout)
+}
+
+func (d *DBManager) BeginTx(ctx context.Context) (*sql.Tx, error) {
+    return d.adapter.BeginTx(ctx, nil)
+}
+
+// QueryRow runs a query expected to return at most one row.
+func (d *DBManager) QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+    return d.adapter.QueryRowContext(ctx, query, args...)
+}
+
+// Query runs a query that returns rows.
+func (d *DBManager) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+    return d.adapter.QueryContext(ctx, query, args...)
 }
 
-func (d *DBManager) ApplyMigration(script string) error {
-    return d.adapter.ApplyMigration(script)
+// TableColumns returns the lower-cased column names of a table in the
+// connection's database. It is empty when the table does not exist.
+func (d *DBManager) TableColumns(ctx context.Context, table string) (map[string]bool, error) {
+    rows, err := d.adapter.QueryContext(ctx, `
+        SELECT COLUMN_NAME FROM information_schema.COLUMNS
+        WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`, table)
+    if err != nil {
+        return nil, fmt.Errorf("failed to inspect %s: %v", table, err)
+    }
+    defer rows.Close()
+    columns := make(map[string]bool)
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil {
+            return nil, fmt.Errorf("failed to inspect %s: %v", table, err)
+        }
+        columns[strings.ToLower(name)] = true
+    }
+    return columns, rows.Err()
 }
 
-func (d *DBManager) IsMigrationApplied(version string) (bool, error) {
+func (d *DBManager) IsMigrationApplied(ctx context.Context, version string) (bool, error) {
     query := `SELECT COUNT(*) FROM schema_migrations WHERE version = ?`
     var count int
-    err := d.adapter.QueryRow(query, version).Scan(&count)
+    err := d.adapter.QueryRowContext(ctx, query, version).Scan(&count)
     if err != nil {
         return false, fmt.Errorf("failed to check if migration %s is applied: %v", version, err)
     }
     return count > 0, nil
 }
 
-func (d *DBManager) GetLastAppliedMigration() (string, error) {
-    query := `SELECT version FROM schema_migrations ORDER BY applied_at DESC LIMIT 1`
+func (d *DBManager) GetLastAppliedMigration(ctx context.Context) (string, error) {
+    query := `SELECT version FROM schema_migrations ORDER BY applied_at DESC, version DESC LIMIT 1`
     var version string
-    row := d.adapter.QueryRow(query)
+    row := d.adapter.QueryRowContext(ctx, query)
     err := row.Scan(&version)
     if err != nil {
-        if err.Error() == "sql: no rows in result set" {
-            return "", nil  
+        if errors.Is(err, sql.ErrNoRows) {
+            return "", nil
         }
         return "", fmt.Errorf("failed to get last applied migration: %v", err)
     }
     return version, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,67 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+)
+
+func tableChecks(table map[string]interface{}) map[string]interface{} {
+	checks, _ := table["checks"].(map[string]interface{})
+	return checks
+}
+
+// checkDefinitions renders the CHECK constraints of a snapshot table as
+// CREATE TABLE clauses, sorted by name.
+func checkDefinitions(table map[string]interface{}) []string {
+	checks := tableChecks(table)
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defs := make([]string, 0, len(names))
+	for _, name := range names {
+		defs = append(defs, fmt.Sprintf("CONSTRAINT %s %v", name, checks[name]))
+	}
+	return defs
+}
+
+func compareChecks(table string, prevTable, currTable map[string]interface{}) []Change {
+	var changes []Change
+	prevChecks, currChecks := tableChecks(prevTable), tableChecks(currTable)
+
+	for name, currDef := range currChecks {
+		after := fmt.Sprintf("%v", currDef)
+		prevDef, exists := prevChecks[name]
+		if !exists {
+			changes = append(changes, Change{
+				Type:   "add",
+				Object: fmt.Sprintf("check:%s.%s", table, name),
+				Detail: after,
+				After:  after,
+			})
+		} else if before := fmt.Sprintf("%v", prevDef); before != after {
+			changes = append(changes, Change{
+				Type:   "modify",
+				Object: fmt.Sprintf("check:%s.%s", table, name),
+				Detail: fmt.Sprintf("%s from %s", after, before),
+				Before: before,
+				After:  after,
+			})
+		}
+	}
+
+	for name, prevDef := range prevChecks {
+		if _, exists := currChecks[name]; !exists {
+			changes = append(changes, Change{
+				Type:   "remove",
+				Object: fmt.Sprintf("check:%s.%s", table, name),
+				Detail: "check removed",
+				Before: fmt.Sprintf("%v", prevDef),
+			})
+		}
+	}
+
+	return changes
+}
@@ -1,72 +1,110 @@
 package diff
 
 import (
+	"db-pivot/internal/filter"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 )
 
 type Change struct {
 	Type   string // "add", "remove", "modify"
-	Object string // Ex.: "table:users", "column:users.id"
+	Object string // Ex.: "table:users", "column:users.id", "view:active_users", "table:billing.invoices"
 	Detail string // Ex.: "id INT AUTO_INCREMENT NOT NULL, nome VARCHAR(100) NULL"
+	Before string // Statement that recreates the previous object, for objects such as views
+	After  string // Statement that creates the new object, for objects such as views
+
+	// Warning is set for changes that lose data when applied, such as
+	// dropping a partition.
+	Warning string
 }
 
 type DiffStrategy interface {
 	Compare(prev, curr map[string]interface{}) ([]Change, error)
 }
 
-type DefaultDiffStrategy struct{}
+type DefaultDiffStrategy struct {
+	// Filter leaves out objects on either side that it does not keep, so
+	// that objects excluded after a snapshot was taken are not reported as
+	// removed. Nil compares everything.
+	Filter *filter.Filter
+}
 
 func (d *DefaultDiffStrategy) Compare(prev, curr map[string]interface{}) ([]Change, error) {
 	var changes []Change
+	prev, curr = d.Filter.Apply(prev), d.Filter.Apply(curr)
 
  	 for table, tableData := range curr {
-		if _, exists := prev[table]; !exists {
+		if !isTable(tableData) {
+			continue
+		}
+		if prevData, exists := prev[table]; !exists || !isTable(prevData) {
 		 	tableMap := tableData.(map[string]interface{})
 			columns, ok := tableMap["columns"].(map[string]interface{})
 			if !ok {
 				return nil, fmt.Errorf("schema inválido para a tabela %s", table)
 			}
 			var colDefs []string
-			for colName, colData := range columns {
-				colMap := colData.(map[string]interface{})
-				nullStr := "NOT NULL"
-				if colMap["null"].(bool) {
-					nullStr = "NULL"
-				}
-			 	colDef := fmt.Sprintf("%s %s %s", colName, colMap["type"], nullStr)
+			for _, colName := range ColumnOrder(columns) {
+				colMap := columns[colName].(map[string]interface{})
+			 	colDef := fmt.Sprintf("%s %s", colName, columnDefinition(colMap, tableCollation(tableMap)))
 				colDefs = append(colDefs, colDef)
 			}
+			colDefs = append(colDefs, indexDefinitions(tableMap)...)
+			colDefs = append(colDefs, checkDefinitions(tableMap)...)
 			detail := strings.Join(colDefs, ",\n")
 			changes = append(changes, Change{
 				Type:   "add",
 				Object: fmt.Sprintf("table:%s", table),
 				Detail: detail,
+				After:  strings.TrimSpace(TableOptions(tableMap) + " " + PartitionClause(tableMap)),
 			})
+			// Foreign keys are added once every new table exists, so that
+			// tables can be created in any order.
+			changes = append(changes, addForeignKeys(table, tableMap)...)
 		} else {
 		 	prevTable := prev[table].(map[string]interface{})
 			currTable := tableData.(map[string]interface{})
 			prevCols := prevTable["columns"].(map[string]interface{})
 			currCols := currTable["columns"].(map[string]interface{})
-			changes = append(changes, compareColumns(table, prevCols, currCols)...)
+			changes = append(changes, compareColumns(table, prevTable, currTable, prevCols, currCols)...)
+			changes = append(changes, compareChecks(table, prevTable, currTable)...)
+			changes = append(changes, compareIndexes(table, prevTable, currTable)...)
+			changes = append(changes, compareForeignKeys(table, prevTable, currTable)...)
+			changes = append(changes, compareTableOptions(table, prevTable, currTable)...)
+			changes = append(changes, comparePartitioning(table, prevTable, currTable)...)
 		}
 	}
 
-	 for table := range prev {
-		if _, exists := curr[table]; !exists {
+	 for table, tableData := range prev {
+		if !isTable(tableData) {
+			continue
+		}
+		if currData, exists := curr[table]; !exists || !isTable(currData) {
 			changes = append(changes, Change{
 				Type:   "remove",
 				Object: fmt.Sprintf("table:%s", table),
 				Detail: "table removed",
 			})
+			// Dropping the foreign keys first lets tables that reference
+			// each other be dropped in any order.
+			changes = append(changes, dropForeignKeys(table, tableData.(map[string]interface{}))...)
 		}
 	}
 
-	return changes, nil
+	changes = append(changes, compareViews(prev, curr)...)
+	changes = append(changes, compareRoutines(prev, curr)...)
+
+	return orderChanges(changes, prev, curr), nil
 }
 
-func compareColumns(table string, prevCols, currCols map[string]interface{}) []Change {
+func compareColumns(table string, prevTable, currTable, prevCols, currCols map[string]interface{}) []Change {
 	var changes []Change
+	prevCollation, currCollation := tableCollation(prevTable), tableCollation(currTable)
+	// Snapshots taken before table options were captured know nothing of
+	// column charsets and comments, so those are not compared.
+	legacy := !hasTableOptions(prevTable)
 
  	for colName, currCol := range currCols {
 		currDetail := currCol.(map[string]interface{})
@@ -79,10 +117,22 @@ func compareColumns(table string, prevCols, currCols map[string]interface{}) []C
 				Type:   "add",
 				Object: fmt.Sprintf("column:%s.%s", table, colName),
 				Detail: fmt.Sprintf("type %s%s", currDetail["type"], nullStr),
+				After:  columnDefinition(currDetail, currCollation),
 			})
 		} else {
 			prevDetail := prevCol.(map[string]interface{})
-			if prevDetail["type"] != currDetail["type"] || prevDetail["null"] != currDetail["null"] {
+			before := columnDefinition(prevDetail, prevCollation)
+			compared := currDetail
+			if legacy {
+				compared = withoutTableOptions(compared)
+			}
+			// Snapshots taken before defaults were rendered have no
+			// default_sql, so defaults are not compared either.
+			if _, ok := prevDetail["default_sql"]; !ok {
+				compared = withoutKeys(compared, "default_sql")
+			}
+			after := columnDefinition(compared, currCollation)
+			if before != after {
 				currNullStr := ""
 				if currDetail["null"].(bool) {
 					currNullStr = " NULL"
@@ -95,20 +145,102 @@ func compareColumns(table string, prevCols, currCols map[string]interface{}) []C
 					Type:   "modify",
 					Object: fmt.Sprintf("column:%s.%s", table, colName),
 					Detail: fmt.Sprintf("type %s%s from %s%s", currDetail["type"], currNullStr, prevDetail["type"], prevNullStr),
+					Before: before,
+					After:  columnDefinition(currDetail, currCollation),
 				})
 			}
 		}
 	}
  
-	for colName := range prevCols {
+	for colName, prevCol := range prevCols {
 		if _, exists := currCols[colName]; !exists {
 			changes = append(changes, Change{
 				Type:   "remove",
 				Object: fmt.Sprintf("column:%s.%s", table, colName),
 				Detail: "column removed",
+				Before: columnDefinition(prevCol.(map[string]interface{}), prevCollation),
 			})
 		}
 	}
 
 	return changes
 }
+
+var onUpdate = regexp.MustCompile(`(?i)on update (\S+)`)
+
+// ColumnDefinition renders a snapshot column as it appears after the column
+// name in CREATE TABLE and ALTER TABLE, e.g.
+// "decimal(10,2) GENERATED ALWAYS AS ((price * qty)) STORED NOT NULL".
+func ColumnDefinition(col map[string]interface{}) string {
+	return columnDefinition(col, "")
+}
+
+// columnDefinition is ColumnDefinition leaving out the column collation
+// when it is the table default, which the column inherits anyway.
+func columnDefinition(col map[string]interface{}, tableCollation string) string {
+	def := fmt.Sprintf("%v", col["type"])
+	if collation, _ := col["collation"].(string); collation != "" && collation != tableCollation {
+		def += fmt.Sprintf(" CHARACTER SET %v COLLATE %s", col["charset"], collation)
+	}
+	if expr, _ := col["generated"].(string); expr != "" {
+		storage, _ := col["storage"].(string)
+		if storage == "" {
+			storage = "VIRTUAL"
+		}
+		def += fmt.Sprintf(" GENERATED ALWAYS AS (%s) %s", expr, storage)
+	}
+	if null, _ := col["null"].(bool); null {
+		def += " NULL"
+	} else {
+		def += " NOT NULL"
+	}
+	if defaultSQL, _ := col["default_sql"].(string); defaultSQL != "" {
+		def += " DEFAULT " + defaultSQL
+	}
+	extra, _ := col["extra"].(string)
+	if m := onUpdate.FindStringSubmatch(extra); m != nil {
+		def += " ON UPDATE " + strings.ToUpper(m[1])
+	}
+	if strings.Contains(strings.ToLower(extra), "auto_increment") {
+		def += " AUTO_INCREMENT"
+	}
+	if comment, _ := col["comment"].(string); comment != "" {
+		def += " COMMENT " + quote(comment)
+	}
+	return def
+}
+
+// ColumnOrder returns the column names of a table in the order they were
+// defined. Snapshots taken before positions were captured are sorted by
+// name instead.
+func ColumnOrder(columns map[string]interface{}) []string {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	position := func(name string) float64 {
+		pos, _ := toFloat(columns[name].(map[string]interface{})["position"])
+		return pos
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if pi, pj := position(names[i]), position(names[j]); pi != pj {
+			return pi < pj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// toFloat reads a number that is an int when the snapshot was just read
+// and a float64 when it was loaded from JSON.
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
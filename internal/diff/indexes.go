@@ -0,0 +1,170 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func tableIndexes(table map[string]interface{}) map[string]interface{} {
+	indexes, _ := table["indexes"].(map[string]interface{})
+	return indexes
+}
+
+func tableForeignKeys(table map[string]interface{}) map[string]interface{} {
+	keys, _ := table["foreign_keys"].(map[string]interface{})
+	return keys
+}
+
+// stringList reads a list of strings from a snapshot, which holds
+// []interface{} whether it was just read or loaded from JSON.
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		list = append(list, fmt.Sprint(item))
+	}
+	return list
+}
+
+// IndexDefinition renders a snapshot index as a CREATE TABLE clause, e.g.
+// "UNIQUE KEY idx_users_email (email)". The primary key is named PRIMARY.
+func IndexDefinition(name string, index map[string]interface{}) string {
+	parts := strings.Join(stringList(index["columns"]), ", ")
+	if name == "PRIMARY" {
+		return fmt.Sprintf("PRIMARY KEY (%s)", parts)
+	}
+	kind := "KEY"
+	switch indexType, _ := index["type"].(string); {
+	case indexType == "FULLTEXT" || indexType == "SPATIAL":
+		kind = indexType + " KEY"
+	case index["unique"] == true:
+		kind = "UNIQUE KEY"
+	}
+	return fmt.Sprintf("%s %s (%s)", kind, name, parts)
+}
+
+// ForeignKeyDefinition renders a snapshot foreign key as a CREATE TABLE
+// clause. RESTRICT and NO ACTION, the defaults, are left out.
+func ForeignKeyDefinition(name string, fk map[string]interface{}) string {
+	def := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %v (%s)", name,
+		strings.Join(stringList(fk["columns"]), ", "), fk["references"],
+		strings.Join(stringList(fk["referenced_columns"]), ", "))
+	for _, rule := range []struct{ key, clause string }{{"on_delete", "ON DELETE"}, {"on_update", "ON UPDATE"}} {
+		switch action, _ := fk[rule.key].(string); action {
+		case "", "RESTRICT", "NO ACTION":
+		default:
+			def += " " + rule.clause + " " + action
+		}
+	}
+	return def
+}
+
+// indexDefinitions renders the indexes of a snapshot table as CREATE TABLE
+// clauses, the primary key first and the rest by name.
+func indexDefinitions(table map[string]interface{}) []string {
+	indexes := tableIndexes(table)
+	defs := make([]string, 0, len(indexes))
+	for _, name := range sortedIndexNames(indexes) {
+		defs = append(defs, IndexDefinition(name, indexes[name].(map[string]interface{})))
+	}
+	return defs
+}
+
+// ForeignKeyDefinitions renders the foreign keys of a snapshot table,
+// sorted by name.
+func ForeignKeyDefinitions(table map[string]interface{}) []string {
+	keys := tableForeignKeys(table)
+	defs := make([]string, 0, len(keys))
+	for _, name := range sortedIndexNames(keys) {
+		defs = append(defs, ForeignKeyDefinition(name, keys[name].(map[string]interface{})))
+	}
+	return defs
+}
+
+func sortedIndexNames(m map[string]interface{}) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == "PRIMARY") != (names[j] == "PRIMARY") {
+			return names[i] == "PRIMARY"
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// compareIndexes reports added, removed and changed indexes. Snapshots
+// taken before indexes were captured have none to compare.
+func compareIndexes(table string, prevTable, currTable map[string]interface{}) []Change {
+	if _, captured := prevTable["indexes"]; !captured {
+		return nil
+	}
+	return compareKeyed(table, "index", tableIndexes(prevTable), tableIndexes(currTable), IndexDefinition)
+}
+
+// compareForeignKeys reports added and removed foreign keys. A changed
+// foreign key is dropped and added again, so that the columns it uses can
+// change in between.
+func compareForeignKeys(table string, prevTable, currTable map[string]interface{}) []Change {
+	if _, captured := prevTable["foreign_keys"]; !captured {
+		return nil
+	}
+	var changes []Change
+	for _, c := range compareKeyed(table, "foreign_key", tableForeignKeys(prevTable), tableForeignKeys(currTable), ForeignKeyDefinition) {
+		if c.Type != "modify" {
+			changes = append(changes, c)
+			continue
+		}
+		changes = append(changes,
+			Change{Type: "remove", Object: c.Object, Detail: c.Before, Before: c.Before},
+			Change{Type: "add", Object: c.Object, Detail: c.After, After: c.After})
+	}
+	return changes
+}
+
+func compareKeyed(table, kind string, prev, curr map[string]interface{}, define func(string, map[string]interface{}) string) []Change {
+	var changes []Change
+	for name, data := range curr {
+		after := define(name, data.(map[string]interface{}))
+		object := fmt.Sprintf("%s:%s.%s", kind, table, name)
+		prevData, exists := prev[name]
+		if !exists {
+			changes = append(changes, Change{Type: "add", Object: object, Detail: after, After: after})
+			continue
+		}
+		if before := define(name, prevData.(map[string]interface{})); before != after {
+			changes = append(changes, Change{
+				Type:   "modify",
+				Object: object,
+				Detail: fmt.Sprintf("%s from %s", after, before),
+				Before: before,
+				After:  after,
+			})
+		}
+	}
+	for name, data := range prev {
+		if _, exists := curr[name]; !exists {
+			before := define(name, data.(map[string]interface{}))
+			changes = append(changes, Change{
+				Type:   "remove",
+				Object: fmt.Sprintf("%s:%s.%s", kind, table, name),
+				Detail: before,
+				Before: before,
+			})
+		}
+	}
+	return changes
+}
+
+// addForeignKeys adds the foreign keys of a new table.
+func addForeignKeys(table string, tableMap map[string]interface{}) []Change {
+	return compareKeyed(table, "foreign_key", nil, tableForeignKeys(tableMap), ForeignKeyDefinition)
+}
+
+// dropForeignKeys drops the foreign keys of a removed table.
+func dropForeignKeys(table string, tableMap map[string]interface{}) []Change {
+	return compareKeyed(table, "foreign_key", tableForeignKeys(tableMap), nil, ForeignKeyDefinition)
+}
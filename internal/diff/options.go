@@ -0,0 +1,111 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+func tableOptions(table map[string]interface{}) map[string]interface{} {
+	options, _ := table["options"].(map[string]interface{})
+	return options
+}
+
+func hasTableOptions(table map[string]interface{}) bool {
+	return tableOptions(table) != nil
+}
+
+func tableCollation(table map[string]interface{}) string {
+	collation, _ := tableOptions(table)["collation"].(string)
+	return collation
+}
+
+func withoutTableOptions(col map[string]interface{}) map[string]interface{} {
+	return withoutKeys(col, "charset", "collation", "comment")
+}
+
+func withoutKeys(col map[string]interface{}, keys ...string) map[string]interface{} {
+	stripped := make(map[string]interface{}, len(col))
+	for k, v := range col {
+		stripped[k] = v
+	}
+	for _, k := range keys {
+		delete(stripped, k)
+	}
+	return stripped
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// TableOptions renders the options of a snapshot table as they follow the
+// closing parenthesis of CREATE TABLE. It is empty for snapshots taken
+// before table options were captured.
+func TableOptions(table map[string]interface{}) string {
+	options := tableOptions(table)
+	if options == nil {
+		return ""
+	}
+	var parts []string
+	if engine, _ := options["engine"].(string); engine != "" {
+		parts = append(parts, "ENGINE="+engine)
+	}
+	if charset, _ := options["charset"].(string); charset != "" {
+		parts = append(parts, "DEFAULT CHARSET="+charset)
+	}
+	if collation, _ := options["collation"].(string); collation != "" {
+		parts = append(parts, "COLLATE="+collation)
+	}
+	if rowFormat, _ := options["rowFormat"].(string); rowFormat != "" {
+		parts = append(parts, "ROW_FORMAT="+rowFormat)
+	}
+	if comment, _ := options["comment"].(string); comment != "" {
+		parts = append(parts, "COMMENT="+quote(comment))
+	}
+	return strings.Join(parts, " ")
+}
+
+// tableOptionClauses render each option as the ALTER TABLE clause that sets
+// it. Charset and collation change together through CONVERT TO, which also
+// converts every column that uses the table default.
+var tableOptionClauses = []struct {
+	name   string
+	clause func(options map[string]interface{}) string
+}{
+	{"engine", func(o map[string]interface{}) string {
+		return fmt.Sprintf("ENGINE=%v", o["engine"])
+	}},
+	{"charset", func(o map[string]interface{}) string {
+		return fmt.Sprintf("CONVERT TO CHARACTER SET %v COLLATE %v", o["charset"], o["collation"])
+	}},
+	{"rowFormat", func(o map[string]interface{}) string {
+		return fmt.Sprintf("ROW_FORMAT=%v", o["rowFormat"])
+	}},
+	{"comment", func(o map[string]interface{}) string {
+		comment, _ := o["comment"].(string)
+		return "COMMENT=" + quote(comment)
+	}},
+}
+
+func compareTableOptions(table string, prevTable, currTable map[string]interface{}) []Change {
+	prevOpts, currOpts := tableOptions(prevTable), tableOptions(currTable)
+	if prevOpts == nil || currOpts == nil {
+		return nil
+	}
+
+	var changes []Change
+	for _, opt := range tableOptionClauses {
+		before, after := opt.clause(prevOpts), opt.clause(currOpts)
+		if before == after {
+			continue
+		}
+		changes = append(changes, Change{
+			Type:   "modify",
+			Object: fmt.Sprintf("option:%s.%s", table, opt.name),
+			Detail: fmt.Sprintf("%s from %s", after, before),
+			Before: before,
+			After:  after,
+		})
+	}
+	return changes
+}
@@ -0,0 +1,254 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+func tablePartitioning(table map[string]interface{}) map[string]interface{} {
+	scheme, _ := table["partitioning"].(map[string]interface{})
+	return scheme
+}
+
+type partition struct {
+	name   string
+	values string
+}
+
+func partitionList(scheme map[string]interface{}) []partition {
+	raw, _ := scheme["partitions"].([]interface{})
+	parts := make([]partition, 0, len(raw))
+	for _, p := range raw {
+		pm, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := pm["name"].(string)
+		values, _ := pm["values"].(string)
+		parts = append(parts, partition{name: name, values: values})
+	}
+	return parts
+}
+
+func partitionMethod(scheme map[string]interface{}) string {
+	method, _ := scheme["method"].(string)
+	return strings.ToUpper(method)
+}
+
+// definesPartitions reports whether each partition of method is declared
+// with its own bounds. HASH and KEY tables only declare how many there are.
+func definesPartitions(method string) bool {
+	return strings.HasPrefix(method, "RANGE") || strings.HasPrefix(method, "LIST")
+}
+
+func partitionDefinition(method string, p partition) string {
+	switch {
+	case strings.HasPrefix(method, "RANGE"):
+		values := p.values
+		if values != "MAXVALUE" {
+			values = "(" + values + ")"
+		}
+		return fmt.Sprintf("PARTITION %s VALUES LESS THAN %s", p.name, values)
+	case strings.HasPrefix(method, "LIST"):
+		return fmt.Sprintf("PARTITION %s VALUES IN (%s)", p.name, p.values)
+	}
+	return "PARTITION " + p.name
+}
+
+func partitionDefinitions(method string, parts []partition) string {
+	defs := make([]string, len(parts))
+	for i, p := range parts {
+		defs[i] = partitionDefinition(method, p)
+	}
+	return strings.Join(defs, ", ")
+}
+
+// PartitionClause renders the PARTITION BY clause of a snapshot table as it
+// follows the table options of CREATE TABLE. It is empty for tables that are
+// not partitioned.
+func PartitionClause(table map[string]interface{}) string {
+	scheme := tablePartitioning(table)
+	if scheme == nil {
+		return ""
+	}
+	method := partitionMethod(scheme)
+	parts := partitionList(scheme)
+	clause := fmt.Sprintf("PARTITION BY %s (%v)", method, scheme["expression"])
+	if strings.HasSuffix(method, "COLUMNS") {
+		clause = fmt.Sprintf("PARTITION BY %s(%v)", method, scheme["expression"])
+	}
+	if definesPartitions(method) {
+		return fmt.Sprintf("%s (%s)", clause, partitionDefinitions(method, parts))
+	}
+	return fmt.Sprintf("%s PARTITIONS %d", clause, len(parts))
+}
+
+var partitionName = regexp.MustCompile(`PARTITION (\S+)`)
+
+// PartitionNames returns the partition names declared in a list of partition
+// definitions such as the Before and After of a reorganized partition.
+func PartitionNames(defs string) []string {
+	var names []string
+	for _, m := range partitionName.FindAllStringSubmatch(defs, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// comparePartitioning reports a changed partitioning scheme as a single
+// "partitioning:" change that repartitions the table. When only the
+// partitions of a RANGE or LIST table differ, partitions are added and
+// dropped individually where possible and reorganized otherwise.
+func comparePartitioning(table string, prevTable, currTable map[string]interface{}) []Change {
+	prevScheme, currScheme := tablePartitioning(prevTable), tablePartitioning(currTable)
+	if prevScheme == nil && currScheme == nil {
+		return nil
+	}
+	if prevScheme == nil || currScheme == nil ||
+		partitionMethod(prevScheme) != partitionMethod(currScheme) ||
+		prevScheme["expression"] != currScheme["expression"] ||
+		!definesPartitions(partitionMethod(currScheme)) {
+		before, after := PartitionClause(prevTable), PartitionClause(currTable)
+		if before == after {
+			return nil
+		}
+		return []Change{{
+			Type:   "modify",
+			Object: fmt.Sprintf("partitioning:%s", table),
+			Detail: fmt.Sprintf("partitioning changed to %q", after),
+			Before: before,
+			After:  after,
+		}}
+	}
+	return comparePartitions(table, partitionMethod(currScheme), partitionList(prevScheme), partitionList(currScheme))
+}
+
+func comparePartitions(table, method string, prev, curr []partition) []Change {
+	prevByName := make(map[string]partition, len(prev))
+	for _, p := range prev {
+		prevByName[p.name] = p
+	}
+	currByName := make(map[string]partition, len(curr))
+	for _, p := range curr {
+		currByName[p.name] = p
+	}
+
+	// Partitions can be dropped and added in place as long as the ones kept
+	// are unchanged. A RANGE table only accepts new partitions at the end.
+	inPlace := true
+	lastKept := -1
+	for i, p := range curr {
+		old, exists := prevByName[p.name]
+		if !exists {
+			continue
+		}
+		if old.values != p.values {
+			inPlace = false
+		}
+		lastKept = i
+	}
+	if inPlace && strings.HasPrefix(method, "RANGE") {
+		for i, p := range curr {
+			if _, exists := prevByName[p.name]; !exists && i < lastKept {
+				inPlace = false
+			}
+		}
+	}
+
+	var changes []Change
+	if inPlace {
+		if drop := dropPartitions(table, method, prev, currByName); drop != nil {
+			changes = append(changes, *drop)
+		}
+		// New partitions are added in one change to keep their order.
+		var added []partition
+		var names []string
+		for _, p := range curr {
+			if _, exists := prevByName[p.name]; !exists {
+				added = append(added, p)
+				names = append(names, p.name)
+			}
+		}
+		if added != nil {
+			changes = append(changes, Change{
+				Type:   "add",
+				Object: fmt.Sprintf("partition:%s.%s", table, strings.Join(names, ",")),
+				Detail: fmt.Sprintf("partitions %s added", strings.Join(names, ", ")),
+				After:  partitionDefinitions(method, added),
+			})
+		}
+		return changes
+	}
+
+	// Reorganize the smallest run of partitions that covers every difference.
+	start := 0
+	for start < len(prev) && start < len(curr) && prev[start] == curr[start] {
+		start++
+	}
+	prevEnd, currEnd := len(prev), len(curr)
+	for prevEnd > start && currEnd > start && prev[prevEnd-1] == curr[currEnd-1] {
+		prevEnd--
+		currEnd--
+	}
+	if prevEnd == start && prevEnd < len(prev) {
+		// REORGANIZE needs at least one existing partition to split.
+		prevEnd++
+		currEnd++
+	}
+	from, into := prev[start:prevEnd], curr[start:currEnd]
+	names := make([]string, len(from))
+	for i, p := range from {
+		names[i] = p.name
+	}
+	return []Change{{
+		Type:   "modify",
+		Object: fmt.Sprintf("partition:%s.%s", table, strings.Join(names, ",")),
+		Detail: fmt.Sprintf("partitions %s reorganized", strings.Join(names, ", ")),
+		Before: partitionDefinitions(method, from),
+		After:  partitionDefinitions(method, into),
+	}}
+}
+
+// dropPartitions drops every partition of prev missing from curr in one
+// change. Before holds what undoing it must recreate: the dropped RANGE
+// partitions together with the partitions that took over their ranges, or
+// just the dropped partitions when those were last or the table is a LIST.
+func dropPartitions(table, method string, prev []partition, curr map[string]partition) *Change {
+	var names []string
+	first, last := -1, -1
+	for i, p := range prev {
+		if _, exists := curr[p.name]; !exists {
+			names = append(names, p.name)
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if names == nil {
+		return nil
+	}
+
+	var restore []partition
+	if strings.HasPrefix(method, "RANGE") {
+		end := last + 1
+		if end < len(prev) {
+			end++
+		}
+		restore = prev[first:end]
+	} else {
+		for _, p := range prev {
+			if _, exists := curr[p.name]; !exists {
+				restore = append(restore, p)
+			}
+		}
+	}
+	return &Change{
+		Type:    "remove",
+		Object:  fmt.Sprintf("partition:%s.%s", table, strings.Join(names, ",")),
+		Detail:  fmt.Sprintf("partitions %s removed", strings.Join(names, ", ")),
+		Before:  partitionDefinitions(method, restore),
+		Warning: fmt.Sprintf("dropping partitions %s of %s deletes the rows stored in them", strings.Join(names, ", "), table),
+	}
+}
@@ -0,0 +1,69 @@
+package diff
+
+import "fmt"
+
+// isRoutine reports whether a snapshot entry is a stored procedure, function
+// or trigger. Their snapshot keys already carry the kind, e.g.
+// "procedure:refresh_totals", and are used as the change object as is.
+func isRoutine(data interface{}) bool {
+	switch objectKind(data) {
+	case "procedure", "function", "trigger":
+		return true
+	}
+	return false
+}
+
+func compareRoutines(prev, curr map[string]interface{}) []Change {
+	var changes []Change
+
+	for key, data := range curr {
+		if !isRoutine(data) {
+			continue
+		}
+		currObj := data.(map[string]interface{})
+		kind := objectKind(data)
+		after := fmt.Sprintf("%v", currObj["create"])
+		prevData, exists := prev[key]
+		if !exists || objectKind(prevData) != kind {
+			changes = append(changes, Change{
+				Type:   "add",
+				Object: key,
+				Detail: fmt.Sprintf("%s added", kind),
+				After:  after,
+			})
+			continue
+		}
+		prevObj := prevData.(map[string]interface{})
+		before := fmt.Sprintf("%v", prevObj["create"])
+		if before == after {
+			continue
+		}
+		detail := fmt.Sprintf("%s definition changed", kind)
+		if fmt.Sprint(prevObj["body"]) != fmt.Sprint(currObj["body"]) {
+			detail = fmt.Sprintf("%s body changed", kind)
+		}
+		changes = append(changes, Change{
+			Type:   "modify",
+			Object: key,
+			Detail: detail,
+			Before: before,
+			After:  after,
+		})
+	}
+
+	for key, data := range prev {
+		if !isRoutine(data) {
+			continue
+		}
+		if currData, exists := curr[key]; !exists || objectKind(currData) != objectKind(data) {
+			changes = append(changes, Change{
+				Type:   "remove",
+				Object: key,
+				Detail: fmt.Sprintf("%s removed", objectKind(data)),
+				Before: fmt.Sprintf("%v", data.(map[string]interface{})["create"]),
+			})
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,242 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// objectKind returns the kind of a snapshot entry. Tables predate the
+// "type" field and are the default.
+func objectKind(data interface{}) string {
+	obj, ok := data.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if kind, ok := obj["type"].(string); ok && kind != "" {
+		return kind
+	}
+	return "table"
+}
+
+func isTable(data interface{}) bool {
+	return objectKind(data) == "table"
+}
+
+func isView(data interface{}) bool {
+	return objectKind(data) == "view"
+}
+
+// ViewStatement renders the CREATE OR REPLACE VIEW statement for a view
+// captured in a snapshot.
+func ViewStatement(name string, view map[string]interface{}) string {
+	var b strings.Builder
+	b.WriteString("CREATE OR REPLACE ")
+	if security, _ := view["securityType"].(string); strings.EqualFold(security, "INVOKER") {
+		b.WriteString("SQL SECURITY INVOKER ")
+	}
+	fmt.Fprintf(&b, "VIEW %s AS %s", name, view["definition"])
+	if check, _ := view["checkOption"].(string); check != "" && !strings.EqualFold(check, "NONE") {
+		fmt.Fprintf(&b, " WITH %s CHECK OPTION", strings.ToUpper(check))
+	}
+	return b.String()
+}
+
+func compareViews(prev, curr map[string]interface{}) []Change {
+	var changes []Change
+
+	for name, data := range curr {
+		if !isView(data) {
+			continue
+		}
+		currView := data.(map[string]interface{})
+		after := ViewStatement(name, currView)
+		prevData, exists := prev[name]
+		switch {
+		case !exists || !isView(prevData):
+			changes = append(changes, Change{
+				Type:   "add",
+				Object: fmt.Sprintf("view:%s", name),
+				Detail: fmt.Sprintf("%v", currView["definition"]),
+				After:  after,
+			})
+		default:
+			before := ViewStatement(name, prevData.(map[string]interface{}))
+			if before != after {
+				changes = append(changes, Change{
+					Type:   "modify",
+					Object: fmt.Sprintf("view:%s", name),
+					Detail: "view definition changed",
+					Before: before,
+					After:  after,
+				})
+			}
+		}
+	}
+
+	for name, data := range prev {
+		if !isView(data) {
+			continue
+		}
+		if currData, exists := curr[name]; !exists || !isView(currData) {
+			changes = append(changes, Change{
+				Type:   "remove",
+				Object: fmt.Sprintf("view:%s", name),
+				Detail: "view removed",
+				Before: ViewStatement(name, data.(map[string]interface{})),
+			})
+		}
+	}
+
+	return changes
+}
+
+// Creation order of the non-table kinds. Views may call functions and
+// triggers fire on tables, so functions come first and triggers last.
+// Drops happen in the opposite order.
+var kindOrder = map[string]int{"function": 0, "procedure": 1, "view": 2, "trigger": 3}
+
+// orderChanges puts changes in an order that can be applied as is: views,
+// routines and triggers are dropped first, dependents before what they
+// depend on, then tables change, then views, routines and triggers are
+// created or replaced after everything they depend on.
+func orderChanges(changes []Change, prev, curr map[string]interface{}) []Change {
+	prevRank := viewRanks(prev)
+	currRank := viewRanks(curr)
+
+	var drops, tables, creates []Change
+	for _, c := range changes {
+		_, isObject := kindOrder[objectKindOf(c)]
+		switch {
+		case isObject && c.Type == "remove":
+			drops = append(drops, c)
+		case isObject:
+			creates = append(creates, c)
+		default:
+			tables = append(tables, c)
+		}
+	}
+
+	sort.SliceStable(drops, func(i, j int) bool {
+		ki, kj := kindOrder[objectKindOf(drops[i])], kindOrder[objectKindOf(drops[j])]
+		if ki != kj {
+			return ki > kj
+		}
+		if ri, rj := prevRank[objectName(drops[i])], prevRank[objectName(drops[j])]; ri != rj {
+			return ri > rj
+		}
+		return drops[i].Object < drops[j].Object
+	})
+	sort.SliceStable(tables, func(i, j int) bool {
+		if ri, rj := tableChangeRank(tables[i]), tableChangeRank(tables[j]); ri != rj {
+			return ri < rj
+		}
+		return tables[i].Object < tables[j].Object
+	})
+	sort.SliceStable(creates, func(i, j int) bool {
+		ki, kj := kindOrder[objectKindOf(creates[i])], kindOrder[objectKindOf(creates[j])]
+		if ki != kj {
+			return ki < kj
+		}
+		if ri, rj := currRank[objectName(creates[i])], currRank[objectName(creates[j])]; ri != rj {
+			return ri < rj
+		}
+		return creates[i].Object < creates[j].Object
+	})
+
+	ordered := make([]Change, 0, len(changes))
+	ordered = append(ordered, drops...)
+	ordered = append(ordered, tables...)
+	return append(ordered, creates...)
+}
+
+// tableChangeRank drops CHECK constraints and foreign keys before the
+// columns they use change and adds them afterwards. Indexes are dropped
+// before their columns go and added once the columns exist. Table options
+// come before column changes so that CONVERT TO CHARACTER SET does not
+// override explicit column collations. Partitioning changes once the
+// columns of the partitioning expression exist, dropping partitions before
+// adding ones that may reuse their values. Foreign keys come last, when
+// every table and index they need is in place.
+func tableChangeRank(c Change) int {
+	switch objectKindOf(c) {
+	case "check":
+		if c.Type == "remove" {
+			return 0
+		}
+		return 7
+	case "foreign_key":
+		if c.Type == "remove" {
+			return 0
+		}
+		return 8
+	case "index":
+		if c.Type == "remove" {
+			return 1
+		}
+		return 4
+	case "partitioning", "partition":
+		if c.Type == "remove" {
+			return 5
+		}
+		return 6
+	case "option":
+		return 2
+	default:
+		return 3
+	}
+}
+
+func objectKindOf(c Change) string {
+	return c.Object[:strings.Index(c.Object, ":")]
+}
+
+func objectName(c Change) string {
+	return c.Object[strings.Index(c.Object, ":")+1:]
+}
+
+// viewRanks numbers the views of schema so that every view ranks after the
+// views it depends on. Ties are broken by name.
+func viewRanks(schema map[string]interface{}) map[string]int {
+	var names []string
+	for name, data := range schema {
+		if isView(data) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	ranks := make(map[string]int, len(names))
+	visiting := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if _, done := ranks[name]; done || visiting[name] {
+			return
+		}
+		visiting[name] = true
+		view := schema[name].(map[string]interface{})
+		deps, _ := view["dependsOn"].([]interface{})
+		for _, dep := range deps {
+			if depName, ok := dep.(string); ok && isView(schema[depName]) {
+				visit(depName)
+			}
+		}
+		visiting[name] = false
+		ranks[name] = len(ranks)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return ranks
+}
+
+// ViewOrder lists the views of schema so that every view comes after the
+// views it depends on.
+func ViewOrder(schema map[string]interface{}) []string {
+	ranks := viewRanks(schema)
+	names := make([]string, len(ranks))
+	for name, rank := range ranks {
+		names[rank] = name
+	}
+	return names
+}
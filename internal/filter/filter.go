@@ -0,0 +1,120 @@
+// Package filter decides which schema objects dbpivot manages.
+package filter
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultExclude is always excluded: the table where dbpivot records applied
+// migrations, the golang-migrate history import moves out of its way, and
+// the shadow tables of online changes must never show up in a diff.
+var DefaultExclude = []string{
+	"schema_migrations", "*.schema_migrations",
+	"schema_migrations_golang_migrate", "*.schema_migrations_golang_migrate",
+	"table:_*_new", "table:*._*_new",
+	"table:_*_old", "table:*._*_old",
+}
+
+// Filter selects objects by name. A pattern is a glob such as "queue_*" or,
+// between slashes, a regular expression such as "/^tmp_[0-9]+$/". Patterns
+// match the object name ("users", "app.users") or the name prefixed with its
+// kind ("table:users", "trigger:audit_*").
+//
+// An object is kept when it matches an include pattern, or there are none,
+// and matches no exclude pattern. A nil Filter keeps everything.
+type Filter struct {
+	include []pattern
+	exclude []pattern
+}
+
+type pattern func(name string) bool
+
+// New compiles include and exclude patterns. DefaultExclude is added to the
+// exclude patterns.
+func New(include, exclude []string) (*Filter, error) {
+	f := &Filter{}
+	for _, p := range include {
+		m, err := compile(p)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, m)
+	}
+	for _, p := range append(append([]string{}, DefaultExclude...), exclude...) {
+		m, err := compile(p)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, m)
+	}
+	return f, nil
+}
+
+func compile(p string) (pattern, error) {
+	if len(p) > 1 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+		re, err := regexp.Compile(p[1 : len(p)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter pattern %q: %v", p, err)
+		}
+		return re.MatchString, nil
+	}
+	if _, err := path.Match(p, ""); err != nil {
+		return nil, fmt.Errorf("invalid filter pattern %q: %v", p, err)
+	}
+	return func(name string) bool {
+		ok, _ := path.Match(p, name)
+		return ok
+	}, nil
+}
+
+// Match reports whether the object of the given kind ("table", "view",
+// "procedure", ...) and name is kept.
+func (f *Filter) Match(kind, name string) bool {
+	if f == nil {
+		return true
+	}
+	names := []string{name, kind + ":" + name}
+	if len(f.include) > 0 && !matchAny(f.include, names) {
+		return false
+	}
+	return !matchAny(f.exclude, names)
+}
+
+func matchAny(patterns []pattern, names []string) bool {
+	for _, p := range patterns {
+		for _, name := range names {
+			if p(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Apply returns the entries of a snapshot that the filter keeps. Snapshot
+// keys are either a table or view name, or "kind:name" for routines and
+// triggers.
+func (f *Filter) Apply(schema map[string]interface{}) map[string]interface{} {
+	if f == nil {
+		return schema
+	}
+	kept := make(map[string]interface{}, len(schema))
+	for key, data := range schema {
+		kind, name := "table", key
+		if obj, ok := data.(map[string]interface{}); ok {
+			if t, ok := obj["type"].(string); ok && t != "" {
+				kind = t
+			}
+		}
+		if prefix := kind + ":"; strings.HasPrefix(key, prefix) {
+			name = strings.TrimPrefix(key, prefix)
+		}
+		if f.Match(kind, name) {
+			kept[key] = data
+		}
+	}
+	return kept
+}
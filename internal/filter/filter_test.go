@@ -0,0 +1,37 @@
+package filter
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	f, err := New([]string{"app.*", "users", "_*", "/^queue_[0-9]+$/", "trigger:audit_*"}, []string{"users_archive"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		kind, name string
+		want       bool
+	}{
+		{"table", "users", true},
+		{"table", "app.orders", true},
+		{"table", "queue_12", true},
+		{"table", "queue_x", false},
+		{"trigger", "audit_users", true},
+		{"table", "audit_users", false},
+		{"table", "schema_migrations", false},
+		{"table", "app.schema_migrations", false},
+		{"table", "schema_migrations_golang_migrate", false},
+		{"table", "_users_new", false},
+		{"table", "app._users_old", false},
+		{"table", "_users_archive", true},
+		{"view", "_users_new", true},
+	}
+	for _, tt := range tests {
+		if got := f.Match(tt.kind, tt.name); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.kind, tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := New(nil, []string{"/(/"}); err == nil {
+		t.Error("New accepted an invalid regular expression")
+	}
+}
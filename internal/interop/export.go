@@ -0,0 +1,130 @@
+package interop
+
+import (
+	"db-pivot/internal/migration"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// file is a file written by Export.
+type file struct {
+	name    string
+	content string
+}
+
+// exporter writes dbpivot migrations in a tool's layout.
+type exporter interface {
+	// export renders mig as the files the tool reads.
+	export(mig migration.Migration) ([]file, error)
+}
+
+var exporters = map[string]exporter{
+	"golang-migrate": golangMigrate{},
+	"flyway":         flyway{},
+	"goose":          goose{},
+	"liquibase":      liquibase{},
+}
+
+// ExportFormats lists the tools Export writes for.
+func ExportFormats() []string {
+	names := make([]string, 0, len(exporters))
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExportOptions controls Export.
+type ExportOptions struct {
+	// To is the tool to write for, one of ExportFormats.
+	To string
+	// Dir is the directory the files are written to. Existing files with
+	// the same names are replaced.
+	Dir string
+}
+
+// ExportResult reports what Export did.
+type ExportResult struct {
+	// Written lists the files created, in version order.
+	Written  []string
+	Warnings []string
+}
+
+// Export writes migs, ordered by version, in the file layout of another
+// tool. Every migration is rendered before any file is written.
+func Export(migs []migration.Migration, opts ExportOptions) (ExportResult, error) {
+	var result ExportResult
+	e, ok := exporters[opts.To]
+	if !ok {
+		return result, fmt.Errorf("unknown migration tool %q (want one of %s)", opts.To, strings.Join(ExportFormats(), ", "))
+	}
+	var files []file
+	for _, mig := range migs {
+		rendered, err := e.export(mig)
+		if err != nil {
+			return result, fmt.Errorf("failed to export migration %s: %v", mig.Version, err)
+		}
+		files = append(files, rendered...)
+		if !mig.Reversible {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("migration %s has no down script", mig.Version))
+		}
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return result, fmt.Errorf("failed to create directory %s: %v", opts.Dir, err)
+	}
+	for _, f := range files {
+		path := filepath.Join(opts.Dir, f.name)
+		if err := os.WriteFile(path, []byte(f.content), 0644); err != nil {
+			return result, fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		result.Written = append(result.Written, f.name)
+	}
+	return result, nil
+}
+
+// integerVersion is the number a tool with integer versions uses for a
+// dbpivot version. Timestamps and versions padded by Import qualify.
+func integerVersion(version, tool string) (string, error) {
+	n, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("version %s is not an integer, as %s requires", version, tool)
+	}
+	return strconv.FormatUint(n, 10), nil
+}
+
+// migrationName is the name part of the files mig is exported to.
+func migrationName(mig migration.Migration) string {
+	name := strings.TrimSuffix(mig.FileName(), ".sql")
+	return strings.TrimPrefix(name, mig.Version+"_")
+}
+
+// compound reports whether stmt has semicolons of its own, as routine
+// bodies do, and so cannot be split at them.
+func compound(stmt string) bool {
+	return strings.Contains(strings.TrimSuffix(strings.TrimSpace(stmt), ";"), ";")
+}
+
+// terminated returns stmt ending in a semicolon.
+func terminated(stmt string) string {
+	stmt = strings.TrimSpace(stmt)
+	if !strings.HasSuffix(stmt, ";") {
+		stmt += ";"
+	}
+	return stmt
+}
+
+// plainScript joins stmts for tools that send a whole file to the server
+// at once, where the server itself finds the statement boundaries.
+func plainScript(header string, stmts []string) string {
+	var b strings.Builder
+	b.WriteString(header)
+	for _, stmt := range stmts {
+		b.WriteString(terminated(stmt) + "\n")
+	}
+	return b.String()
+}
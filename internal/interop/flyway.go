@@ -0,0 +1,256 @@
+package interop
+
+import (
+	"context"
+	"database/sql"
+	"db-pivot/internal/db"
+	"db-pivot/internal/migration"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// flyway reads Flyway directories: versioned "V<version>__<description>.sql"
+// migrations and their "U<version>__<description>.sql" undo scripts.
+// Repeatable "R__" migrations have no dbpivot equivalent and are skipped.
+type flyway struct{}
+
+var flywayFile = regexp.MustCompile(`^([VUR])([^_]*(?:_[^_]+)*?)__(.*)\.sql$`)
+
+func (flyway) historyTable() string {
+	return "flyway_schema_history"
+}
+
+// flywayParts splits a Flyway version such as "1.2" or "2_1" into its
+// numbers. Trailing zero parts are dropped, since Flyway treats 1.0 and 1
+// as the same version.
+func flywayParts(v string) ([]string, error) {
+	parts := strings.FieldsFunc(v, func(r rune) bool {
+		return r == '.' || r == '_'
+	})
+	for len(parts) > 1 && strings.Trim(parts[len(parts)-1], "0") == "" {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("invalid version %q", v)
+	}
+	return parts, nil
+}
+
+// flywayWidth is the number of digits each part after the first takes in
+// a dbpivot version.
+const flywayWidth = 6
+
+// flywayVersion maps the parts of a Flyway version to an all-digit dbpivot
+// version: the first part padded like numericVersion, followed by minor
+// parts of six digits each, zero when the version has fewer than minors.
+// Every version of a directory gets the same number of minor parts, so
+// "1", "1.2" and "2" become 00000000000001000000, 00000000000001000002 and
+// 00000000000002000000 and keep Flyway's order.
+func flywayVersion(parts []string, minors int) (string, error) {
+	if len(parts)-1 > minors {
+		return "", fmt.Errorf("version %s has more than %d minor parts", strings.Join(parts, "."), minors)
+	}
+	version, err := numericVersion(parts[0])
+	if err != nil {
+		return "", err
+	}
+	for i := 1; i <= minors; i++ {
+		var n uint64
+		if i < len(parts) {
+			if n, err = strconv.ParseUint(parts[i], 10, 32); err != nil || n >= 1e6 {
+				return "", fmt.Errorf("invalid version %q", strings.Join(parts, "."))
+			}
+		}
+		version += fmt.Sprintf("%0*d", flywayWidth, n)
+	}
+	return version, nil
+}
+
+// flywayMinors returns the number of minor parts in a version made by
+// flywayVersion.
+func flywayMinors(version string) int {
+	return max(len(version)-14, 0) / flywayWidth
+}
+
+func (flyway) read(dir string) ([]Source, []string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var warnings []string
+	type flywayEntry struct {
+		name  string
+		match []string
+		parts []string
+	}
+	var files []flywayEntry
+	minors := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := flywayFile.FindStringSubmatch(entry.Name())
+		if m == nil {
+			if strings.HasSuffix(entry.Name(), ".sql") {
+				warnings = append(warnings, fmt.Sprintf("skipped %s: not a Flyway file name", entry.Name()))
+			}
+			continue
+		}
+		if m[1] == "R" {
+			warnings = append(warnings, fmt.Sprintf("skipped repeatable migration %s: dbpivot runs each migration once", entry.Name()))
+			continue
+		}
+		parts, err := flywayParts(m[2])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+		minors = max(minors, len(parts)-1)
+		files = append(files, flywayEntry{entry.Name(), m, parts})
+	}
+
+	byVersion := make(map[string]*Source)
+	undo := make(map[string]string)
+	for _, f := range files {
+		m := f.match
+		version, err := flywayVersion(f.parts, minors)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", f.name, err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, f.name))
+		if err != nil {
+			return nil, nil, err
+		}
+		script := wrapStoredPrograms(string(data))
+		if m[1] == "U" {
+			undo[version] = script
+			continue
+		}
+		if src, dup := byVersion[version]; dup {
+			return nil, nil, fmt.Errorf("version %s is defined in %s and %s", m[2], src.File, f.name)
+		}
+		src := &Source{Version: version, ID: version, Name: m[3], Up: script, File: f.name}
+		src.Metadata.Description = title(m[3])
+		byVersion[version] = src
+	}
+
+	for version, script := range undo {
+		src, ok := byVersion[version]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("skipped undo script of version %s: no matching versioned migration", version))
+			continue
+		}
+		src.Down, src.HasDown = script, true
+	}
+	srcs := make([]Source, 0, len(byVersion))
+	for _, src := range byVersion {
+		srcs = append(srcs, *src)
+	}
+	sort.Slice(srcs, func(i, j int) bool {
+		return migration.CompareVersions(srcs[i].Version, srcs[j].Version) < 0
+	})
+	return srcs, warnings, nil
+}
+
+// applied replays the history in installation order: successful migrations
+// apply their version, undo scripts revert it, and a baseline stands for
+// every version up to it.
+func (flyway) applied(ctx context.Context, dbm *db.DBManager, table string, srcs []Source) (map[string]bool, []string, error) {
+	rows, err := dbm.Query(ctx, fmt.Sprintf("SELECT version, type, success FROM `%s` ORDER BY installed_rank", table))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var warnings []string
+	minors := 0
+	if len(srcs) > 0 {
+		minors = flywayMinors(srcs[0].Version)
+	}
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var raw, kind sql.NullString
+		var success bool
+		if err := rows.Scan(&raw, &kind, &success); err != nil {
+			return nil, nil, err
+		}
+		if !raw.Valid {
+			continue
+		}
+		parts, err := flywayParts(raw.String)
+		if err != nil {
+			return nil, nil, err
+		}
+		version, err := flywayVersion(parts, minors)
+		if err != nil {
+			// No file has that many minor parts, so the version is none
+			// of the ones imported.
+			continue
+		}
+		if !success {
+			warnings = append(warnings, fmt.Sprintf("version %s failed in Flyway and is left pending; repair the database before applying it", raw.String))
+			continue
+		}
+		switch kind.String {
+		case "BASELINE":
+			for _, src := range srcs {
+				if migration.CompareVersions(src.Version, version) <= 0 {
+					applied[src.ID] = true
+				}
+			}
+		case "UNDO_SQL", "UNDO_JDBC", "UNDO_SPRING_JDBC":
+			delete(applied, version)
+		default:
+			applied[version] = true
+		}
+	}
+	return applied, warnings, rows.Err()
+}
+
+// export writes "V<version>__<name>.sql" and, for reversible migrations, an
+// undo script "U<version>__<name>.sql". Versions made by Import lose their
+// padding again, so "00000000000001000002" becomes "1.2".
+func (flyway) export(mig migration.Migration) ([]file, error) {
+	version := mig.Version
+	var minors []string
+	for i := flywayMinors(version); i > 0; i-- {
+		minors = append([]string{version[len(version)-flywayWidth:]}, minors...)
+		version = version[:len(version)-flywayWidth]
+	}
+	parts := append([]string{version}, minors...)
+	for len(parts) > 1 && strings.Trim(parts[len(parts)-1], "0") == "" {
+		parts = parts[:len(parts)-1]
+	}
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("version %s is not a Flyway version", mig.Version)
+		}
+		parts[i] = strconv.FormatUint(n, 10)
+	}
+	base := strings.Join(parts, ".") + "__" + migrationName(mig) + ".sql"
+	files := []file{{"V" + base, flywayScript(mig.Metadata.Header(), mig.Up)}}
+	if mig.Reversible {
+		files = append(files, file{"U" + base, flywayScript("", mig.Down)})
+	}
+	return files, nil
+}
+
+// flywayScript joins stmts, setting a DELIMITER around those with
+// semicolons of their own.
+func flywayScript(header string, stmts []string) string {
+	var b strings.Builder
+	b.WriteString(header)
+	for _, stmt := range stmts {
+		if compound(stmt) {
+			fmt.Fprintf(&b, "DELIMITER $$\n%s$$\nDELIMITER ;\n", strings.TrimSuffix(strings.TrimSpace(stmt), ";"))
+			continue
+		}
+		b.WriteString(terminated(stmt) + "\n")
+	}
+	return b.String()
+}
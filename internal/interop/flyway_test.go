@@ -0,0 +1,96 @@
+package interop
+
+import (
+	"db-pivot/internal/migration"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFlywayVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		minors  int
+		want    string
+	}{
+		{"1", 0, "00000000000001"},
+		{"1.0", 0, "00000000000001"},
+		{"1", 1, "00000000000001000000"},
+		{"1.2", 1, "00000000000001000002"},
+		{"2_1", 1, "00000000000002000001"},
+		{"1.2.3", 2, "00000000000001000002000003"},
+		{"1.2", 2, "00000000000001000002000000"},
+	}
+	for _, tt := range tests {
+		parts, err := flywayParts(tt.version)
+		if err != nil {
+			t.Fatalf("flywayParts(%q): %v", tt.version, err)
+		}
+		got, err := flywayVersion(parts, tt.minors)
+		if err != nil {
+			t.Fatalf("flywayVersion(%q, %d): %v", tt.version, tt.minors, err)
+		}
+		if got != tt.want {
+			t.Errorf("flywayVersion(%q, %d) = %q, want %q", tt.version, tt.minors, got, tt.want)
+		}
+		if !migration.ValidVersion(got) {
+			t.Errorf("flywayVersion(%q, %d) = %q is not a valid migration version", tt.version, tt.minors, got)
+		}
+	}
+	if _, err := flywayVersion([]string{"1", "2"}, 0); err == nil {
+		t.Error("flywayVersion accepted more minor parts than asked for")
+	}
+}
+
+// TestFlywayRoundTrip imports a Flyway directory with dotted versions,
+// loads the result as dbpivot migrations and exports it back.
+func TestFlywayRoundTrip(t *testing.T) {
+	src, migDir, out := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"V1__init.sql":      "CREATE TABLE users (id INT PRIMARY KEY);\n",
+		"V1.1__email.sql":   "ALTER TABLE users ADD email VARCHAR(255);\n",
+		"V1.2__name.sql":    "ALTER TABLE users ADD name VARCHAR(255);\n",
+		"U1.2__name.sql":    "ALTER TABLE users DROP name;\n",
+		"V2__orders.sql":    "CREATE TABLE orders (id INT PRIMARY KEY);\n",
+		"V10__invoices.sql": "CREATE TABLE invoices (id INT PRIMARY KEY);\n",
+		"R__views.sql":      "CREATE OR REPLACE VIEW v AS SELECT 1;\n",
+	})
+
+	srcs, migs, _, err := convert(flyway{}, ImportOptions{From: "flyway", Dir: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, mig := range migs {
+		if err := os.WriteFile(filepath.Join(migDir, mig.FileName()), []byte(srcs[i].Script()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded, skipped, err := migration.LoadMigrations(os.DirFS(migDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) > 0 {
+		t.Errorf("LoadMigrations skipped %q", skipped)
+	}
+	var names []string
+	for _, mig := range loaded {
+		names = append(names, mig.Name)
+	}
+	if want := []string{"init", "email", "name", "orders", "invoices"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("loaded %q, want %q", names, want)
+	}
+
+	result, err := Export(loaded, ExportOptions{To: "flyway", Dir: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := append([]string(nil), result.Written...)
+	sort.Strings(written)
+	want := []string{"U1.2__name.sql", "V1.1__email.sql", "V1.2__name.sql", "V10__invoices.sql", "V1__init.sql", "V2__orders.sql"}
+	if !reflect.DeepEqual(written, want) {
+		t.Errorf("exported %q, want %q", written, want)
+	}
+}
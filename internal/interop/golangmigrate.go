@@ -0,0 +1,127 @@
+package interop
+
+import (
+	"context"
+	"database/sql"
+	"db-pivot/internal/db"
+	"db-pivot/internal/migration"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// golangMigrate reads golang-migrate directories, "<version>_<title>.up.sql"
+// files with optional ".down.sql" counterparts. Its history table holds a
+// single row: the current version and whether its migration failed part way.
+type golangMigrate struct{}
+
+var golangMigrateFile = regexp.MustCompile(`^(\d+)_(.*)\.(up|down)\.sql$`)
+
+func (golangMigrate) historyTable() string {
+	return "schema_migrations"
+}
+
+func (golangMigrate) read(dir string) ([]Source, []string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var warnings []string
+	byVersion := make(map[string]*Source)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := golangMigrateFile.FindStringSubmatch(entry.Name())
+		if m == nil {
+			if strings.HasSuffix(entry.Name(), ".sql") {
+				warnings = append(warnings, fmt.Sprintf("skipped %s: not a golang-migrate file name", entry.Name()))
+			}
+			continue
+		}
+		version, err := numericVersion(m[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		src := byVersion[version]
+		if src == nil {
+			src = &Source{Version: version, ID: version, Name: m[2]}
+			src.Metadata.Description = title(m[2])
+			byVersion[version] = src
+		}
+		script := wrapStoredPrograms(string(data))
+		if m[3] == "up" {
+			if src.File != "" {
+				return nil, nil, fmt.Errorf("version %s is defined in %s and %s", m[1], src.File, entry.Name())
+			}
+			src.File, src.Up = entry.Name(), script
+		} else {
+			src.Down, src.HasDown = script, true
+		}
+	}
+
+	srcs := make([]Source, 0, len(byVersion))
+	for _, src := range byVersion {
+		if src.File == "" {
+			warnings = append(warnings, fmt.Sprintf("skipped version %s: down file without an up file", src.Version))
+			continue
+		}
+		srcs = append(srcs, *src)
+	}
+	sort.Slice(srcs, func(i, j int) bool {
+		return srcs[i].Version < srcs[j].Version
+	})
+	return srcs, warnings, nil
+}
+
+// applied treats every version up to the current one as applied. A dirty
+// current version failed part way, so it is left pending.
+func (golangMigrate) applied(ctx context.Context, dbm *db.DBManager, table string, srcs []Source) (map[string]bool, []string, error) {
+	var current int64
+	var dirty bool
+	err := dbm.QueryRow(ctx, fmt.Sprintf("SELECT version, dirty FROM `%s` LIMIT 1", table)).Scan(&current, &dirty)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if current < 0 {
+		return nil, nil, nil
+	}
+	last := fmt.Sprintf("%014d", current)
+	var warnings []string
+	if dirty {
+		warnings = append(warnings, fmt.Sprintf("version %d is dirty: it failed part way and is left pending; repair the database before applying it", current))
+	}
+	applied := make(map[string]bool)
+	for _, src := range srcs {
+		if src.Version < last || (src.Version == last && !dirty) {
+			applied[src.ID] = true
+		}
+	}
+	return applied, warnings, nil
+}
+
+// export writes "<version>_<name>.up.sql" and, for reversible migrations,
+// ".down.sql". golang-migrate sends each file to the server in one go, so
+// statements need no annotations.
+func (golangMigrate) export(mig migration.Migration) ([]file, error) {
+	version, err := integerVersion(mig.Version, "golang-migrate")
+	if err != nil {
+		return nil, err
+	}
+	base := version + "_" + migrationName(mig)
+	files := []file{{base + ".up.sql", plainScript(mig.Metadata.Header(), mig.Up)}}
+	if mig.Reversible {
+		files = append(files, file{base + ".down.sql", plainScript("", mig.Down)})
+	}
+	return files, nil
+}
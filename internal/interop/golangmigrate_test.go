@@ -0,0 +1,43 @@
+package interop
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGolangMigrateRead(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"1_init.up.sql":      "CREATE TABLE users (id INT);\n",
+		"1_init.down.sql":    "DROP TABLE users;\n",
+		"2_audit.up.sql":     "CREATE TRIGGER tr BEFORE INSERT ON users FOR EACH ROW\nBEGIN\n  SET NEW.id = NEW.id;\nEND;\n",
+		"3_orphan.down.sql":  "DROP TABLE orphans;\n",
+		"notes.sql":          "-- not a migration\n",
+		"README.md":          "docs\n",
+		"10_invoices.up.sql": "CREATE TABLE invoices (id INT);\n",
+	})
+	srcs, warnings, err := golangMigrate{}.read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srcs) != 3 {
+		t.Fatalf("read %d migrations, want 3", len(srcs))
+	}
+	if srcs[0].Version != "00000000000001" || !srcs[0].HasDown || srcs[0].Down != "DROP TABLE users;\n" {
+		t.Errorf("first migration %+v", srcs[0])
+	}
+	if !strings.HasPrefix(srcs[1].Up, "-- +dbpivot StatementBegin\n") || srcs[1].HasDown {
+		t.Errorf("trigger migration %+v", srcs[1])
+	}
+	if srcs[2].Version != "00000000000010" {
+		t.Errorf("last migration has version %s, want 00000000000010", srcs[2].Version)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("warnings %q, want notes.sql and the orphan down file", warnings)
+	}
+
+	writeFiles(t, dir, map[string]string{"01_again.up.sql": "SELECT 1;\n"})
+	if _, _, err := (golangMigrate{}).read(dir); err == nil {
+		t.Error("two up files of version 1 were accepted")
+	}
+}
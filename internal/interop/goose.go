@@ -0,0 +1,165 @@
+package interop
+
+import (
+	"context"
+	"db-pivot/internal/db"
+	"db-pivot/internal/migration"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// goose reads goose directories, "<version>_<name>.sql" files with
+// "-- +goose Up" and "-- +goose Down" sections. Go migrations are compiled
+// into the goose binary and cannot be imported.
+type goose struct{}
+
+var gooseFile = regexp.MustCompile(`^(\d+)_(.*)\.(sql|go)$`)
+
+const gooseAnnotation = "-- +goose"
+
+func (goose) historyTable() string {
+	return "goose_db_version"
+}
+
+func (goose) read(dir string) ([]Source, []string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var warnings []string
+	var srcs []Source
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := gooseFile.FindStringSubmatch(entry.Name())
+		if m == nil {
+			if strings.HasSuffix(entry.Name(), ".sql") {
+				warnings = append(warnings, fmt.Sprintf("skipped %s: not a goose file name", entry.Name()))
+			}
+			continue
+		}
+		if m[3] == "go" {
+			warnings = append(warnings, fmt.Sprintf("skipped Go migration %s: port it with dbpivot.AddMigration", entry.Name()))
+			continue
+		}
+		version, err := numericVersion(m[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		src := Source{Version: version, ID: version, Name: m[2], File: entry.Name()}
+		src.Metadata.Description = title(m[2])
+		if err := convertGoose(&src, string(data)); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+		srcs = append(srcs, src)
+	}
+	sort.Slice(srcs, func(i, j int) bool {
+		return srcs[i].Version < srcs[j].Version
+	})
+	return srcs, warnings, nil
+}
+
+// convertGoose splits a goose script into src's directions, turning goose
+// annotations into their dbpivot equivalents.
+func convertGoose(src *Source, script string) error {
+	var up, down strings.Builder
+	var current *strings.Builder
+	for i, line := range strings.Split(script, "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), gooseAnnotation)
+		if !ok {
+			if current != nil {
+				current.WriteString(line + "\n")
+			}
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(rest)) {
+		case "up":
+			current = &up
+		case "down":
+			current = &down
+			src.HasDown = true
+		case "statementbegin":
+			if current == nil {
+				return fmt.Errorf("line %d: StatementBegin before the Up section", i+1)
+			}
+			current.WriteString("-- +dbpivot StatementBegin\n")
+		case "statementend":
+			if current == nil {
+				return fmt.Errorf("line %d: StatementEnd before the Up section", i+1)
+			}
+			current.WriteString("-- +dbpivot StatementEnd\n")
+		case "no transaction":
+			src.Metadata.NoTransaction = true
+		default:
+			return fmt.Errorf("line %d: unsupported goose annotation %q", i+1, strings.TrimSpace(line))
+		}
+	}
+	src.Up, src.Down = up.String(), down.String()
+	return nil
+}
+
+// applied takes the last entry of each version, since goose records a
+// rollback as a new row with is_applied false. Version 0 is goose's own
+// marker row.
+func (goose) applied(ctx context.Context, dbm *db.DBManager, table string, srcs []Source) (map[string]bool, []string, error) {
+	rows, err := dbm.Query(ctx, fmt.Sprintf("SELECT version_id, is_applied FROM `%s` ORDER BY id", table))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		if err := rows.Scan(&version, &isApplied); err != nil {
+			return nil, nil, err
+		}
+		if version <= 0 {
+			continue
+		}
+		applied[fmt.Sprintf("%014d", version)] = isApplied
+	}
+	return applied, nil, rows.Err()
+}
+
+// export writes "<version>_<name>.sql" with goose annotations. Statements
+// with semicolons of their own are wrapped in StatementBegin and
+// StatementEnd.
+func (goose) export(mig migration.Migration) ([]file, error) {
+	version, err := integerVersion(mig.Version, "goose")
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString(mig.Metadata.Header())
+	if mig.Metadata.NoTransaction {
+		b.WriteString(gooseAnnotation + " NO TRANSACTION\n")
+	}
+	b.WriteString(gooseAnnotation + " Up\n")
+	writeGooseStatements(&b, mig.Up)
+	if mig.Reversible {
+		b.WriteString("\n" + gooseAnnotation + " Down\n")
+		writeGooseStatements(&b, mig.Down)
+	}
+	return []file{{version + "_" + migrationName(mig) + ".sql", b.String()}}, nil
+}
+
+func writeGooseStatements(b *strings.Builder, stmts []string) {
+	for _, stmt := range stmts {
+		if compound(stmt) {
+			fmt.Fprintf(b, "%s StatementBegin\n%s\n%s StatementEnd\n", gooseAnnotation, terminated(stmt), gooseAnnotation)
+			continue
+		}
+		b.WriteString(terminated(stmt) + "\n")
+	}
+}
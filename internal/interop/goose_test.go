@@ -0,0 +1,89 @@
+package interop
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertGoose(t *testing.T) {
+	tests := []struct {
+		name          string
+		script        string
+		up, down      string
+		hasDown       bool
+		noTransaction bool
+		wantErr       bool
+	}{
+		{
+			name:    "up and down",
+			script:  "-- +goose Up\nCREATE TABLE t (id INT);\n\n-- +goose Down\nDROP TABLE t;\n",
+			up:      "CREATE TABLE t (id INT);\n\n",
+			down:    "DROP TABLE t;\n\n",
+			hasDown: true,
+		},
+		{
+			name:   "statement block",
+			script: "-- +goose Up\n-- +goose StatementBegin\nCREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\nEND;\n-- +goose StatementEnd\n",
+			up:     "-- +dbpivot StatementBegin\nCREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\nEND;\n-- +dbpivot StatementEnd\n\n",
+		},
+		{
+			name:          "no transaction",
+			script:        "-- +goose NO TRANSACTION\n-- +goose Up\nCREATE INDEX i ON t (id);\n",
+			up:            "CREATE INDEX i ON t (id);\n\n",
+			noTransaction: true,
+		},
+		{
+			name:    "statement block before Up",
+			script:  "-- +goose StatementBegin\nSELECT 1;\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown annotation",
+			script:  "-- +goose Up\n-- +goose ENVSUB ON\nSELECT 1;\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var src Source
+			err := convertGoose(&src, tt.script)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if src.Up != tt.up || src.Down != tt.down || src.HasDown != tt.hasDown || src.Metadata.NoTransaction != tt.noTransaction {
+				t.Errorf("got up %q, down %q, hasDown %v, noTransaction %v", src.Up, src.Down, src.HasDown, src.Metadata.NoTransaction)
+			}
+		})
+	}
+}
+
+func TestGooseRead(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"00002_add_email.sql": "-- +goose Up\nALTER TABLE users ADD email VARCHAR(255);\n",
+		"00001_init.sql":      "-- +goose Up\nCREATE TABLE users (id INT);\n-- +goose Down\nDROP TABLE users;\n",
+		"00003_backfill.go":   "package migrations\n",
+		"seed.sql":            "INSERT INTO users VALUES (1);\n",
+	})
+	srcs, warnings, err := goose{}.read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][3]string
+	for _, src := range srcs {
+		got = append(got, [3]string{src.Version, src.Name, src.Metadata.Description})
+	}
+	want := [][3]string{{"00000000000001", "init", "init"}, {"00000000000002", "add_email", "add email"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read %q, want %q", got, want)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("warnings %q, want the Go migration and seed.sql", warnings)
+	}
+}
@@ -0,0 +1,290 @@
+// Package interop converts migrations and migration histories between
+// dbpivot and other migration tools.
+package interop
+
+import (
+	"context"
+	"db-pivot/internal/db"
+	"db-pivot/internal/migration"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source is a migration read from another tool, rewritten in dbpivot syntax.
+type Source struct {
+	// Version is the dbpivot version the migration is imported as.
+	Version string
+	// ID identifies the migration in the tool's history table.
+	ID       string
+	Name     string
+	Metadata migration.Metadata
+	// Up and Down are the statements of each direction, with dbpivot
+	// annotations where a statement spans several lines.
+	Up      string
+	Down    string
+	HasDown bool
+	// File is the file the migration was read from.
+	File string
+}
+
+// Script renders s as a dbpivot migration file.
+func (s Source) Script() string {
+	var b strings.Builder
+	b.WriteString(s.Metadata.Header())
+	b.WriteString("-- +dbpivot Up\n")
+	b.WriteString(strings.TrimSpace(s.Up) + "\n")
+	if s.HasDown {
+		b.WriteString("\n-- +dbpivot Down\n")
+		if down := strings.TrimSpace(s.Down); down != "" {
+			b.WriteString(down + "\n")
+		}
+	}
+	return b.String()
+}
+
+// format is the file layout and history table of a migration tool.
+type format interface {
+	// read converts the migrations in dir, in the order the tool applies
+	// them. Files it cannot convert are skipped with a warning.
+	read(dir string) ([]Source, []string, error)
+	// historyTable is the default name of the tool's history table.
+	historyTable() string
+	// applied reads the history table and returns the IDs of the sources
+	// the tool applied.
+	applied(ctx context.Context, dbm *db.DBManager, table string, srcs []Source) (map[string]bool, []string, error)
+}
+
+var formats = map[string]format{
+	"golang-migrate": golangMigrate{},
+	"flyway":         flyway{},
+	"goose":          goose{},
+	"liquibase-sql":  liquibase{},
+}
+
+// ImportFormats lists the tools Import reads from.
+func ImportFormats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ImportOptions controls Import.
+type ImportOptions struct {
+	// From is the tool the migrations come from, one of ImportFormats.
+	From string
+	// Dir is the tool's migration directory.
+	Dir string
+	// HistoryTable overrides the name of the tool's history table.
+	HistoryTable string
+	// MigrationDir is the dbpivot migration directory written to. It must
+	// exist.
+	MigrationDir string
+	// Existing holds the versions already defined in dbpivot, which the
+	// imported migrations may not reuse.
+	Existing map[string]bool
+}
+
+// ImportResult reports what Import did.
+type ImportResult struct {
+	// Written lists the migration files created, in version order.
+	Written []string
+	// Recorded lists the versions marked as applied in schema_migrations.
+	Recorded []string
+	Warnings []string
+}
+
+// legacyHistoryTable is where a golang-migrate history table named
+// schema_migrations is moved, since dbpivot needs that name.
+const legacyHistoryTable = "schema_migrations_golang_migrate"
+
+// Import converts the migrations of another tool into dbpivot migration
+// files and records the ones its history table lists as applied in
+// schema_migrations, without running them. Every file is converted and
+// validated before any is written.
+func Import(ctx context.Context, dbm *db.DBManager, opts ImportOptions) (ImportResult, error) {
+	var result ImportResult
+	f, ok := formats[opts.From]
+	if !ok {
+		return result, fmt.Errorf("unknown migration tool %q (want one of %s)", opts.From, strings.Join(ImportFormats(), ", "))
+	}
+	srcs, migs, warnings, err := convert(f, opts)
+	result.Warnings = append(result.Warnings, warnings...)
+	if err != nil {
+		return result, err
+	}
+
+	table := opts.HistoryTable
+	if table == "" {
+		table = f.historyTable()
+	}
+	columns, err := dbm.TableColumns(ctx, table)
+	if err != nil {
+		return result, err
+	}
+	var applied map[string]bool
+	switch {
+	case len(columns) == 0:
+		result.Warnings = append(result.Warnings, fmt.Sprintf("history table %s not found; no migrations were marked as applied", table))
+	case table == "schema_migrations" && !columns["dirty"]:
+		result.Warnings = append(result.Warnings, "schema_migrations already belongs to dbpivot; no migrations were marked as applied")
+	default:
+		applied, warnings, err = f.applied(ctx, dbm, table, srcs)
+		if err != nil {
+			return result, fmt.Errorf("failed to read %s: %v", table, err)
+		}
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+
+	for i, mig := range migs {
+		path := filepath.Join(opts.MigrationDir, mig.FileName())
+		if err := os.WriteFile(path, []byte(srcs[i].Script()), 0644); err != nil {
+			return result, fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		result.Written = append(result.Written, mig.FileName())
+	}
+
+	if len(columns) > 0 && table == "schema_migrations" && columns["dirty"] {
+		rename := fmt.Sprintf("RENAME TABLE schema_migrations TO %s", legacyHistoryTable)
+		if err := dbm.ApplyMigration(ctx, rename); err != nil {
+			return result, fmt.Errorf("failed to move the golang-migrate history table aside: %v", err)
+		}
+		result.Warnings = append(result.Warnings, fmt.Sprintf("the golang-migrate history table was renamed to %s", legacyHistoryTable))
+	}
+	if err := dbm.InitVersionTable(ctx); err != nil {
+		return result, fmt.Errorf("failed to initialize version table: %v", err)
+	}
+	for i, mig := range migs {
+		if !applied[srcs[i].ID] {
+			continue
+		}
+		done, err := dbm.IsMigrationApplied(ctx, mig.Version)
+		if err != nil {
+			return result, err
+		}
+		if done {
+			continue
+		}
+		if err := migration.MarkApplied(ctx, dbm, mig); err != nil {
+			return result, err
+		}
+		result.Recorded = append(result.Recorded, mig.Version)
+	}
+	return result, nil
+}
+
+// convert reads the migrations of opts.Dir and parses each as the dbpivot
+// migration Import writes for it.
+func convert(f format, opts ImportOptions) ([]Source, []migration.Migration, []string, error) {
+	srcs, warnings, err := f.read(opts.Dir)
+	if err != nil {
+		return nil, nil, warnings, err
+	}
+	if len(srcs) == 0 {
+		return nil, nil, warnings, fmt.Errorf("no %s migrations found in %s", opts.From, opts.Dir)
+	}
+	migs := make([]migration.Migration, len(srcs))
+	for i, src := range srcs {
+		if opts.Existing[src.Version] {
+			return nil, nil, warnings, fmt.Errorf("%s would be imported as version %s, which already exists", src.File, src.Version)
+		}
+		if i > 0 && migration.CompareVersions(srcs[i-1].Version, src.Version) == 0 {
+			return nil, nil, warnings, fmt.Errorf("%s and %s both map to version %s", srcs[i-1].File, src.File, src.Version)
+		}
+		file := migration.FileName(src.Version, src.Name)
+		if migs[i], err = migration.ParseMigration(file, []byte(src.Script())); err != nil {
+			return nil, nil, warnings, fmt.Errorf("failed to convert %s: %v", src.File, err)
+		}
+	}
+	return srcs, migs, warnings, nil
+}
+
+// numericVersion pads an integer version to the width of the timestamps
+// dbpivot uses, so that imported migrations sort by number.
+func numericVersion(v string) (string, error) {
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid version %q", v)
+	}
+	return fmt.Sprintf("%014d", n), nil
+}
+
+// title turns a file name part such as "add_users_email" into a description.
+func title(name string) string {
+	return strings.TrimSpace(strings.NewReplacer("_", " ", "-", " ").Replace(name))
+}
+
+var (
+	storedProgram = regexp.MustCompile(`(?i)^\s*CREATE\s+(DEFINER\s*=\s*\S+\s+)?(OR\s+REPLACE\s+)?(PROCEDURE|FUNCTION|TRIGGER|EVENT)\b`)
+	delimiterLine = regexp.MustCompile(`(?im)^\s*DELIMITER\s+\S+\s*$`)
+	words         = regexp.MustCompile(`[A-Za-z_]+`)
+)
+
+// wrapStoredPrograms marks each CREATE PROCEDURE, FUNCTION, TRIGGER or
+// EVENT statement of script as a single statement, so that the semicolons
+// inside its body do not split it. Tools that send a whole file to the
+// server at once do not need this, but dbpivot runs statements one by one.
+// Scripts that change the DELIMITER already mark their boundaries.
+func wrapStoredPrograms(script string) string {
+	if delimiterLine.MatchString(script) {
+		return script
+	}
+	var out []string
+	inProgram := false
+	depth := 0
+	for _, line := range strings.Split(script, "\n") {
+		if !inProgram && storedProgram.MatchString(line) {
+			out = append(out, "-- +dbpivot StatementBegin")
+			inProgram, depth = true, 0
+		}
+		out = append(out, line)
+		if !inProgram {
+			continue
+		}
+		depth += blockDepth(line)
+		if depth <= 0 && strings.HasSuffix(strings.TrimSpace(line), ";") {
+			out = append(out, "-- +dbpivot StatementEnd")
+			inProgram = false
+		}
+	}
+	if inProgram {
+		out = append(out, "-- +dbpivot StatementEnd")
+	}
+	return strings.Join(out, "\n")
+}
+
+// blockDepth returns how many compound blocks line opens minus how many it
+// closes. BEGIN and CASE open a block that END closes; END IF, END LOOP,
+// END WHILE and END REPEAT close blocks whose openers are not counted.
+func blockDepth(line string) int {
+	if i := strings.Index(line, "--"); i >= 0 {
+		line = line[:i]
+	}
+	tokens := words.FindAllString(strings.ToUpper(line), -1)
+	depth := 0
+	for i, tok := range tokens {
+		switch tok {
+		case "BEGIN", "CASE":
+			if tok == "CASE" && i > 0 && tokens[i-1] == "END" {
+				continue
+			}
+			depth++
+		case "END":
+			if i+1 < len(tokens) {
+				switch tokens[i+1] {
+				case "IF", "LOOP", "WHILE", "REPEAT":
+					continue
+				}
+			}
+			depth--
+		}
+	}
+	return depth
+}
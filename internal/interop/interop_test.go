@@ -0,0 +1,166 @@
+package interop
+
+import (
+	"db-pivot/internal/migration"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates files, keyed by name, in dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNumericVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+		ok      bool
+	}{
+		{"3", "00000000000003", true},
+		{"0042", "00000000000042", true},
+		{"20260101120000", "20260101120000", true},
+		{"1.2", "", false},
+		{"-1", "", false},
+		{"v1", "", false},
+	}
+	for _, tt := range tests {
+		got, err := numericVersion(tt.version)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("numericVersion(%q) = %q, %v, want %q, ok %v", tt.version, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWrapStoredPrograms(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{
+			name:   "plain statements",
+			script: "CREATE TABLE t (id INT);\nINSERT INTO t VALUES (1);",
+			want:   "CREATE TABLE t (id INT);\nINSERT INTO t VALUES (1);",
+		},
+		{
+			name: "procedure with nested blocks",
+			script: "CREATE PROCEDURE p()\nBEGIN\n  IF 1 THEN\n    SELECT 1;\n  END IF;\n" +
+				"  CASE WHEN 1 THEN SELECT 2; END CASE;\nEND;\nCREATE TABLE t (id INT);",
+			want: "-- +dbpivot StatementBegin\nCREATE PROCEDURE p()\nBEGIN\n  IF 1 THEN\n    SELECT 1;\n  END IF;\n" +
+				"  CASE WHEN 1 THEN SELECT 2; END CASE;\nEND;\n-- +dbpivot StatementEnd\nCREATE TABLE t (id INT);",
+		},
+		{
+			name:   "single-line trigger",
+			script: "CREATE DEFINER=`app`@`%` TRIGGER tr BEFORE INSERT ON t FOR EACH ROW SET NEW.v = 1;",
+			want:   "-- +dbpivot StatementBegin\nCREATE DEFINER=`app`@`%` TRIGGER tr BEFORE INSERT ON t FOR EACH ROW SET NEW.v = 1;\n-- +dbpivot StatementEnd",
+		},
+		{
+			name:   "END in a comment",
+			script: "CREATE FUNCTION f() RETURNS INT\nBEGIN -- END here does not count\n  RETURN 1;\nEND;",
+			want:   "-- +dbpivot StatementBegin\nCREATE FUNCTION f() RETURNS INT\nBEGIN -- END here does not count\n  RETURN 1;\nEND;\n-- +dbpivot StatementEnd",
+		},
+		{
+			name:   "unterminated program",
+			script: "CREATE EVENT e ON SCHEDULE EVERY 1 DAY DO\nBEGIN\n  DELETE FROM t;",
+			want:   "-- +dbpivot StatementBegin\nCREATE EVENT e ON SCHEDULE EVERY 1 DAY DO\nBEGIN\n  DELETE FROM t;\n-- +dbpivot StatementEnd",
+		},
+		{
+			name:   "script with its own delimiter",
+			script: "DELIMITER $$\nCREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\nEND$$\nDELIMITER ;",
+			want:   "DELIMITER $$\nCREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\nEND$$\nDELIMITER ;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wrapStoredPrograms(tt.script); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// roundTripMigrations are dbpivot migrations exported to every tool and
+// imported back.
+var roundTripMigrations = map[string]string{
+	"20260101000000_create_users.sql": "-- author: ana\n-- description: users table\n" +
+		"-- Up migration\nCREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(100));\n" +
+		"-- Down migration\nDROP TABLE users;\n",
+	"20260102000000_audit_trigger.sql": "-- Up migration\n" +
+		"-- +dbpivot StatementBegin\n" +
+		"CREATE TRIGGER users_audit BEFORE UPDATE ON users FOR EACH ROW\nBEGIN\n  SET NEW.name = TRIM(NEW.name);\nEND;\n" +
+		"-- +dbpivot StatementEnd\n" +
+		"-- Down migration\nDROP TRIGGER users_audit;\n",
+	"20260103000000_backfill.sql": "-- no-transaction: true\n" +
+		"-- Up migration\nUPDATE users SET name = '' WHERE name IS NULL;\nALTER TABLE users ADD INDEX idx_name (name);\n",
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, roundTripMigrations)
+	want, _, err := migration.LoadMigrations(os.DirFS(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		to, from string
+		// keepsVersions is false for tools that number migrations
+		// themselves.
+		keepsVersions, keepsNoTransaction bool
+	}{
+		{"flyway", "flyway", true, false},
+		{"golang-migrate", "golang-migrate", true, false},
+		{"goose", "goose", true, true},
+		{"liquibase", "liquibase-sql", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.to, func(t *testing.T) {
+			dir := t.TempDir()
+			if _, err := Export(want, ExportOptions{To: tt.to, Dir: dir}); err != nil {
+				t.Fatal(err)
+			}
+			_, got, _, err := convert(formats[tt.from], ImportOptions{From: tt.from, Dir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("imported %d migrations, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if tt.keepsVersions && got[i].Version != want[i].Version {
+					t.Errorf("migration %d has version %s, want %s", i, got[i].Version, want[i].Version)
+				}
+				if !reflect.DeepEqual(statements(got[i].Up), statements(want[i].Up)) {
+					t.Errorf("migration %s runs up\n%q\nwant\n%q", want[i].Version, got[i].Up, want[i].Up)
+				}
+				if !reflect.DeepEqual(statements(got[i].Down), statements(want[i].Down)) {
+					t.Errorf("migration %s runs down\n%q\nwant\n%q", want[i].Version, got[i].Down, want[i].Down)
+				}
+				if got[i].Reversible != want[i].Reversible {
+					t.Errorf("migration %s reversible %v, want %v", want[i].Version, got[i].Reversible, want[i].Reversible)
+				}
+				if tt.keepsNoTransaction && got[i].Metadata.NoTransaction != want[i].Metadata.NoTransaction {
+					t.Errorf("migration %s no-transaction %v, want %v", want[i].Version, got[i].Metadata.NoTransaction, want[i].Metadata.NoTransaction)
+				}
+			}
+		})
+	}
+}
+
+// statements drops the terminators a tool may or may not write.
+func statements(stmts []string) []string {
+	out := make([]string, 0, len(stmts))
+	for _, stmt := range stmts {
+		out = append(out, strings.TrimSuffix(strings.TrimSpace(stmt), ";"))
+	}
+	return out
+}
@@ -0,0 +1,257 @@
+package interop
+
+import (
+	"bufio"
+	"context"
+	"db-pivot/internal/db"
+	"db-pivot/internal/migration"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// liquibase reads Liquibase formatted SQL changelogs: ".sql" files that
+// start with "--liquibase formatted sql" and hold "--changeset author:id"
+// sections with "--rollback" lines. Changesets become migrations numbered
+// in file name order, then in the order they appear in each file, as with
+// includeAll.
+type liquibase struct{}
+
+var (
+	liquibaseHeader    = regexp.MustCompile(`(?i)^--\s*liquibase\s+formatted\s+sql`)
+	liquibaseChangeset = regexp.MustCompile(`(?i)^--\s*changeset\s+(\S+?):(\S+)(.*)$`)
+	liquibaseRollback  = regexp.MustCompile(`(?i)^--\s*rollback\s?(.*)$`)
+	liquibaseComment   = regexp.MustCompile(`(?i)^--\s*comment:\s*(.*)$`)
+	liquibaseOther     = regexp.MustCompile(`(?i)^--\s*(precondition\S*|validCheckSum|ignoreLines)\b`)
+	liquibaseAttribute = regexp.MustCompile(`(\w+):("[^"]*"|\S+)`)
+)
+
+func (liquibase) historyTable() string {
+	return "DATABASECHANGELOG"
+}
+
+// changeset is a changeset being read.
+type changeset struct {
+	src            Source
+	up, rollback   []string
+	endDelimiter   string
+	splitStatement bool
+}
+
+func (liquibase) read(dir string) ([]Source, []string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sql") {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+
+	var warnings []string
+	var srcs []Source
+	for _, file := range files {
+		changesets, fileWarnings, err := readChangelog(filepath.Join(dir, file), file)
+		if err != nil {
+			return nil, nil, err
+		}
+		warnings = append(warnings, fileWarnings...)
+		for _, cs := range changesets {
+			cs.src.Version = fmt.Sprintf("%014d", len(srcs)+1)
+			srcs = append(srcs, cs.src)
+		}
+	}
+	return srcs, warnings, nil
+}
+
+func readChangelog(path, file string) ([]*changeset, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var warnings []string
+	var changesets []*changeset
+	var cs *changeset
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNo++
+		trimmed := strings.TrimSpace(line)
+		if lineNo == 1 && !liquibaseHeader.MatchString(trimmed) {
+			warnings = append(warnings, fmt.Sprintf("skipped %s: not a Liquibase formatted SQL changelog", file))
+			return nil, warnings, nil
+		}
+		if m := liquibaseChangeset.FindStringSubmatch(trimmed); m != nil {
+			cs = &changeset{splitStatement: true}
+			cs.src.ID = m[1] + ":" + m[2]
+			cs.src.Name = m[2]
+			cs.src.File = file
+			cs.src.Metadata.Author = m[1]
+			cs.src.Metadata.Description = m[2]
+			for _, attr := range liquibaseAttribute.FindAllStringSubmatch(m[3], -1) {
+				value := strings.Trim(attr[2], `"`)
+				switch strings.ToLower(attr[1]) {
+				case "runintransaction":
+					cs.src.Metadata.NoTransaction = strings.EqualFold(value, "false")
+				case "enddelimiter":
+					cs.endDelimiter = value
+				case "splitstatements":
+					cs.splitStatement = !strings.EqualFold(value, "false")
+				case "labels", "context", "contextfilter":
+					cs.src.Metadata.Tags = append(cs.src.Metadata.Tags, splitAttribute(value)...)
+				case "runonchange", "runalways":
+					if strings.EqualFold(value, "true") {
+						warnings = append(warnings, fmt.Sprintf("%s:%d: %s is ignored; dbpivot runs changeset %s once", file, lineNo, attr[1], cs.src.ID))
+					}
+				}
+			}
+			changesets = append(changesets, cs)
+			continue
+		}
+		if cs == nil {
+			continue
+		}
+		if m := liquibaseRollback.FindStringSubmatch(trimmed); m != nil {
+			if rollback := strings.TrimSpace(m[1]); rollback != "" && !strings.EqualFold(rollback, "not required") && !strings.EqualFold(rollback, "empty") {
+				cs.rollback = append(cs.rollback, m[1])
+			}
+			cs.src.HasDown = true
+			continue
+		}
+		if m := liquibaseComment.FindStringSubmatch(trimmed); m != nil {
+			cs.src.Metadata.Description = strings.TrimSpace(m[1])
+			continue
+		}
+		if liquibaseOther.MatchString(trimmed) {
+			warnings = append(warnings, fmt.Sprintf("%s:%d: ignored %q in changeset %s", file, lineNo, trimmed, cs.src.ID))
+			continue
+		}
+		cs.up = append(cs.up, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	for _, cs := range changesets {
+		cs.src.Up = cs.statements(cs.up)
+		cs.src.Down = cs.statements(cs.rollback)
+	}
+	return changesets, warnings, nil
+}
+
+// statements renders lines of a changeset in dbpivot syntax. An
+// endDelimiter becomes a DELIMITER block and splitStatements:false makes
+// the whole body one statement.
+func (cs *changeset) statements(lines []string) string {
+	body := strings.TrimSpace(strings.Join(lines, "\n"))
+	switch {
+	case body == "":
+		return ""
+	case !cs.splitStatement:
+		return "-- +dbpivot StatementBegin\n" + body + "\n-- +dbpivot StatementEnd"
+	case cs.endDelimiter != "" && cs.endDelimiter != ";":
+		return "DELIMITER " + cs.endDelimiter + "\n" + body + "\nDELIMITER ;"
+	}
+	return body
+}
+
+func splitAttribute(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// applied matches changesets by author and id. MARK_RAN rows count as
+// applied, since Liquibase uses them for changes made outside of it.
+func (liquibase) applied(ctx context.Context, dbm *db.DBManager, table string, srcs []Source) (map[string]bool, []string, error) {
+	rows, err := dbm.Query(ctx, fmt.Sprintf("SELECT AUTHOR, ID, EXECTYPE FROM `%s` ORDER BY ORDEREXECUTED", table))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var warnings []string
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var author, id, execType string
+		if err := rows.Scan(&author, &id, &execType); err != nil {
+			return nil, nil, err
+		}
+		switch strings.ToUpper(execType) {
+		case "EXECUTED", "RERAN", "MARK_RAN":
+			applied[author+":"+id] = true
+		case "FAILED":
+			warnings = append(warnings, fmt.Sprintf("changeset %s:%s failed in Liquibase and is left pending; repair the database before applying it", author, id))
+		}
+	}
+	return applied, warnings, rows.Err()
+}
+
+// liquibaseDelimiter ends the statements of changesets with routine
+// bodies, whose own semicolons would otherwise split them.
+const liquibaseDelimiter = "//"
+
+// export writes a formatted SQL changelog holding one changeset, with id
+// the version and author the migration's author. Files are named after the
+// version, so a changelog that includes the directory with includeAll runs
+// them in order.
+func (liquibase) export(mig migration.Migration) ([]file, error) {
+	meta := mig.Metadata
+	author := meta.Author
+	if author == "" {
+		author = "dbpivot"
+	}
+	var b strings.Builder
+	b.WriteString("--liquibase formatted sql\n\n")
+	fmt.Fprintf(&b, "--changeset %s:%s", strings.ReplaceAll(author, " ", "_"), mig.Version)
+	delimiter := ";"
+	for _, stmt := range append(append([]string{}, mig.Up...), mig.Down...) {
+		if compound(stmt) {
+			delimiter = liquibaseDelimiter
+		}
+	}
+	if delimiter != ";" {
+		fmt.Fprintf(&b, " endDelimiter:%s", delimiter)
+	}
+	if meta.NoTransaction {
+		b.WriteString(" runInTransaction:false")
+	}
+	if len(meta.Tags) > 0 {
+		fmt.Fprintf(&b, " labels:%s", strings.Join(meta.Tags, ","))
+	}
+	b.WriteString("\n")
+	if meta.Description != "" {
+		fmt.Fprintf(&b, "--comment: %s\n", meta.Description)
+	}
+	for _, stmt := range mig.Up {
+		b.WriteString(liquibaseStatement(stmt, delimiter) + "\n")
+	}
+	if mig.Reversible {
+		if len(mig.Down) == 0 {
+			b.WriteString("--rollback empty\n")
+		}
+		for _, stmt := range mig.Down {
+			for _, line := range strings.Split(liquibaseStatement(stmt, delimiter), "\n") {
+				b.WriteString("--rollback " + line + "\n")
+			}
+		}
+	}
+	return []file{{mig.FileName(), b.String()}}, nil
+}
+
+func liquibaseStatement(stmt, delimiter string) string {
+	stmt = strings.TrimSpace(stmt)
+	if delimiter == ";" {
+		return terminated(stmt)
+	}
+	return strings.TrimSuffix(stmt, ";") + delimiter
+}
@@ -0,0 +1,63 @@
+package interop
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLiquibaseRead(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"001_users.sql": "--liquibase formatted sql\n\n" +
+			"--changeset ana:create-users labels:core,auth runInTransaction:false\n" +
+			"--comment: users table\n" +
+			"CREATE TABLE users (id INT);\n" +
+			"--rollback DROP TABLE users;\n\n" +
+			"--changeset ana:seed\n" +
+			"--preconditions onFail:MARK_RAN\n" +
+			"INSERT INTO users VALUES (1);\n" +
+			"--rollback not required\n",
+		"002_routines.sql": "--liquibase formatted sql\n" +
+			"--changeset bob:proc endDelimiter://\n" +
+			"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\nEND//\n\n" +
+			"--changeset bob:trigger splitStatements:false\n" +
+			"CREATE TRIGGER tr BEFORE INSERT ON users FOR EACH ROW SET NEW.id = NEW.id;\n",
+		"003_notes.sql": "-- plain SQL\nSELECT 1;\n",
+	})
+	srcs, warnings, err := liquibase{}.read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type summary struct {
+		Version, ID, Author, Description string
+		Tags                             []string
+		NoTransaction, HasDown           bool
+	}
+	var got []summary
+	for _, src := range srcs {
+		got = append(got, summary{src.Version, src.ID, src.Metadata.Author, src.Metadata.Description, src.Metadata.Tags, src.Metadata.NoTransaction, src.HasDown})
+	}
+	want := []summary{
+		{"00000000000001", "ana:create-users", "ana", "users table", []string{"core", "auth"}, true, true},
+		{"00000000000002", "ana:seed", "ana", "seed", nil, false, true},
+		{"00000000000003", "bob:proc", "bob", "proc", nil, false, false},
+		{"00000000000004", "bob:trigger", "bob", "trigger", nil, false, false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read\n%+v\nwant\n%+v", got, want)
+	}
+	if srcs[0].Down != "DROP TABLE users;" || srcs[1].Down != "" {
+		t.Errorf("rollbacks %q and %q", srcs[0].Down, srcs[1].Down)
+	}
+	if !strings.HasPrefix(srcs[2].Up, "DELIMITER //\n") || !strings.HasSuffix(srcs[2].Up, "\nDELIMITER ;") {
+		t.Errorf("endDelimiter changeset reads %q", srcs[2].Up)
+	}
+	if !strings.HasPrefix(srcs[3].Up, "-- +dbpivot StatementBegin\n") {
+		t.Errorf("splitStatements:false changeset reads %q", srcs[3].Up)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("warnings %q, want the precondition and 003_notes.sql", warnings)
+	}
+}
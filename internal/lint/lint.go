@@ -0,0 +1,149 @@
+// Package lint inspects migrations for statements that are risky to run
+// against a live database or that break the code still running against it.
+package lint
+
+import (
+	"db-pivot/internal/migration"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity is how serious a finding is.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+	// SeverityOff disables a rule.
+	SeverityOff Severity = "off"
+)
+
+// ParseSeverity reads a severity as written in the config file.
+func ParseSeverity(s string) (Severity, error) {
+	switch severity := Severity(strings.ToLower(s)); severity {
+	case SeverityError, SeverityWarning, SeverityInfo, SeverityOff:
+		return severity, nil
+	}
+	return "", fmt.Errorf("unknown severity %q (want error, warning, info or off)", s)
+}
+
+// Finding is a problem a rule found in a migration.
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	// File is the migration file, empty for the pending changes.
+	File    string `json:"file,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Line is the line of File the statement starts on, zero when the
+	// finding concerns the whole file.
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// Target is a migration to lint.
+type Target struct {
+	Migration migration.Migration
+	// File is the path findings are reported against.
+	File string
+	// Pending marks the migration rendered from the changes migrate would
+	// generate, which has no file yet.
+	Pending bool
+}
+
+// Line returns the line of the migration file stmt starts on, or zero when
+// it cannot be found.
+func (t Target) Line(stmt string) int {
+	first := strings.TrimSpace(strings.SplitN(strings.TrimSpace(stmt), "\n", 2)[0])
+	i := strings.Index(t.Migration.UpScript, first)
+	if first == "" || i < 0 {
+		return 0
+	}
+	return strings.Count(t.Migration.UpScript[:i], "\n") + 1
+}
+
+// Project is what rules know besides the migration they check.
+type Project struct {
+	// Schema is the latest snapshot; empty without one.
+	Schema map[string]interface{}
+}
+
+// Rule checks one migration at a time. Check only sets the Line and
+// Message of its findings; Run fills in the rest.
+type Rule struct {
+	// ID names the rule in the config file and in reports, e.g.
+	// "missing-down".
+	ID          string
+	Description string
+	// Severity applies unless the project config overrides it.
+	Severity Severity
+	Check    func(project *Project, target Target) []Finding
+}
+
+var rules = builtinRules()
+
+// Register adds a rule to the ones Run checks. It is meant to be called
+// from init functions and panics if the ID is empty or already taken.
+func Register(rule Rule) {
+	if rule.ID == "" || rule.Check == nil {
+		panic("lint: rule without an ID or Check")
+	}
+	for _, r := range rules {
+		if r.ID == rule.ID {
+			panic(fmt.Sprintf("lint: rule %s registered twice", rule.ID))
+		}
+	}
+	rules = append(rules, rule)
+}
+
+// Rules returns the registered rules ordered by ID.
+func Rules() []Rule {
+	sorted := append([]Rule(nil), rules...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+// Run checks every target with every rule that severities does not turn
+// off. severities overrides the default severity of rules by ID. Findings
+// come in the order of the targets, then by line.
+func Run(project *Project, targets []Target, severities map[string]Severity) ([]Finding, error) {
+	known := make(map[string]bool)
+	for _, rule := range rules {
+		known[rule.ID] = true
+	}
+	for id := range severities {
+		if !known[id] {
+			return nil, fmt.Errorf("unknown lint rule %q", id)
+		}
+	}
+
+	var findings []Finding
+	for _, target := range targets {
+		var found []Finding
+		for _, rule := range Rules() {
+			severity := rule.Severity
+			if s, ok := severities[rule.ID]; ok {
+				severity = s
+			}
+			if severity == SeverityOff {
+				continue
+			}
+			for _, f := range rule.Check(project, target) {
+				f.Rule, f.Severity = rule.ID, severity
+				f.File = target.File
+				if !target.Pending {
+					f.Version = target.Migration.Version
+				}
+				found = append(found, f)
+			}
+		}
+		sort.SliceStable(found, func(i, j int) bool {
+			return found[i].Line < found[j].Line
+		})
+		findings = append(findings, found...)
+	}
+	return findings, nil
+}
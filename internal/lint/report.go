@@ -0,0 +1,155 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var reporters = map[string]func(w io.Writer, findings []Finding) error{
+	"human": writeHuman,
+	"json":  writeJSON,
+	"sarif": writeSARIF,
+}
+
+// Formats lists the report formats of Write.
+func Formats() []string {
+	names := make([]string, 0, len(reporters))
+	for name := range reporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Write reports findings to w in format: "human" for one line per finding,
+// "json", or "sarif" for code scanning tools.
+func Write(w io.Writer, format string, findings []Finding) error {
+	report, ok := reporters[format]
+	if !ok {
+		return fmt.Errorf("unknown report format %q (want one of %s)", format, strings.Join(Formats(), ", "))
+	}
+	return report(w, findings)
+}
+
+// pendingLocation names the pending changes in reports.
+const pendingLocation = "(pending changes)"
+
+func writeHuman(w io.Writer, findings []Finding) error {
+	counts := make(map[Severity]int)
+	for _, f := range findings {
+		location := f.File
+		switch {
+		case location == "":
+			location = pendingLocation
+		case f.Line > 0:
+			location = fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s: %s [%s]\n", location, f.Severity, f.Message, f.Rule); err != nil {
+			return err
+		}
+		counts[f.Severity]++
+	}
+	_, err := fmt.Fprintf(w, "%d errors, %d warnings, %d infos\n", counts[SeverityError], counts[SeverityWarning], counts[SeverityInfo])
+	return err
+}
+
+func writeJSON(w io.Writer, findings []Finding) error {
+	if findings == nil {
+		findings = []Finding{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Findings []Finding `json:"findings"`
+	}{findings})
+}
+
+// SARIF 2.1.0 documents, as read by code scanning tools, reduced to the
+// properties dbpivot fills in.
+type (
+	sarifLog struct {
+		Version string     `json:"version"`
+		Schema  string     `json:"$schema"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name  string      `json:"name"`
+		Rules []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID                   string       `json:"id"`
+		ShortDescription     sarifMessage `json:"shortDescription"`
+		DefaultConfiguration struct {
+			Level string `json:"level"`
+		} `json:"defaultConfiguration"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations,omitempty"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifLocation struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region *sarifRegion `json:"region,omitempty"`
+		} `json:"physicalLocation"`
+	}
+	sarifRegion struct {
+		StartLine int `json:"startLine"`
+	}
+)
+
+// sarifLevels maps severities to SARIF levels.
+var sarifLevels = map[Severity]string{
+	SeverityError:   "error",
+	SeverityWarning: "warning",
+	SeverityInfo:    "note",
+	SeverityOff:     "none",
+}
+
+func writeSARIF(w io.Writer, findings []Finding) error {
+	run := sarifRun{Tool: sarifTool{Driver: sarifDriver{Name: "dbpivot"}}, Results: []sarifResult{}}
+	for _, rule := range Rules() {
+		r := sarifRule{ID: rule.ID, ShortDescription: sarifMessage{rule.Description}}
+		r.DefaultConfiguration.Level = sarifLevels[rule.Severity]
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, r)
+	}
+	for _, f := range findings {
+		result := sarifResult{RuleID: f.Rule, Level: sarifLevels[f.Severity], Message: sarifMessage{f.Message}}
+		if f.File == "" {
+			result.Message.Text = pendingLocation + ": " + f.Message
+		} else {
+			var location sarifLocation
+			location.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(f.File)
+			if f.Line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line}
+			}
+			result.Locations = []sarifLocation{location}
+		}
+		run.Results = append(run.Results, result)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	})
+}
@@ -0,0 +1,579 @@
+package lint
+
+import (
+	"db-pivot/internal/migration"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+func builtinRules() []Rule {
+	return []Rule{
+		{
+			ID:          "not-null-without-default",
+			Description: "A new or nullable column of an existing table becomes NOT NULL without a DEFAULT",
+			Severity:    SeverityError,
+			Check:       checkNotNullWithoutDefault,
+		},
+		{
+			ID:          "drop-column-in-view",
+			Description: "A dropped column is still used by a view",
+			Severity:    SeverityError,
+			Check:       checkDropColumnInView,
+		},
+		{
+			ID:          "missing-down",
+			Description: "The migration has no Down statements and cannot be rolled back",
+			Severity:    SeverityWarning,
+			Check:       checkMissingDown,
+		},
+		{
+			ID:          "non-idempotent",
+			Description: "The statement fails or duplicates rows when run a second time",
+			Severity:    SeverityInfo,
+			Check:       checkNonIdempotent,
+		},
+		{
+			ID:          "incompatible-rename",
+			Description: "A table or column is renamed, breaking code that uses the old name",
+			Severity:    SeverityWarning,
+			Check:       checkIncompatibleRename,
+		},
+		{
+			ID:          "unindexed-foreign-key",
+			Description: "A foreign key has no index declared on its columns",
+			Severity:    SeverityWarning,
+			Check:       checkUnindexedForeignKey,
+		},
+		{
+			ID:          "reserved-word",
+			Description: "A table, column, view or index is named after a MySQL reserved word",
+			Severity:    SeverityWarning,
+			Check:       checkReservedWord,
+		},
+	}
+}
+
+const (
+	identifier    = "(`[^`]+`|[\\w$]+)"
+	qualifiedName = "(?:" + identifier + "\\.)?" + identifier
+)
+
+var (
+	createTableStmt = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:TEMPORARY\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?` + qualifiedName + `\s*\(`)
+	createStmt      = regexp.MustCompile(`(?is)^\s*CREATE\s+(OR\s+REPLACE\s+)?(?:ALGORITHM\s*=\s*\w+\s+)?(?:DEFINER\s*=\s*\S+\s+)?(?:SQL\s+SECURITY\s+\w+\s+)?(?:TEMPORARY\s+)?(TABLE|VIEW|PROCEDURE|FUNCTION|TRIGGER|EVENT)\s+(IF\s+NOT\s+EXISTS\s+)?` + qualifiedName)
+	dropStmt        = regexp.MustCompile(`(?is)^\s*DROP\s+(?:TEMPORARY\s+)?(TABLE|VIEW|PROCEDURE|FUNCTION|TRIGGER|EVENT)\s+(IF\s+EXISTS\s+)?` + qualifiedName)
+	createIndexStmt = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:UNIQUE\s+|FULLTEXT\s+|SPATIAL\s+)?INDEX\s+` + identifier + `\s+ON\s+` + qualifiedName + `\s*\(`)
+	insertStmt      = regexp.MustCompile(`(?is)^\s*INSERT\s+(IGNORE\s+)?(?:INTO\s+)?` + qualifiedName)
+	renameTableStmt = regexp.MustCompile(`(?is)^\s*RENAME\s+TABLE\s+(.+?)[\s;]*$`)
+	renamePair      = regexp.MustCompile(`(?is)^` + qualifiedName + `\s+TO\s+` + qualifiedName + `$`)
+
+	addPrefix    = regexp.MustCompile(`(?i)^ADD\s+(?:COLUMN\s+)?`)
+	addColumn    = regexp.MustCompile(`(?is)^ADD\s+(?:COLUMN\s+)?` + identifier + `\s+(.+)$`)
+	modifyColumn = regexp.MustCompile(`(?is)^MODIFY\s+(?:COLUMN\s+)?` + identifier + `\s+(.+)$`)
+	changeColumn = regexp.MustCompile(`(?is)^CHANGE\s+(?:COLUMN\s+)?` + identifier + `\s+` + identifier + `\s+(.+)$`)
+	dropColumn   = regexp.MustCompile(`(?is)^DROP\s+(?:COLUMN\s+)?` + identifier + `$`)
+	renameColumn = regexp.MustCompile(`(?is)^RENAME\s+COLUMN\s+` + identifier + `\s+TO\s+` + identifier + `$`)
+	renameTo     = regexp.MustCompile(`(?is)^RENAME\s+(?:TO\s+|AS\s+)?` + qualifiedName + `$`)
+	addIndex     = regexp.MustCompile(`(?is)^(?:ADD\s+)?(?:CONSTRAINT\s+(?:` + identifier + `\s+)?)?(?:PRIMARY\s+KEY|UNIQUE(?:\s+(?:KEY|INDEX))?|KEY|INDEX)\s*` + identifier + `?\s*(?:USING\s+\w+\s*)?\(`)
+	foreignKey   = regexp.MustCompile(`(?is)^(?:ADD\s+)?(?:CONSTRAINT\s+` + identifier + `?\s*)?FOREIGN\s+KEY\s*` + identifier + `?\s*\(`)
+)
+
+// definitionKeywords start the clauses of CREATE and ALTER TABLE that are
+// not column definitions.
+var definitionKeywords = map[string]bool{
+	"PRIMARY": true, "KEY": true, "INDEX": true, "UNIQUE": true, "FULLTEXT": true, "SPATIAL": true,
+	"CONSTRAINT": true, "FOREIGN": true, "CHECK": true, "PARTITION": true, "COLUMN": true,
+}
+
+func checkNotNullWithoutDefault(project *Project, target Target) []Finding {
+	created := createdTables(target)
+	var findings []Finding
+	for _, stmt := range target.Migration.Up {
+		schema, table, clauses, ok := migration.SplitAlterTable(stmt)
+		if !ok || created[tableKey(schema, table)] {
+			continue
+		}
+		for _, clause := range clauses {
+			var column, definition, action string
+			if m := addColumn.FindStringSubmatch(clause); m != nil && !definitionKeywords[strings.ToUpper(m[1])] {
+				column, definition, action = m[1], m[2], "adds NOT NULL column"
+			} else if m := modifyColumn.FindStringSubmatch(clause); m != nil {
+				column, definition, action = m[1], m[2], "makes column"
+			} else if m := changeColumn.FindStringSubmatch(clause); m != nil {
+				column, definition, action = m[1], m[3], "makes column"
+			} else {
+				continue
+			}
+			upper := strings.ToUpper(definition)
+			if !strings.Contains(upper, "NOT NULL") || containsAny(upper, "DEFAULT", "AUTO_INCREMENT", "GENERATED", " AS (") {
+				continue
+			}
+			// A column that is already NOT NULL, as when a generated
+			// migration widens it, or that the snapshot does not know
+			// keeps whatever its rows hold.
+			if nullable, known := project.nullable(tableKey(schema, table), unquote(column)); action == "makes column" && !(known && nullable) {
+				continue
+			}
+			message := fmt.Sprintf("%s %s.%s without a DEFAULT; existing rows get the implicit default of its type and inserts that leave it out fail",
+				action, table, unquote(column))
+			if action == "makes column" {
+				message = fmt.Sprintf("makes column %s.%s NOT NULL without a DEFAULT; the statement fails while any row holds NULL and inserts that leave it out fail",
+					table, unquote(column))
+			}
+			findings = append(findings, Finding{Line: target.Line(stmt), Message: message})
+		}
+	}
+	return findings
+}
+
+func checkDropColumnInView(project *Project, target Target) []Finding {
+	views := project.views()
+	// Views the migration itself redefines or drops are up to it.
+	for _, stmt := range target.Migration.Up {
+		if m := createStmt.FindStringSubmatch(stmt); m != nil && strings.EqualFold(m[2], "VIEW") {
+			delete(views, tableKey(unquote(m[4]), unquote(m[5])))
+		}
+		if m := dropStmt.FindStringSubmatch(stmt); m != nil && strings.EqualFold(m[1], "VIEW") {
+			delete(views, tableKey(unquote(m[3]), unquote(m[4])))
+		}
+	}
+
+	var findings []Finding
+	for _, stmt := range target.Migration.Up {
+		schema, table, clauses, ok := migration.SplitAlterTable(stmt)
+		if !ok {
+			continue
+		}
+		for _, clause := range clauses {
+			m := dropColumn.FindStringSubmatch(clause)
+			if m == nil || definitionKeywords[strings.ToUpper(m[1])] {
+				continue
+			}
+			column := unquote(m[1])
+			for _, name := range sortedKeys(views) {
+				view := views[name]
+				if !view.uses(tableKey(schema, table), table) || !mentions(view.definition, column) {
+					continue
+				}
+				findings = append(findings, Finding{
+					Line:    target.Line(stmt),
+					Message: fmt.Sprintf("drops column %s.%s, which view %s still uses; redefine or drop the view in the same migration", table, column, name),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+func checkMissingDown(project *Project, target Target) []Finding {
+	switch {
+	case !target.Migration.Reversible:
+		return []Finding{{Message: "the migration has no Down section, so it cannot be rolled back"}}
+	case len(target.Migration.Down) == 0:
+		return []Finding{{Message: "the migration has an empty Down section, so rolling it back changes nothing"}}
+	}
+	return nil
+}
+
+func checkNonIdempotent(project *Project, target Target) []Finding {
+	var findings []Finding
+	// Objects dropped with IF EXISTS before they are created again.
+	dropped := make(map[string]bool)
+	for _, stmt := range target.Migration.Up {
+		if m := dropStmt.FindStringSubmatch(stmt); m != nil {
+			kind, name := strings.ToUpper(m[1]), tableKey(unquote(m[3]), unquote(m[4]))
+			if m[2] != "" {
+				dropped[kind+" "+name] = true
+				continue
+			}
+			findings = append(findings, Finding{
+				Line:    target.Line(stmt),
+				Message: fmt.Sprintf("DROP %s %s fails when run again; use DROP %s IF EXISTS", kind, name, kind),
+			})
+			continue
+		}
+		if m := createStmt.FindStringSubmatch(stmt); m != nil {
+			kind, name := strings.ToUpper(m[2]), tableKey(unquote(m[4]), unquote(m[5]))
+			if m[1] != "" || m[3] != "" || dropped[kind+" "+name] {
+				continue
+			}
+			fix := fmt.Sprintf("use CREATE %s IF NOT EXISTS", kind)
+			switch kind {
+			case "VIEW":
+				fix = "use CREATE OR REPLACE VIEW"
+			case "PROCEDURE", "FUNCTION", "TRIGGER", "EVENT":
+				fix = fmt.Sprintf("drop it first with DROP %s IF EXISTS", kind)
+			}
+			findings = append(findings, Finding{
+				Line:    target.Line(stmt),
+				Message: fmt.Sprintf("CREATE %s %s fails when run again; %s", kind, name, fix),
+			})
+			continue
+		}
+		if m := insertStmt.FindStringSubmatch(stmt); m != nil && m[1] == "" && !strings.Contains(strings.ToUpper(stmt), "ON DUPLICATE KEY") {
+			findings = append(findings, Finding{
+				Line:    target.Line(stmt),
+				Message: fmt.Sprintf("INSERT into %s adds the rows again, or fails on a unique key, when run again; use INSERT IGNORE or ON DUPLICATE KEY UPDATE", tableKey(unquote(m[2]), unquote(m[3]))),
+			})
+		}
+	}
+	return findings
+}
+
+func checkIncompatibleRename(project *Project, target Target) []Finding {
+	var findings []Finding
+	renamedTable := func(stmt, from, to string) {
+		findings = append(findings, Finding{
+			Line:    target.Line(stmt),
+			Message: fmt.Sprintf("renames table %s to %s; code still using %s fails until it is deployed, so add a view under the old name or rename in a later release", from, to, from),
+		})
+	}
+	renamedColumn := func(stmt, table, from, to string) {
+		findings = append(findings, Finding{
+			Line:    target.Line(stmt),
+			Message: fmt.Sprintf("renames column %s.%s to %s; code still using %s fails, so add %s, copy the data and drop %s once nothing reads it", table, from, to, from, to, from),
+		})
+	}
+
+	for _, stmt := range target.Migration.Up {
+		if m := renameTableStmt.FindStringSubmatch(stmt); m != nil {
+			for _, pair := range migration.SplitClauses(m[1]) {
+				if p := renamePair.FindStringSubmatch(pair); p != nil {
+					renamedTable(stmt, tableKey(unquote(p[1]), unquote(p[2])), tableKey(unquote(p[3]), unquote(p[4])))
+				}
+			}
+			continue
+		}
+		schema, table, clauses, ok := migration.SplitAlterTable(stmt)
+		if !ok {
+			continue
+		}
+		for _, clause := range clauses {
+			if m := renameColumn.FindStringSubmatch(clause); m != nil {
+				renamedColumn(stmt, table, unquote(m[1]), unquote(m[2]))
+			} else if m := changeColumn.FindStringSubmatch(clause); m != nil && !strings.EqualFold(unquote(m[1]), unquote(m[2])) {
+				renamedColumn(stmt, table, unquote(m[1]), unquote(m[2]))
+			} else if m := renameTo.FindStringSubmatch(clause); m != nil && !definitionKeywords[strings.ToUpper(m[2])] {
+				renamedTable(stmt, tableKey(schema, table), tableKey(unquote(m[1]), unquote(m[2])))
+			}
+		}
+	}
+	return findings
+}
+
+func checkUnindexedForeignKey(project *Project, target Target) []Finding {
+	indexes := project.indexes()
+	type fk struct {
+		stmt, table string
+		columns     []string
+	}
+	var fks []fk
+	// Indexes count wherever the migration declares them, even after the
+	// foreign key.
+	declare := func(stmt, table, clause string) {
+		if m := foreignKey.FindStringIndex(clause); m != nil {
+			fks = append(fks, fk{stmt, table, columnList(clause[m[1]-1:])})
+		} else if m := addIndex.FindStringIndex(clause); m != nil {
+			indexes[table] = append(indexes[table], columnList(clause[m[1]-1:]))
+		}
+	}
+	for _, stmt := range target.Migration.Up {
+		if schema, table, definitions, ok := createTableDefinitions(stmt); ok {
+			for _, definition := range definitions {
+				declare(stmt, tableKey(schema, table), definition)
+			}
+		} else if m := createIndexStmt.FindStringSubmatchIndex(stmt); m != nil {
+			table := tableKey(unquote(substring(stmt, m, 2)), unquote(substring(stmt, m, 3)))
+			indexes[table] = append(indexes[table], columnList(stmt[m[1]-1:]))
+		} else if schema, table, clauses, ok := migration.SplitAlterTable(stmt); ok {
+			for _, clause := range clauses {
+				declare(stmt, tableKey(schema, table), clause)
+			}
+		}
+	}
+
+	var findings []Finding
+	for _, key := range fks {
+		if indexed(indexes[key.table], key.columns) {
+			continue
+		}
+		columns := strings.Join(key.columns, ", ")
+		findings = append(findings, Finding{
+			Line: target.Line(key.stmt),
+			Message: fmt.Sprintf("foreign key on %s (%s) has no index declared on its columns; MySQL adds one implicitly under the constraint's name, so declare KEY (%s) to have it named and versioned with the schema",
+				key.table, columns, columns),
+		})
+	}
+	return findings
+}
+
+func checkReservedWord(project *Project, target Target) []Finding {
+	var findings []Finding
+	check := func(stmt, what, qualifier, name string) {
+		if reserved[strings.ToUpper(unquote(name))] {
+			findings = append(findings, Finding{
+				Line:    target.Line(stmt),
+				Message: fmt.Sprintf("%s %s%s is named after reserved word %s; every statement using it must quote it", what, qualifier, unquote(name), strings.ToUpper(unquote(name))),
+			})
+		}
+	}
+	column := func(stmt, table, definition string) {
+		fields := strings.Fields(definition)
+		if len(fields) > 1 && !definitionKeywords[strings.ToUpper(fields[0])] {
+			check(stmt, "column", table+".", fields[0])
+		}
+	}
+
+	for _, stmt := range target.Migration.Up {
+		if schema, table, definitions, ok := createTableDefinitions(stmt); ok {
+			check(stmt, "table", "", table)
+			for _, definition := range definitions {
+				column(stmt, tableKey(schema, table), definition)
+			}
+			continue
+		}
+		if m := createStmt.FindStringSubmatch(stmt); m != nil && strings.EqualFold(m[2], "VIEW") {
+			check(stmt, "view", "", m[5])
+			continue
+		}
+		if m := createIndexStmt.FindStringSubmatch(stmt); m != nil {
+			check(stmt, "index", "", m[1])
+			continue
+		}
+		if m := renameTableStmt.FindStringSubmatch(stmt); m != nil {
+			for _, pair := range migration.SplitClauses(m[1]) {
+				if p := renamePair.FindStringSubmatch(pair); p != nil {
+					check(stmt, "table", "", p[4])
+				}
+			}
+			continue
+		}
+		_, table, clauses, ok := migration.SplitAlterTable(stmt)
+		if !ok {
+			continue
+		}
+		for _, clause := range clauses {
+			switch {
+			case addColumn.MatchString(clause):
+				column(stmt, table, addPrefix.ReplaceAllString(clause, ""))
+			case changeColumn.MatchString(clause):
+				check(stmt, "column", table+".", changeColumn.FindStringSubmatch(clause)[2])
+			case renameColumn.MatchString(clause):
+				check(stmt, "column", table+".", renameColumn.FindStringSubmatch(clause)[2])
+			case renameTo.MatchString(clause):
+				if m := renameTo.FindStringSubmatch(clause); !definitionKeywords[strings.ToUpper(m[2])] {
+					check(stmt, "table", "", m[2])
+				}
+			}
+			if m := addIndex.FindStringSubmatch(clause); m != nil && m[2] != "" {
+				check(stmt, "index", "", m[2])
+			}
+		}
+	}
+	return findings
+}
+
+// createdTables lists the tables the migration creates.
+func createdTables(target Target) map[string]bool {
+	created := make(map[string]bool)
+	for _, stmt := range target.Migration.Up {
+		if m := createStmt.FindStringSubmatch(stmt); m != nil && strings.EqualFold(m[2], "TABLE") {
+			created[tableKey(unquote(m[4]), unquote(m[5]))] = true
+		}
+	}
+	return created
+}
+
+// createTableDefinitions splits a CREATE TABLE statement into its table and
+// the column, index and constraint definitions between its parentheses.
+func createTableDefinitions(stmt string) (schema, table string, definitions []string, ok bool) {
+	m := createTableStmt.FindStringSubmatchIndex(stmt)
+	if m == nil {
+		return "", "", nil, false
+	}
+	body := parenthesized(stmt[m[1]-1:])
+	return unquote(substring(stmt, m, 1)), unquote(substring(stmt, m, 2)), migration.SplitClauses(body), true
+}
+
+// parenthesized returns what is inside the parentheses s starts with.
+func parenthesized(s string) string {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return s[1:i]
+			}
+		}
+	}
+	return strings.TrimPrefix(s, "(")
+}
+
+// columnList reads the columns of an index or key from the parenthesized
+// list s starts with, without prefix lengths or sort order.
+func columnList(s string) []string {
+	var columns []string
+	for _, part := range migration.SplitClauses(parenthesized(s)) {
+		if fields := strings.Fields(part); len(fields) > 0 {
+			columns = append(columns, normalizeColumn(fields[0]))
+		}
+	}
+	return columns
+}
+
+func normalizeColumn(column string) string {
+	if i := strings.IndexByte(column, '('); i > 0 {
+		column = column[:i]
+	}
+	return strings.ToLower(unquote(column))
+}
+
+// indexed tells whether one of indexes starts with columns.
+func indexed(indexes [][]string, columns []string) bool {
+	for _, index := range indexes {
+		if len(index) < len(columns) {
+			continue
+		}
+		match := true
+		for i, column := range columns {
+			if index[i] != column {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// view is a view of the latest snapshot.
+type view struct {
+	definition string
+	dependsOn  []string
+}
+
+// uses tells whether the view reads from the table keyed key.
+func (v view) uses(key, table string) bool {
+	for _, dep := range v.dependsOn {
+		if strings.EqualFold(dep, key) {
+			return true
+		}
+	}
+	return len(v.dependsOn) == 0 && mentions(v.definition, table)
+}
+
+func (p *Project) views() map[string]view {
+	views := make(map[string]view)
+	for name, data := range p.Schema {
+		obj, ok := data.(map[string]interface{})
+		if !ok || obj["type"] != "view" {
+			continue
+		}
+		definition, _ := obj["definition"].(string)
+		views[name] = view{definition: definition, dependsOn: stringList(obj["dependsOn"])}
+	}
+	return views
+}
+
+// nullable tells whether a column of the latest snapshot accepts NULL.
+// known is false when the snapshot has no such column.
+func (p *Project) nullable(table, column string) (nullable, known bool) {
+	obj, _ := p.Schema[table].(map[string]interface{})
+	columns, _ := obj["columns"].(map[string]interface{})
+	for name, data := range columns {
+		if strings.EqualFold(name, column) {
+			def, _ := data.(map[string]interface{})
+			nullable, known = def["null"].(bool)
+			return nullable, known
+		}
+	}
+	return false, false
+}
+
+// indexes returns the columns of every index in the latest snapshot, keyed
+// by table.
+func (p *Project) indexes() map[string][][]string {
+	indexes := make(map[string][][]string)
+	for name, data := range p.Schema {
+		obj, ok := data.(map[string]interface{})
+		if !ok || obj["type"] != nil {
+			continue
+		}
+		tableIndexes, _ := obj["indexes"].(map[string]interface{})
+		for _, index := range tableIndexes {
+			def, _ := index.(map[string]interface{})
+			var columns []string
+			for _, column := range stringList(def["columns"]) {
+				columns = append(columns, normalizeColumn(strings.TrimSuffix(column, " DESC")))
+			}
+			indexes[name] = append(indexes[name], columns)
+		}
+	}
+	return indexes
+}
+
+// mentions tells whether sql uses name as an identifier.
+func mentions(sql, name string) bool {
+	return regexp.MustCompile(`(?i)(^|[^\w$])` + regexp.QuoteMeta(name) + `([^\w$]|$)`).MatchString(sql)
+}
+
+func tableKey(schema, table string) string {
+	if schema == "" {
+		return table
+	}
+	return schema + "." + table
+}
+
+func unquote(name string) string {
+	return strings.Trim(name, "`")
+}
+
+// substring returns submatch n of the match indexes m of s.
+func substring(s string, m []int, n int) string {
+	if m[2*n] < 0 {
+		return ""
+	}
+	return s[m[2*n]:m[2*n+1]]
+}
+
+func containsAny(s string, substrings ...string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		list = append(list, fmt.Sprint(item))
+	}
+	return list
+}
+
+func sortedKeys(m map[string]view) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,290 @@
+package lint
+
+import (
+	"bytes"
+	"db-pivot/internal/migration"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// snapshot is the latest snapshot the rule tests lint against.
+const snapshot = `{
+	"users": {
+		"columns": {
+			"id": {"type": "int", "null": false, "extra": "auto_increment"},
+			"name": {"type": "varchar(100)", "null": false},
+			"email": {"type": "varchar(255)", "null": true}
+		},
+		"indexes": {"PRIMARY": {"columns": ["id"]}}
+	},
+	"orders": {
+		"columns": {
+			"id": {"type": "int", "null": false},
+			"user_id": {"type": "int", "null": true}
+		},
+		"indexes": {"PRIMARY": {"columns": ["id"]}}
+	},
+	"user_emails": {
+		"type": "view",
+		"definition": "select id, email from users",
+		"dependsOn": ["users"]
+	}
+}`
+
+func testProject(t *testing.T) *Project {
+	t.Helper()
+	project := &Project{}
+	if err := json.Unmarshal([]byte(snapshot), &project.Schema); err != nil {
+		t.Fatal(err)
+	}
+	return project
+}
+
+// testTarget is a reversible migration running up.
+func testTarget(up ...string) Target {
+	return Target{
+		File: "0002_change.sql",
+		Migration: migration.Migration{
+			Version:    "0002",
+			UpScript:   strings.Join(up, "\n") + "\n",
+			Up:         up,
+			Down:       []string{"SELECT 1;"},
+			Reversible: true,
+		},
+	}
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(project *Project, target Target) []Finding
+		up    []string
+		// want are substrings of the messages found, in order.
+		want []string
+	}{
+		{
+			name:  "NOT NULL column added without a default",
+			check: checkNotNullWithoutDefault,
+			up:    []string{"ALTER TABLE users ADD nickname varchar(50) NOT NULL;"},
+			want:  []string{"adds NOT NULL column users.nickname"},
+		},
+		{
+			name:  "NOT NULL column added with a default",
+			check: checkNotNullWithoutDefault,
+			up:    []string{"ALTER TABLE users ADD nickname varchar(50) NOT NULL DEFAULT '';"},
+		},
+		{
+			name:  "nullable column made NOT NULL",
+			check: checkNotNullWithoutDefault,
+			up:    []string{"ALTER TABLE users MODIFY email varchar(255) NOT NULL;"},
+			want:  []string{"makes column users.email NOT NULL"},
+		},
+		{
+			name:  "nullable column renamed and made NOT NULL",
+			check: checkNotNullWithoutDefault,
+			up:    []string{"ALTER TABLE users CHANGE `email` mail varchar(255) NOT NULL;"},
+			want:  []string{"makes column users.email NOT NULL"},
+		},
+		{
+			name:  "NOT NULL column widened",
+			check: checkNotNullWithoutDefault,
+			up:    []string{"ALTER TABLE users MODIFY name varchar(200) NOT NULL, ALGORITHM=INPLACE, LOCK=NONE;"},
+		},
+		{
+			name:  "column missing from the snapshot",
+			check: checkNotNullWithoutDefault,
+			up:    []string{"ALTER TABLE invoices MODIFY total int NOT NULL;"},
+		},
+		{
+			name:  "table created by the migration",
+			check: checkNotNullWithoutDefault,
+			up: []string{
+				"CREATE TABLE tags (id int NOT NULL);",
+				"ALTER TABLE tags ADD name varchar(50) NOT NULL;",
+			},
+		},
+		{
+			name:  "column dropped while a view uses it",
+			check: checkDropColumnInView,
+			up:    []string{"ALTER TABLE users DROP COLUMN email;"},
+			want:  []string{"drops column users.email, which view user_emails still uses"},
+		},
+		{
+			name:  "column dropped with its view",
+			check: checkDropColumnInView,
+			up: []string{
+				"DROP VIEW user_emails;",
+				"ALTER TABLE users DROP COLUMN email;",
+			},
+		},
+		{
+			name:  "column no view uses dropped",
+			check: checkDropColumnInView,
+			up:    []string{"ALTER TABLE users DROP COLUMN name;"},
+		},
+		{
+			name:  "statements that fail when run again",
+			check: checkNonIdempotent,
+			up: []string{
+				"CREATE TABLE tags (id int);",
+				"DROP TABLE old_tags;",
+				"CREATE VIEW v AS SELECT 1;",
+				"INSERT INTO tags (id) VALUES (1);",
+			},
+			want: []string{
+				"CREATE TABLE tags fails when run again; use CREATE TABLE IF NOT EXISTS",
+				"DROP TABLE old_tags fails when run again",
+				"use CREATE OR REPLACE VIEW",
+				"INSERT into tags adds the rows again",
+			},
+		},
+		{
+			name:  "statements that can run again",
+			check: checkNonIdempotent,
+			up: []string{
+				"CREATE TABLE IF NOT EXISTS tags (id int);",
+				"DROP PROCEDURE IF EXISTS p;",
+				"CREATE PROCEDURE p() SELECT 1;",
+				"INSERT IGNORE INTO tags (id) VALUES (1);",
+				"INSERT INTO tags (id) VALUES (1) ON DUPLICATE KEY UPDATE id = id;",
+			},
+		},
+		{
+			name:  "renames",
+			check: checkIncompatibleRename,
+			up: []string{
+				"RENAME TABLE users TO accounts;",
+				"ALTER TABLE orders RENAME COLUMN user_id TO account_id;",
+				"ALTER TABLE orders CHANGE id order_id int;",
+				"ALTER TABLE orders CHANGE id id bigint;",
+			},
+			want: []string{
+				"renames table users to accounts",
+				"renames column orders.user_id to account_id",
+				"renames column orders.id to order_id",
+			},
+		},
+		{
+			name:  "foreign key without an index",
+			check: checkUnindexedForeignKey,
+			up:    []string{"ALTER TABLE orders ADD CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id);"},
+			want:  []string{"foreign key on orders (user_id) has no index"},
+		},
+		{
+			name:  "foreign key with an index declared after it",
+			check: checkUnindexedForeignKey,
+			up: []string{
+				"ALTER TABLE orders ADD CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id);",
+				"CREATE INDEX idx_user ON orders (user_id);",
+			},
+		},
+		{
+			name:  "foreign key in a created table",
+			check: checkUnindexedForeignKey,
+			up:    []string{"CREATE TABLE items (id int, order_id int, KEY (order_id), FOREIGN KEY (order_id) REFERENCES orders (id));"},
+		},
+		{
+			name:  "reserved words",
+			check: checkReservedWord,
+			up: []string{
+				"CREATE TABLE `order` (id int, `key` int);",
+				"ALTER TABLE users ADD `range` int, ADD INDEX `select` (name);",
+				"ALTER TABLE users ADD INDEX idx_name (name);",
+			},
+			want: []string{
+				"table order is named after reserved word ORDER",
+				"column order.key is named after reserved word KEY",
+				"column users.range is named after reserved word RANGE",
+				"index select is named after reserved word SELECT",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := tt.check(testProject(t), testTarget(tt.up...))
+			if len(findings) != len(tt.want) {
+				t.Fatalf("got %d findings %+v, want %d", len(findings), findings, len(tt.want))
+			}
+			for i, f := range findings {
+				if !strings.Contains(f.Message, tt.want[i]) {
+					t.Errorf("finding %d is %q, want it to contain %q", i, f.Message, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMissingDown(t *testing.T) {
+	target := testTarget("CREATE TABLE tags (id int);")
+	if findings := checkMissingDown(nil, target); len(findings) != 0 {
+		t.Errorf("reversible migration: %+v", findings)
+	}
+	target.Migration.Down = nil
+	if findings := checkMissingDown(nil, target); len(findings) != 1 || !strings.Contains(findings[0].Message, "empty Down section") {
+		t.Errorf("empty Down section: %+v", findings)
+	}
+	target.Migration.Reversible = false
+	if findings := checkMissingDown(nil, target); len(findings) != 1 || !strings.Contains(findings[0].Message, "no Down section") {
+		t.Errorf("no Down section: %+v", findings)
+	}
+}
+
+func TestRun(t *testing.T) {
+	target := testTarget(
+		"CREATE TABLE IF NOT EXISTS tags (id int);",
+		"ALTER TABLE users MODIFY email varchar(255) NOT NULL;",
+	)
+	findings, err := Run(testProject(t), []Target{target}, map[string]Severity{"not-null-without-default": SeverityWarning})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("got %+v, want one finding", findings)
+	}
+	want := Finding{Rule: "not-null-without-default", Severity: SeverityWarning, File: "0002_change.sql", Version: "0002", Line: 2}
+	if got := findings[0]; got.Rule != want.Rule || got.Severity != want.Severity || got.File != want.File || got.Version != want.Version || got.Line != want.Line {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	findings, err = Run(testProject(t), []Target{target}, map[string]Severity{"not-null-without-default": SeverityOff})
+	if err != nil || len(findings) != 0 {
+		t.Errorf("rule turned off: %+v, %v", findings, err)
+	}
+	if _, err := Run(testProject(t), nil, map[string]Severity{"no-such-rule": SeverityError}); err == nil {
+		t.Error("Run accepted an unknown rule")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	findings := []Finding{
+		{Rule: "missing-down", Severity: SeverityWarning, File: "0002_change.sql", Version: "0002", Message: "no Down section"},
+		{Rule: "non-idempotent", Severity: SeverityInfo, Line: 3, Message: "fails when run again"},
+	}
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"human", []string{
+			"0002_change.sql: warning: no Down section [missing-down]\n",
+			pendingLocation + ": info: fails when run again [non-idempotent]\n",
+			"0 errors, 1 warnings, 1 infos\n",
+		}},
+		{"json", []string{`"findings": [`, `"rule": "missing-down"`, `"line": 3`}},
+		{"sarif", []string{`"version": "2.1.0"`, `"ruleId": "missing-down"`, `"level": "warning"`, `"level": "note"`}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := Write(&buf, tt.format, findings); err != nil {
+			t.Fatalf("Write(%s): %v", tt.format, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("Write(%s) wrote\n%s\nwant it to contain %q", tt.format, buf.String(), want)
+			}
+		}
+	}
+	if err := Write(&bytes.Buffer{}, "xml", findings); err == nil {
+		t.Error("Write accepted an unknown format")
+	}
+}
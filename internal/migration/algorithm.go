@@ -0,0 +1,223 @@
+package migration
+
+import (
+	"db-pivot/internal/diff"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ALTER TABLE clauses that ask MySQL to change a table without copying it.
+// INSTANT only touches the data dictionary; INPLACE may rebuild the table
+// but keeps it writable. The server rejects a clause it cannot honour, and
+// apply then retries with a weaker one.
+const (
+	algorithmInstant = "ALGORITHM=INSTANT"
+	algorithmInplace = "ALGORITHM=INPLACE, LOCK=NONE"
+)
+
+// algorithmFor returns the clause the ALTER TABLE statements of change are
+// generated with, or a warning when MySQL can only make the change by
+// copying the table and blocking writes to it.
+func algorithmFor(change diff.Change) (clause, warning string) {
+	kind, table, member := splitObject(change.Object)
+	copies := func(what string) (string, string) {
+		return "", fmt.Sprintf("%s copies table %s and blocks writes to it while it runs", what, table)
+	}
+
+	switch kind {
+	case "column":
+		switch change.Type {
+		case "add":
+			if storedGenerated(change.After) {
+				return copies("adding stored generated column " + member)
+			}
+			return algorithmInstant, ""
+		case "remove":
+			return algorithmInstant, ""
+		case "modify":
+			clause, copied := modifyAlgorithm(change.Before, change.After)
+			if copied {
+				return copies("changing the type or length of column " + member)
+			}
+			return clause, ""
+		}
+	case "index":
+		definition := strings.ToUpper(change.After)
+		switch {
+		case change.Type != "remove" && (strings.HasPrefix(definition, "FULLTEXT") || strings.HasPrefix(definition, "SPATIAL")):
+			return copies("building index " + member)
+		case change.Type == "remove" && member == "PRIMARY":
+			return copies("dropping the primary key")
+		}
+		return algorithmInplace, ""
+	case "foreign_key":
+		if change.Type == "add" {
+			return copies("adding foreign key " + member)
+		}
+		return algorithmInplace, ""
+	case "check":
+		if change.Type == "remove" {
+			return algorithmInplace, ""
+		}
+		return copies("validating check constraint " + member)
+	case "option":
+		switch member {
+		case "engine", "charset":
+			return copies("changing the " + member)
+		case "comment":
+			return algorithmInstant, ""
+		}
+		return algorithmInplace, ""
+	}
+	return "", ""
+}
+
+var (
+	// defaultAttribute and commentAttribute match the DEFAULT and COMMENT
+	// parts of the column definitions the diff renders.
+	defaultAttribute = regexp.MustCompile(`(?i) DEFAULT (?:'(?:[^'\\]|\\.|'')*'|\(.*?\)|\S+)`)
+	commentAttribute = regexp.MustCompile(`(?i) COMMENT '(?:[^'\\]|\\.|'')*'`)
+	charsetAttribute = regexp.MustCompile(`(?i)\bCHARACTER SET (\w+)`)
+)
+
+// charsetBytes is the longest character, in bytes, of common character
+// sets.
+var charsetBytes = map[string]int64{
+	"ascii": 1, "latin1": 1, "binary": 1,
+	"utf8": 3, "utf8mb3": 3,
+	"utf8mb4": 4,
+}
+
+// modifyAlgorithm returns the clause a MODIFY from the column definition
+// before to after can run with, following the operations MySQL documents
+// as instant or in place. copied is set when MySQL copies the table; an
+// empty clause without it leaves the choice to the server.
+func modifyAlgorithm(before, after string) (clause string, copied bool) {
+	if before == "" || after == "" {
+		return "", false
+	}
+	b, a := columnType.FindStringSubmatch(before), columnType.FindStringSubmatch(after)
+	if b == nil || a == nil || !strings.EqualFold(b[1], a[1]) || (b[3] == "") != (a[3] == "") {
+		return "", true
+	}
+	// The attributes after the type, with and without the parts that
+	// change in place.
+	restBefore, restAfter := before[len(b[0]):], after[len(a[0]):]
+	strip := func(rest string) string {
+		return commentAttribute.ReplaceAllString(defaultAttribute.ReplaceAllString(rest, ""), "")
+	}
+	sameAttributes := strip(restBefore) == strip(restAfter)
+	sameComment := commentAttribute.FindString(restBefore) == commentAttribute.FindString(restAfter)
+
+	if !sameLength(b[1], b[2], a[2]) {
+		kind := strings.ToLower(b[1])
+		switch {
+		case !sameAttributes || !sameComment:
+			return "", false
+		case (kind == "enum" || kind == "set") && strings.HasPrefix(a[2], b[2]+","):
+			// Members added at the end keep the stored values.
+			return algorithmInstant, false
+		case kind == "varchar" || kind == "varbinary":
+			return varcharAlgorithm(kind, b[2], a[2], after)
+		}
+		return "", true
+	}
+	switch {
+	case sameAttributes && sameComment:
+		// Only the default differs.
+		return algorithmInstant, false
+	case sameAttributes:
+		return algorithmInplace, false
+	case strings.Replace(strip(restBefore), " NOT NULL", " NULL", 1) == strings.Replace(strip(restAfter), " NOT NULL", " NULL", 1):
+		// Changing whether the column accepts NULL rebuilds the table in
+		// place.
+		return algorithmInplace, false
+	}
+	return "", false
+}
+
+// varcharAlgorithm tells whether a VARCHAR or VARBINARY column can change
+// length in place: it must grow and keep the size of its length prefix,
+// one byte up to 255 bytes and two above. Without a character set in the
+// definition, both 1 and 4 bytes per character are considered.
+func varcharAlgorithm(kind, before, after, definition string) (clause string, copied bool) {
+	oldLength, err1 := strconv.ParseInt(strings.TrimSpace(before), 10, 64)
+	newLength, err2 := strconv.ParseInt(strings.TrimSpace(after), 10, 64)
+	if err1 != nil || err2 != nil {
+		return "", false
+	}
+	if newLength < oldLength {
+		return "", true
+	}
+	widths := []int64{1, 4}
+	if kind == "varbinary" {
+		widths = []int64{1}
+	} else if m := charsetAttribute.FindStringSubmatch(definition); m != nil && charsetBytes[strings.ToLower(m[1])] > 0 {
+		widths = []int64{charsetBytes[strings.ToLower(m[1])]}
+	}
+	same := 0
+	for _, width := range widths {
+		if (oldLength*width <= 255) == (newLength*width <= 255) {
+			same++
+		}
+	}
+	switch same {
+	case len(widths):
+		return algorithmInplace, false
+	case 0:
+		return "", true
+	}
+	return "", false
+}
+
+// withAlgorithm appends clause to the ALTER TABLE statements of script.
+// Partition clauses must come last in a statement, so statements that
+// carry one are left alone.
+func withAlgorithm(script, clause string) string {
+	if clause == "" {
+		return script
+	}
+	lines := strings.SplitAfter(script, "\n")
+	for i, line := range lines {
+		stmt := strings.TrimSuffix(line, "\n")
+		if !strings.HasPrefix(stmt, "ALTER TABLE ") || !strings.HasSuffix(stmt, ";") ||
+			strings.Contains(strings.ToUpper(stmt), "PARTITION") {
+			continue
+		}
+		lines[i] = strings.TrimSuffix(stmt, ";") + ", " + clause + ";" + strings.TrimPrefix(line, stmt)
+	}
+	return strings.Join(lines, "")
+}
+
+// splitObject splits objects such as "column:table.name" into their kind,
+// table and member. Objects of a whole table, like "partitioning:table",
+// have no member.
+func splitObject(object string) (kind, table, member string) {
+	kind, table, _ = strings.Cut(object, ":")
+	if kind == "table" || kind == "partitioning" {
+		return kind, table, ""
+	}
+	if i := strings.LastIndex(table, "."); i > 0 {
+		table, member = table[:i], table[i+1:]
+	}
+	return kind, table, member
+}
+
+// reversed is the change the down statements of change make.
+func reversed(change diff.Change) diff.Change {
+	switch change.Type {
+	case "add":
+		change.Type = "remove"
+	case "remove":
+		change.Type = "add"
+	}
+	change.Before, change.After = change.After, change.Before
+	return change
+}
+
+func storedGenerated(definition string) bool {
+	definition = strings.ToUpper(definition)
+	return strings.Contains(definition, " AS (") && strings.Contains(definition, "STORED")
+}
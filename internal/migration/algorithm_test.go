@@ -0,0 +1,94 @@
+package migration
+
+import (
+	"db-pivot/internal/diff"
+	"strings"
+	"testing"
+)
+
+func TestAlgorithmFor(t *testing.T) {
+	tests := []struct {
+		change diff.Change
+		clause string
+		copies bool
+	}{
+		{diff.Change{Type: "add", Object: "column:users.email", After: "VARCHAR(255) NULL"}, algorithmInstant, false},
+		{diff.Change{Type: "add", Object: "column:users.total", After: "INT AS (a + b) STORED"}, "", true},
+		{diff.Change{Type: "remove", Object: "column:users.email"}, algorithmInstant, false},
+		{diff.Change{Type: "modify", Object: "column:users.name", Before: "varchar(100) NOT NULL", After: "varchar(50) NOT NULL"}, "", true},
+		{diff.Change{Type: "modify", Object: "column:users.name", Before: "varchar(100) NOT NULL", After: "varchar(100) NOT NULL DEFAULT ''"}, algorithmInstant, false},
+		{diff.Change{Type: "add", Object: "index:users.idx_name", After: "INDEX idx_name (name)"}, algorithmInplace, false},
+		{diff.Change{Type: "add", Object: "index:users.ft_bio", After: "FULLTEXT ft_bio (bio)"}, "", true},
+		{diff.Change{Type: "remove", Object: "index:users.PRIMARY"}, "", true},
+		{diff.Change{Type: "add", Object: "foreign_key:orders.fk_user"}, "", true},
+		{diff.Change{Type: "remove", Object: "foreign_key:orders.fk_user"}, algorithmInplace, false},
+		{diff.Change{Type: "add", Object: "check:orders.chk_total"}, "", true},
+		{diff.Change{Type: "remove", Object: "check:orders.chk_total"}, algorithmInplace, false},
+		{diff.Change{Type: "modify", Object: "option:users.engine"}, "", true},
+		{diff.Change{Type: "modify", Object: "option:users.comment"}, algorithmInstant, false},
+		{diff.Change{Type: "modify", Object: "option:users.row_format"}, algorithmInplace, false},
+		{diff.Change{Type: "add", Object: "table:users"}, "", false},
+	}
+	for _, tt := range tests {
+		clause, warning := algorithmFor(tt.change)
+		if clause != tt.clause || (warning != "") != tt.copies {
+			t.Errorf("algorithmFor(%s %s) = %q, %q, want %q, copies %v", tt.change.Type, tt.change.Object, clause, warning, tt.clause, tt.copies)
+		}
+	}
+}
+
+func TestModifyAlgorithm(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		clause        string
+		copied        bool
+	}{
+		{"default only", "int NOT NULL DEFAULT '0'", "int NOT NULL DEFAULT '1'", algorithmInstant, false},
+		{"comment only", "int NOT NULL", "int NOT NULL COMMENT 'count'", algorithmInplace, false},
+		{"made nullable", "int NOT NULL", "int NULL", algorithmInplace, false},
+		{"other type", "int NOT NULL", "bigint NOT NULL", "", true},
+		{"made unsigned", "int NOT NULL", "int unsigned NOT NULL", "", true},
+		{"unsigned kept", "int unsigned NOT NULL", "int unsigned NOT NULL DEFAULT '1'", algorithmInstant, false},
+		{"enum member appended", "enum('a','b') NOT NULL", "enum('a','b','c') NOT NULL", algorithmInstant, false},
+		{"enum member inserted", "enum('a','b') NOT NULL", "enum('a','c','b') NOT NULL", "", true},
+		{"varchar grows within one length byte", "varchar(10) CHARACTER SET utf8mb4 NOT NULL", "varchar(60) CHARACTER SET utf8mb4 NOT NULL", algorithmInplace, false},
+		{"varchar crosses 255 bytes", "varchar(60) CHARACTER SET utf8mb4 NOT NULL", "varchar(100) CHARACTER SET utf8mb4 NOT NULL", "", true},
+		{"varchar without charset may cross", "varchar(60) NOT NULL", "varchar(100) NOT NULL", "", false},
+		{"varchar beyond both", "varchar(300) NOT NULL", "varchar(400) NOT NULL", algorithmInplace, false},
+		{"varchar shrinks", "varchar(100) NOT NULL", "varchar(50) NOT NULL", "", true},
+		{"varbinary grows", "varbinary(100) NOT NULL", "varbinary(200) NOT NULL", algorithmInplace, false},
+		{"unknown definition", "", "int NOT NULL", "", false},
+	}
+	for _, tt := range tests {
+		clause, copied := modifyAlgorithm(tt.before, tt.after)
+		if clause != tt.clause || copied != tt.copied {
+			t.Errorf("%s: modifyAlgorithm(%q, %q) = %q, %v, want %q, %v", tt.name, tt.before, tt.after, clause, copied, tt.clause, tt.copied)
+		}
+	}
+}
+
+func TestWithAlgorithm(t *testing.T) {
+	script := strings.Join([]string{
+		"ALTER TABLE users ADD email VARCHAR(255);",
+		"ALTER TABLE users ADD PARTITION (PARTITION p2 VALUES LESS THAN (20));",
+		"CREATE INDEX idx ON users (email);",
+		"ALTER TABLE orders",
+		"  ADD note TEXT;",
+		"",
+	}, "\n")
+	want := strings.Join([]string{
+		"ALTER TABLE users ADD email VARCHAR(255), ALGORITHM=INSTANT;",
+		"ALTER TABLE users ADD PARTITION (PARTITION p2 VALUES LESS THAN (20));",
+		"CREATE INDEX idx ON users (email);",
+		"ALTER TABLE orders",
+		"  ADD note TEXT;",
+		"",
+	}, "\n")
+	if got := withAlgorithm(script, algorithmInstant); got != want {
+		t.Errorf("withAlgorithm\n%s\nwant\n%s", got, want)
+	}
+	if got := withAlgorithm(script, ""); got != script {
+		t.Errorf("withAlgorithm without a clause changed the script:\n%s", got)
+	}
+}
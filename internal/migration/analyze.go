@@ -0,0 +1,471 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"db-pivot/internal/db"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Impact is what a statement does to the table it changes.
+type Impact string
+
+const (
+	// ImpactMetadata only changes the data dictionary; the table size does
+	// not matter.
+	ImpactMetadata Impact = "metadata-only"
+	// ImpactInplace rebuilds the table, or builds an index, without
+	// blocking writes.
+	ImpactInplace Impact = "in-place rebuild"
+	// ImpactCopy copies the table and blocks writes until it is done.
+	ImpactCopy Impact = "table copy"
+	// ImpactOnline copies the table through a shadow table, see Online.
+	ImpactOnline Impact = "online copy"
+	// ImpactRows inserts, updates or deletes rows.
+	ImpactRows    Impact = "row changes"
+	ImpactUnknown Impact = "unknown"
+)
+
+// Rough throughput the duration classes are estimated with. Real numbers
+// depend on the hardware, the row width and the load on the server.
+const (
+	inplaceBytesPerSecond = 50 << 20
+	copyBytesPerSecond    = 20 << 20
+	onlineBytesPerSecond  = 10 << 20
+	rowsPerSecond         = 10000
+)
+
+// TableSize is what information_schema.TABLES estimates for a table.
+type TableSize struct {
+	Rows       int64
+	DataBytes  int64
+	IndexBytes int64
+}
+
+func (s TableSize) String() string {
+	return fmt.Sprintf("~%d rows, %s data, %s indexes", s.Rows, formatBytes(s.DataBytes), formatBytes(s.IndexBytes))
+}
+
+// StatementAnalysis predicts the impact of one statement of a migration.
+type StatementAnalysis struct {
+	Statement string
+	// Table is the table the statement changes, empty when it changes none.
+	Table string
+	// Size is nil when the table does not exist yet.
+	Size   *TableSize
+	Impact Impact
+	// Duration is a class such as "instant", "seconds" or "hours".
+	Duration string
+	// Reason names the clause that decided the impact.
+	Reason string
+}
+
+var (
+	createIndexStmt = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:(UNIQUE|FULLTEXT|SPATIAL)\s+)?INDEX\s+\S+\s+ON\s+` + qualifiedName)
+	dropIndexStmt   = regexp.MustCompile(`(?is)^\s*DROP\s+INDEX\s+\S+\s+ON\s+` + qualifiedName)
+	dropTableStmt   = regexp.MustCompile(`(?is)^\s*(?:DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?|TRUNCATE\s+(?:TABLE\s+)?)` + qualifiedName)
+	insertStmt      = regexp.MustCompile(`(?is)^\s*(?:INSERT|REPLACE)\s+(?:IGNORE\s+)?(?:INTO\s+)?` + qualifiedName + `(.*)$`)
+	updateStmt      = regexp.MustCompile(`(?is)^\s*(?:UPDATE\s+(?:IGNORE\s+)?|DELETE\s+(?:IGNORE\s+)?FROM\s+)` + qualifiedName)
+	ddlStmt         = regexp.MustCompile(`(?is)^\s*(CREATE|DROP|RENAME|ALTER\s+(?:VIEW|PROCEDURE|FUNCTION|EVENT))\b`)
+	algorithmHint   = regexp.MustCompile(`(?i)\bALGORITHM\s*=\s*(\w+)`)
+	changeColumn    = regexp.MustCompile("(?is)^(MODIFY|CHANGE)\\s+(?:COLUMN\\s+)?(`[^`]+`|[\\w$]+)\\s+(.*)$")
+	columnType      = regexp.MustCompile(`(?i)^(\w+)(?:\s*\(([^)]*)\))?(\s+unsigned)?`)
+	columnPosition  = regexp.MustCompile(`(?i)\s(FIRST|AFTER\s+\S+)\s*$`)
+	mysqlVersion    = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)`)
+)
+
+const qualifiedName = "(?:(`[^`]+`|[\\w$]+)\\.)?(`[^`]+`|[\\w$]+)"
+
+// Analyze predicts, for each Up statement of mig, how much of its table the
+// statement touches and roughly how long it runs. It only reads
+// information_schema; nothing is executed. online decides which ALTER
+// TABLE statements would run online, as in ApplyMigration, and may be nil.
+func Analyze(ctx context.Context, dbManager *db.DBManager, mig Migration, online *Online) ([]StatementAnalysis, error) {
+	a := &analyzer{dbManager: dbManager, mig: mig, online: online, sizes: make(map[string]*TableSize)}
+	if err := a.detectFeatures(ctx); err != nil {
+		return nil, err
+	}
+	analyses := make([]StatementAnalysis, 0, len(mig.Up))
+	for _, stmt := range mig.Up {
+		analysis, err := a.statement(ctx, stmt)
+		if err != nil {
+			return nil, err
+		}
+		analyses = append(analyses, analysis)
+	}
+	return analyses, nil
+}
+
+type analyzer struct {
+	dbManager *db.DBManager
+	mig       Migration
+	online    *Online
+	sizes     map[string]*TableSize
+
+	// Server versions that add or drop columns without a rebuild.
+	instantAdd, instantAddAnywhere, instantDrop bool
+}
+
+func (a *analyzer) detectFeatures(ctx context.Context) error {
+	var version string
+	if err := a.dbManager.QueryRow(ctx, "SELECT VERSION()").Scan(&version); err != nil {
+		return fmt.Errorf("falha ao consultar a versão do servidor: %v", err)
+	}
+	m := mysqlVersion.FindStringSubmatch(version)
+	if m == nil {
+		return nil
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	patch, _ := strconv.Atoi(m[3])
+	n := major*10000 + minor*100 + patch
+	if strings.Contains(version, "MariaDB") {
+		a.instantAdd = n >= 100300
+		a.instantAddAnywhere = n >= 100400
+		a.instantDrop = n >= 100400
+	} else {
+		a.instantAdd = n >= 80012
+		a.instantAddAnywhere = n >= 80029
+		a.instantDrop = n >= 80029
+	}
+	return nil
+}
+
+func (a *analyzer) statement(ctx context.Context, stmt string) (StatementAnalysis, error) {
+	analysis := StatementAnalysis{Statement: stmt, Impact: ImpactUnknown, Reason: "statement not recognized"}
+	var schema, table string
+	switch {
+	case alterTable.MatchString(stmt):
+		s, t, spec, ok := parseAlter(stmt)
+		if !ok {
+			analysis.Impact, analysis.Reason = ImpactMetadata, "renames the table"
+			break
+		}
+		schema, table = s, t
+		size, err := a.size(ctx, schema, table)
+		if err != nil {
+			return analysis, err
+		}
+		var rows int64
+		if size != nil {
+			rows = size.Rows
+		}
+		if a.online.runsOnline(a.mig.Metadata.Online, rows) {
+			// ApplyMigration refuses the whole migration, as in plan.
+			if m := offlineSpecClause(spec); m != "" {
+				analysis.Reason = fmt.Sprintf("fails: %s cannot run online; mark the migration with \"-- online: false\" to run it directly", strings.ToUpper(m))
+				break
+			}
+			analysis.Impact, analysis.Reason = ImpactOnline, "runs through a shadow table"
+			break
+		}
+		if analysis.Impact, analysis.Reason, err = a.alter(ctx, schema, table, spec); err != nil {
+			return analysis, err
+		}
+		if m := algorithmHint.FindStringSubmatch(stmt); m != nil && strings.EqualFold(m[1], "COPY") {
+			analysis.Impact, analysis.Reason = ImpactCopy, "requests ALGORITHM=COPY"
+		}
+	case createIndexStmt.MatchString(stmt):
+		m := createIndexStmt.FindStringSubmatch(stmt)
+		schema, table = m[2], m[3]
+		analysis.Impact, analysis.Reason = ImpactInplace, "builds an index"
+	case dropIndexStmt.MatchString(stmt):
+		m := dropIndexStmt.FindStringSubmatch(stmt)
+		schema, table = m[1], m[2]
+		analysis.Impact, analysis.Reason = ImpactMetadata, "drops an index"
+	case dropTableStmt.MatchString(stmt):
+		m := dropTableStmt.FindStringSubmatch(stmt)
+		schema, table = m[1], m[2]
+		analysis.Impact, analysis.Reason = ImpactMetadata, "drops or empties the table"
+	case insertStmt.MatchString(stmt):
+		m := insertStmt.FindStringSubmatch(stmt)
+		schema, table = m[1], m[2]
+		analysis.Impact, analysis.Reason, analysis.Duration = ImpactRows, "inserts rows", "instant"
+		if strings.Contains(strings.ToUpper(m[3]), "SELECT") {
+			analysis.Reason, analysis.Duration = "inserts the rows of a query", "unknown"
+		}
+	case updateStmt.MatchString(stmt):
+		m := updateStmt.FindStringSubmatch(stmt)
+		schema, table = m[1], m[2]
+		analysis.Impact, analysis.Reason = ImpactRows, "changes up to every row"
+	case ddlStmt.MatchString(stmt):
+		analysis.Impact, analysis.Reason = ImpactMetadata, "changes no table data"
+	}
+
+	if table != "" {
+		size, err := a.size(ctx, strings.Trim(schema, "`"), strings.Trim(table, "`"))
+		if err != nil {
+			return analysis, err
+		}
+		analysis.Table = strings.Trim(table, "`")
+		if schema != "" {
+			analysis.Table = strings.Trim(schema, "`") + "." + analysis.Table
+		}
+		analysis.Size = size
+	}
+	if analysis.Duration == "" {
+		analysis.Duration = a.duration(analysis)
+	}
+	return analysis, nil
+}
+
+// alter returns the heaviest impact of the clauses of an ALTER TABLE.
+func (a *analyzer) alter(ctx context.Context, schema, table, spec string) (Impact, string, error) {
+	impact, reason := ImpactMetadata, ""
+	for _, clause := range SplitClauses(spec) {
+		clauseImpact, clauseReason, err := a.clause(ctx, schema, table, clause)
+		if err != nil {
+			return "", "", err
+		}
+		if reason == "" || impactRank[clauseImpact] > impactRank[impact] {
+			impact, reason = clauseImpact, clauseReason
+		}
+	}
+	return impact, reason, nil
+}
+
+var impactRank = map[Impact]int{ImpactMetadata: 0, ImpactInplace: 1, ImpactCopy: 2}
+
+var clauseKinds = []struct {
+	pattern *regexp.Regexp
+	impact  Impact
+	reason  string
+}{
+	{regexp.MustCompile(`(?i)^(ALGORITHM|LOCK)\b`), ImpactMetadata, ""},
+	{regexp.MustCompile(`(?i)^ADD\s+(?:CONSTRAINT\s+\S+\s+)?(FOREIGN\s+KEY|CHECK)\b`), ImpactCopy, "adds a constraint that every row is checked against"},
+	{regexp.MustCompile(`(?i)^ADD\s+(?:CONSTRAINT\s+\S+\s+)?PRIMARY\s+KEY\b`), ImpactInplace, "rebuilds the table on a new primary key"},
+	{regexp.MustCompile(`(?i)^ADD\s+(?:CONSTRAINT\s+\S+\s+)?(UNIQUE|FULLTEXT|SPATIAL|INDEX|KEY)\b`), ImpactInplace, "builds an index"},
+	{regexp.MustCompile(`(?i)^ADD\s+PARTITION\b`), ImpactMetadata, "adds an empty partition"},
+	{regexp.MustCompile(`(?i)^DROP\s+PRIMARY\s+KEY\b`), ImpactCopy, "drops the primary key"},
+	{regexp.MustCompile(`(?i)^DROP\s+(INDEX|KEY|FOREIGN\s+KEY|CHECK|CONSTRAINT|PARTITION)\b`), ImpactMetadata, "drops an index, constraint or partition"},
+	{regexp.MustCompile(`(?i)^(ALTER\s+(COLUMN\s+)?\S+\s+(SET|DROP)\s+(DEFAULT|VISIBLE|INVISIBLE)|ALTER\s+INDEX|RENAME)\b`), ImpactMetadata, "renames or changes a default"},
+	{regexp.MustCompile(`(?i)^(COMMENT|AUTO_INCREMENT|DEFAULT\s+(CHARACTER\s+SET|CHARSET|COLLATE)|(TRUNCATE|EXCHANGE)\s+PARTITION)\b`), ImpactMetadata, "changes table metadata"},
+	{regexp.MustCompile(`(?i)^(ROW_FORMAT|KEY_BLOCK_SIZE|FORCE)\b`), ImpactInplace, "rebuilds the table"},
+	{regexp.MustCompile(`(?i)^(ENGINE|CONVERT\s+TO|PARTITION\s+BY|REMOVE\s+PARTITIONING|REORGANIZE|COALESCE|REBUILD)\b`), ImpactCopy, "copies the table"},
+}
+
+func (a *analyzer) clause(ctx context.Context, schema, table, clause string) (Impact, string, error) {
+	for _, kind := range clauseKinds {
+		if kind.pattern.MatchString(clause) {
+			return kind.impact, kind.reason, nil
+		}
+	}
+	upper := strings.ToUpper(clause)
+	switch {
+	case changeColumn.MatchString(clause):
+		return a.changeColumn(ctx, schema, table, clause)
+	case strings.HasPrefix(upper, "DROP "):
+		if a.instantDrop {
+			return ImpactMetadata, "drops a column instantly", nil
+		}
+		return ImpactInplace, "drops a column", nil
+	case strings.HasPrefix(upper, "ADD "):
+		if storedGenerated(clause) {
+			return ImpactCopy, "adds a stored generated column", nil
+		}
+		positioned := columnPosition.MatchString(clause)
+		if a.instantAddAnywhere || a.instantAdd && !positioned {
+			return ImpactMetadata, "adds a column instantly", nil
+		}
+		return ImpactInplace, "adds a column", nil
+	}
+	return ImpactCopy, fmt.Sprintf("unrecognized clause %q is assumed to copy the table", summarizeClause(clause)), nil
+}
+
+// changeColumn compares a MODIFY or CHANGE clause with the live column.
+func (a *analyzer) changeColumn(ctx context.Context, schema, table, clause string) (Impact, string, error) {
+	m := changeColumn.FindStringSubmatch(clause)
+	name, definition := strings.Trim(m[2], "`"), m[3]
+	renamed := false
+	if strings.EqualFold(m[1], "CHANGE") {
+		fields := strings.SplitN(definition, " ", 2)
+		if len(fields) < 2 {
+			return ImpactCopy, "changes a column", nil
+		}
+		renamed = !strings.EqualFold(strings.Trim(fields[0], "`"), name)
+		definition = fields[1]
+	}
+
+	var current string
+	var nullable string
+	var maxLength, octetLength sql.NullInt64
+	err := a.dbManager.QueryRow(ctx, `
+		SELECT COLUMN_TYPE, IS_NULLABLE, CHARACTER_MAXIMUM_LENGTH, CHARACTER_OCTET_LENGTH
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ? AND COLUMN_NAME = ?`,
+		schema, table, name).Scan(&current, &nullable, &maxLength, &octetLength)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ImpactCopy, fmt.Sprintf("changes column %s, which does not exist yet", name), nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("falha ao consultar a coluna %s.%s: %v", table, name, err)
+	}
+
+	before, after := columnType.FindStringSubmatch(current), columnType.FindStringSubmatch(strings.TrimSpace(definition))
+	if before == nil || after == nil || !strings.EqualFold(before[1], after[1]) || (before[3] == "") != (after[3] == "") {
+		return ImpactCopy, fmt.Sprintf("changes the type of column %s", name), nil
+	}
+	if !sameLength(before[1], before[2], after[2]) {
+		oldLength, _ := strconv.ParseInt(before[2], 10, 64)
+		newLength, _ := strconv.ParseInt(after[2], 10, 64)
+		kind := strings.ToLower(before[1])
+		bytesPerChar := int64(1)
+		if maxLength.Int64 > 0 {
+			bytesPerChar = octetLength.Int64 / maxLength.Int64
+		}
+		// VARCHAR columns grow in place while their length prefix keeps
+		// its size, one byte up to 255 bytes and two above.
+		if (kind == "varchar" || kind == "varbinary") && newLength > oldLength &&
+			(oldLength*bytesPerChar <= 255) == (newLength*bytesPerChar <= 255) {
+			return ImpactMetadata, fmt.Sprintf("extends column %s", name), nil
+		}
+		return ImpactCopy, fmt.Sprintf("changes the length of column %s", name), nil
+	}
+	if wantNull := !strings.Contains(strings.ToUpper(definition), "NOT NULL"); wantNull != (nullable == "YES") {
+		return ImpactInplace, fmt.Sprintf("changes whether column %s accepts NULL", name), nil
+	}
+	if renamed {
+		return ImpactMetadata, fmt.Sprintf("renames column %s", name), nil
+	}
+	return ImpactMetadata, fmt.Sprintf("changes the default or comment of column %s", name), nil
+}
+
+// sameLength compares type arguments, ignoring the display widths integer
+// types carried before MySQL 8.0.19.
+func sameLength(kind, before, after string) bool {
+	if strings.HasSuffix(strings.ToLower(kind), "int") {
+		return true
+	}
+	return strings.ReplaceAll(before, " ", "") == strings.ReplaceAll(after, " ", "")
+}
+
+// size reads the estimated size of a table, nil when it does not exist.
+func (a *analyzer) size(ctx context.Context, schema, table string) (*TableSize, error) {
+	key := schema + "." + table
+	if size, ok := a.sizes[key]; ok {
+		return size, nil
+	}
+	var rows, data, index sql.NullInt64
+	err := a.dbManager.QueryRow(ctx, `
+		SELECT TABLE_ROWS, DATA_LENGTH, INDEX_LENGTH FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?`, schema, table).Scan(&rows, &data, &index)
+	var size *TableSize
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, fmt.Errorf("falha ao consultar o tamanho de %s: %v", table, err)
+	default:
+		size = &TableSize{Rows: rows.Int64, DataBytes: data.Int64, IndexBytes: index.Int64}
+	}
+	a.sizes[key] = size
+	return size, nil
+}
+
+// duration classes the time a statement takes from its impact and the size
+// of its table. UPDATE and DELETE are assumed to touch every row.
+func (a *analyzer) duration(analysis StatementAnalysis) string {
+	if analysis.Impact == ImpactMetadata {
+		return "instant"
+	}
+	if analysis.Impact == ImpactUnknown {
+		return "unknown"
+	}
+	size := analysis.Size
+	if size == nil {
+		return "instant"
+	}
+	bytes := float64(size.DataBytes + size.IndexBytes)
+	var seconds float64
+	switch analysis.Impact {
+	case ImpactInplace:
+		seconds = bytes / inplaceBytesPerSecond
+	case ImpactCopy:
+		seconds = bytes / copyBytesPerSecond
+	case ImpactOnline:
+		seconds = bytes / onlineBytesPerSecond
+		if a.online != nil && a.online.MaxRowsPerSecond > 0 {
+			if throttled := float64(size.Rows) / float64(a.online.MaxRowsPerSecond); throttled > seconds {
+				seconds = throttled
+			}
+		}
+	case ImpactRows:
+		seconds = float64(size.Rows) / rowsPerSecond
+	}
+	return durationClass(seconds)
+}
+
+func durationClass(seconds float64) string {
+	switch {
+	case seconds < 1:
+		return "instant"
+	case seconds < 60:
+		return "seconds"
+	case seconds < 3600:
+		return "minutes"
+	case seconds < 86400:
+		return "hours"
+	}
+	return "days"
+}
+
+// SplitAlterTable splits an ALTER TABLE statement into its table, with the
+// schema it is qualified with if any, and its clauses. ok is false for
+// other statements.
+func SplitAlterTable(stmt string) (schema, table string, clauses []string, ok bool) {
+	m := alterTable.FindStringSubmatch(stmt)
+	if m == nil {
+		return "", "", nil, false
+	}
+	return strings.Trim(m[1], "`"), strings.Trim(m[2], "`"), SplitClauses(m[3]), true
+}
+
+// SplitClauses splits the clauses of an ALTER TABLE, or the definitions of
+// a CREATE TABLE, at the commas outside parentheses and quotes.
+func SplitClauses(spec string) []string {
+	var clauses []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(spec); i++ {
+		c := spec[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			clauses = append(clauses, strings.TrimSpace(spec[start:i]))
+			start = i + 1
+		}
+	}
+	return append(clauses, strings.TrimSpace(spec[start:]))
+}
+
+func summarizeClause(clause string) string {
+	if fields := strings.Fields(clause); len(fields) > 3 {
+		return strings.Join(fields[:3], " ") + " ..."
+	}
+	return clause
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,60 @@
+package migration
+
+import (
+	"db-pivot/internal/diff"
+	"fmt"
+	"strings"
+)
+
+// dumpHeader starts every script written by Dump.
+const dumpHeader = "-- Schema dump generated by dbpivot. Do not edit; run `dbpivot dump` again.\n"
+
+// Dump renders the changes that create a schema from nothing, as reported
+// by comparing an empty snapshot with it, as a single script that can be
+// run again on a database that already has the objects. Tables are created
+// IF NOT EXISTS with their foreign keys inline, with foreign key checks off
+// so that they may reference each other in any order; views are created
+// OR REPLACE, and routines and triggers are dropped IF EXISTS first.
+func Dump(changes []diff.Change) (string, error) {
+	foreignKeys := make(map[string][]string)
+	for _, change := range changes {
+		if change.Type == "add" && strings.HasPrefix(change.Object, "foreign_key:") {
+			table, _, err := splitForeignKey(change.Object)
+			if err != nil {
+				return "", err
+			}
+			foreignKeys[table] = append(foreignKeys[table], change.After)
+		}
+	}
+
+	var tables, objects strings.Builder
+	for _, change := range changes {
+		if change.Type != "add" {
+			return "", fmt.Errorf("mudança %s %s não cria um objeto", change.Type, change.Object)
+		}
+		switch kind, name, _ := strings.Cut(change.Object, ":"); kind {
+		case "table":
+			definition := strings.Join(append([]string{change.Detail}, foreignKeys[name]...), ",\n")
+			tables.WriteString(createTable("CREATE TABLE IF NOT EXISTS", name, definition, change.After))
+		case "foreign_key":
+		case "view":
+			objects.WriteString(change.After + ";\n")
+		case "procedure", "function", "trigger":
+			objects.WriteString(dropRoutine(kind, name) + createRoutine(change.After))
+		default:
+			return "", fmt.Errorf("mudança %s não suportada no dump", change.Object)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(dumpHeader)
+	if tables.Len() > 0 {
+		b.WriteString("\nSET FOREIGN_KEY_CHECKS = 0;\n")
+		b.WriteString(tables.String())
+		b.WriteString("SET FOREIGN_KEY_CHECKS = 1;\n")
+	}
+	if objects.Len() > 0 {
+		b.WriteString("\n" + objects.String())
+	}
+	return b.String(), nil
+}
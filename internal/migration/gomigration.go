@@ -0,0 +1,124 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"db-pivot/internal/db"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// GoMigrationFunc runs one direction of a Go migration inside the
+// transaction that also records it in schema_migrations.
+type GoMigrationFunc func(ctx context.Context, tx *sql.Tx) error
+
+// GoMigration is a migration written in Go and registered with RegisterGoMigration.
+type GoMigration struct {
+	Version     string
+	Description string
+	Up          GoMigrationFunc
+	Down        GoMigrationFunc
+}
+
+// Checksum identifies a Go migration in schema_migrations. There is no file
+// content to hash, so it is derived from the version alone.
+func (g *GoMigration) Checksum() string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte("go:"+g.Version)))
+}
+
+var (
+	goMigrationsMu sync.Mutex
+	goMigrations   = make(map[string]*GoMigration)
+)
+
+// RegisterGoMigration makes a Go migration available to apply and rollback.
+// It is meant to be called from init functions and panics if the version is
+// not all digits, has no Up function, or is registered twice.
+func RegisterGoMigration(version, description string, up, down GoMigrationFunc) {
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+
+	if !ValidVersion(version) {
+		panic(fmt.Sprintf("migration: RegisterGoMigration with version %q, which is not all digits", version))
+	}
+	if up == nil {
+		panic(fmt.Sprintf("migration: RegisterGoMigration %s with nil Up", version))
+	}
+	for registered := range goMigrations {
+		if CompareVersions(registered, version) == 0 {
+			panic(fmt.Sprintf("migration: RegisterGoMigration called twice for version %s", version))
+		}
+	}
+	goMigrations[version] = &GoMigration{
+		Version:     version,
+		Description: description,
+		Up:          up,
+		Down:        down,
+	}
+}
+
+// GoMigrations returns the registered Go migrations ordered by version.
+func GoMigrations() []*GoMigration {
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+
+	migs := make([]*GoMigration, 0, len(goMigrations))
+	for _, gm := range goMigrations {
+		migs = append(migs, gm)
+	}
+	sort.Slice(migs, func(i, j int) bool {
+		return CompareVersions(migs[i].Version, migs[j].Version) < 0
+	})
+	return migs
+}
+
+// LookupGoMigration returns the Go migration registered for version, if any.
+func LookupGoMigration(version string) (*GoMigration, bool) {
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+
+	gm, ok := goMigrations[version]
+	return gm, ok
+}
+
+func ApplyGoMigration(ctx context.Context, dbManager *db.DBManager, gm *GoMigration) error {
+	desc := gm.Description
+	if desc == "" {
+		desc = fmt.Sprintf("Migration %s applied", gm.Version)
+	}
+	return runGoMigration(ctx, dbManager, gm, gm.Up,
+		"INSERT INTO schema_migrations (version, description, checksum) VALUES (?, ?, ?)",
+		gm.Version, desc, gm.Checksum())
+}
+
+func RollbackGoMigration(ctx context.Context, dbManager *db.DBManager, gm *GoMigration) error {
+	if gm.Down == nil {
+		return fmt.Errorf("migração %s não possui função down", gm.Version)
+	}
+	return runGoMigration(ctx, dbManager, gm, gm.Down,
+		"DELETE FROM schema_migrations WHERE version = ?", gm.Version)
+}
+
+func runGoMigration(ctx context.Context, dbManager *db.DBManager, gm *GoMigration, fn GoMigrationFunc, record string, args ...interface{}) error {
+	tx, err := dbManager.BeginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("falha ao iniciar transação para a migração %s: %v", gm.Version, err)
+	}
+	if err := fn(ctx, tx); err != nil {
+		tx.Rollback()
+		if ctx.Err() != nil {
+			return &InterruptedError{Version: gm.Version, Total: 1, Err: err}
+		}
+		return fmt.Errorf("falha ao executar a migração %s: %v", gm.Version, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("falha ao registrar a migração %s: %v", gm.Version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("falha ao confirmar a migração %s: %v", gm.Version, err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package migration
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Metadata is read from the header block at the top of a migration file:
+//
+//	-- author: alice
+//	-- description: add an email column to users
+//	-- tags: users, email
+//	-- no-transaction: true
+//	-- depends-on: 20240102150405
+//	-- online: true
+//
+// It is recorded in schema_migrations when the migration is applied.
+type Metadata struct {
+	Author      string
+	Description string
+	Tags        []string
+	// NoTransaction runs the statements one by one instead of in a single
+	// transaction together with the schema_migrations record.
+	NoTransaction bool
+	// DependsOn lists versions that must be applied first.
+	DependsOn []string
+	// Online runs the migration's ALTER TABLE statements as online schema
+	// changes when true, and never when false. Nil leaves it to the row
+	// count threshold of Online.
+	Online *bool
+}
+
+var headerLine = regexp.MustCompile(`^--\s*([A-Za-z-]+)\s*:\s*(.*)$`)
+
+// ParseMetadata reads the header block of script, the comment lines before
+// the first statement or section marker. Comment lines that are not
+// "key: value" pairs, and unknown keys, are ignored.
+func ParseMetadata(script string) (Metadata, error) {
+	var meta Metadata
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") || sectionMarker(line) != noSection || annotation(line) != "" {
+			break
+		}
+		m := headerLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		value := strings.TrimSpace(m[2])
+		switch strings.ToLower(m[1]) {
+		case "author":
+			meta.Author = value
+		case "description":
+			meta.Description = value
+		case "tags":
+			meta.Tags = splitList(value)
+		case "no-transaction":
+			noTx, err := strconv.ParseBool(value)
+			if err != nil {
+				return Metadata{}, fmt.Errorf("valor inválido para no-transaction: %q", value)
+			}
+			meta.NoTransaction = noTx
+		case "depends-on":
+			meta.DependsOn = splitList(value)
+		case "online":
+			online, err := strconv.ParseBool(value)
+			if err != nil {
+				return Metadata{}, fmt.Errorf("valor inválido para online: %q", value)
+			}
+			meta.Online = &online
+		}
+	}
+	return meta, nil
+}
+
+// Header renders meta as the header block of a migration file.
+func (meta Metadata) Header() string {
+	var b strings.Builder
+	if meta.Author != "" {
+		fmt.Fprintf(&b, "-- author: %s\n", meta.Author)
+	}
+	if meta.Description != "" {
+		fmt.Fprintf(&b, "-- description: %s\n", meta.Description)
+	}
+	if len(meta.Tags) > 0 {
+		fmt.Fprintf(&b, "-- tags: %s\n", strings.Join(meta.Tags, ", "))
+	}
+	if meta.NoTransaction {
+		b.WriteString("-- no-transaction: true\n")
+	}
+	if len(meta.DependsOn) > 0 {
+		fmt.Fprintf(&b, "-- depends-on: %s\n", strings.Join(meta.DependsOn, ", "))
+	}
+	if meta.Online != nil {
+		fmt.Fprintf(&b, "-- online: %t\n", *meta.Online)
+	}
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// DefaultName is the name of migrations generated without one.
+const DefaultName = "migration"
+
+// FileName returns the file name of a migration, "<version>_<name>.sql".
+// The name is lower-cased and anything but letters and digits becomes an
+// underscore.
+func FileName(version, name string) string {
+	name = strings.Trim(unsafeNameChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		name = DefaultName
+	}
+	return fmt.Sprintf("%s_%s.sql", version, name)
+}
+
+// FileName returns the file name the migration is written to.
+func (m Migration) FileName() string {
+	return FileName(m.Version, m.Name)
+}
+
+// ParseFileName splits a migration file name into its version, the prefix
+// up to the first underscore, and its name. The ".up" and ".down" suffixes
+// of split migrations are not part of the name. ok is false for files that
+// are not migrations, including SQL files whose version is not all digits,
+// such as schema.sql or seed_data.sql.
+func ParseFileName(file string) (version, name string, ok bool) {
+	stem, isSQL := strings.CutSuffix(file, ".sql")
+	if !isSQL {
+		return "", "", false
+	}
+	if s, isUp := strings.CutSuffix(stem, ".up"); isUp {
+		stem = s
+	} else if s, isDown := strings.CutSuffix(stem, ".down"); isDown {
+		stem = s
+	}
+	version, name, _ = strings.Cut(stem, "_")
+	if !ValidVersion(version) {
+		return "", "", false
+	}
+	return version, name, true
+}
+
+// ValidVersion tells whether v can version a migration: it must be all
+// digits, such as the timestamps GenerateMigration uses or the padded
+// numbers of imported migrations.
+func ValidVersion(v string) bool {
+	return v != "" && strings.Trim(v, "0123456789") == ""
+}
+
+// CompareVersions orders versions by their numeric value, so that "9"
+// comes before "10", and returns -1, 0 or +1. Versions that differ only
+// in leading zeros compare equal.
+func CompareVersions(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
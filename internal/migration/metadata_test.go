@@ -0,0 +1,78 @@
+package migration
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseFileName(t *testing.T) {
+	tests := []struct {
+		file          string
+		version, name string
+		ok            bool
+	}{
+		{"20260101120000_add_users.sql", "20260101120000", "add_users", true},
+		{"0001_init.up.sql", "0001", "init", true},
+		{"0001_init.down.sql", "0001", "init", true},
+		{"42.sql", "42", "", true},
+		{"schema.sql", "", "", false},
+		{"seed_data.sql", "", "", false},
+		{"v1_init.sql", "", "", false},
+		{"1.2_init.sql", "", "", false},
+		{"0001_init.txt", "", "", false},
+	}
+	for _, tt := range tests {
+		version, name, ok := ParseFileName(tt.file)
+		if version != tt.version || name != tt.name || ok != tt.ok {
+			t.Errorf("ParseFileName(%q) = %q, %q, %v, want %q, %q, %v", tt.file, version, name, ok, tt.version, tt.name, tt.ok)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"9", "10", -1},
+		{"10", "9", 1},
+		{"0009", "10", -1},
+		{"007", "7", 0},
+		{"20260101120000", "20260101120001", -1},
+		{"00000000000002", "20260101120000", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLoadMigrationsOrder(t *testing.T) {
+	script := &fstest.MapFile{Data: []byte("-- Up migration\nSELECT 1;\n")}
+	migs, skipped, err := LoadMigrations(fstest.MapFS{
+		"10_b.sql":   script,
+		"9_a.sql":    script,
+		"100_c.sql":  script,
+		"schema.sql": script,
+		"README.md":  script,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	for _, mig := range migs {
+		versions = append(versions, mig.Version)
+	}
+	if len(versions) != 3 || versions[0] != "9" || versions[1] != "10" || versions[2] != "100" {
+		t.Errorf("versions %q, want [9 10 100]", versions)
+	}
+	if len(skipped) != 1 || skipped[0] != "schema.sql" {
+		t.Errorf("skipped %q, want [schema.sql]", skipped)
+	}
+
+	_, _, err = LoadMigrations(fstest.MapFS{"7_a.sql": script, "007_b.sql": script})
+	if err == nil {
+		t.Error("versions 7 and 007 were both accepted")
+	}
+}
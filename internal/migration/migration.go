@@ -1,9 +1,11 @@
 package migration
 
 import (
-	"crypto/sha256"
+	"context"
+	"db-pivot/internal/adapters"
 	"db-pivot/internal/db"
 	"db-pivot/internal/diff"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,143 +13,496 @@ import (
 	"time"
 )
 
+// Migration is a SQL migration. Up and Down hold its statements, parsed
+// once when the migration is loaded or generated; UpScript and DownScript
+// are the files they were parsed from.
 type Migration struct {
 	Version    string
+	Name       string
+	Files      []string
 	UpScript   string
 	DownScript string
+	Up         []string
+	Down       []string
+	// Reversible is false for migrations without a Down section or file.
+	Reversible bool
 	Checksum   string
+	Metadata   Metadata
+
+	// Warnings lists the changes in the migration that lose data or that
+	// MySQL can only make by copying the table.
+	Warnings []string
+}
+
+// Section markers of a migration file.
+const (
+	upMarker   = "-- Up migration"
+	downMarker = "-- Down migration"
+)
+
+// GenerateOptions name and describe a generated migration.
+type GenerateOptions struct {
+	// Name follows the version in the file name, e.g. "add_users_email".
+	// Empty means DefaultName.
+	Name     string
+	Metadata Metadata
+	// Version overrides the timestamp the migration is versioned with.
+	Version string
+	// Irreversible leaves out the Down section, for migrations such as a
+	// baseline whose undo would drop the whole schema.
+	Irreversible bool
+}
+
+func GenerateMigration(changes []diff.Change, migrationDir string, opts GenerateOptions) (Migration, error) {
+	mig, err := RenderMigration(changes, opts)
+	if err != nil {
+		return Migration{}, err
+	}
+	if err := os.WriteFile(filepath.Join(migrationDir, mig.Files[0]), []byte(mig.UpScript), 0644); err != nil {
+		return Migration{}, fmt.Errorf("falha ao escrever o arquivo de migração: %v", err)
+	}
+	return mig, nil
 }
 
-func GenerateMigration(changes []diff.Change, migrationDir string) (Migration, error) {
-	timestamp := time.Now().Format("20060102150405")
-	version := timestamp
-	filename := filepath.Join(migrationDir, fmt.Sprintf("%s_migration.sql", version))
+// RenderMigration builds the migration GenerateMigration would write,
+// without writing it.
+func RenderMigration(changes []diff.Change, opts GenerateOptions) (Migration, error) {
+	version := opts.Version
+	if version == "" {
+		version = time.Now().Format("20060102150405")
+	} else if !ValidVersion(version) {
+		return Migration{}, fmt.Errorf("versão %q inválida: uma versão tem apenas dígitos", version)
+	}
+	file := FileName(version, opts.Name)
 
 	var upScript, downScript strings.Builder
-	upScript.WriteString("-- Up migration\n")
-	downScript.WriteString("-- Down migration\n")
+	upScript.WriteString(upMarker + "\n")
+	downScript.WriteString(downMarker + "\n")
+	// Down statements undo the up statements in reverse order, so that
+	// objects are dropped before the ones they depend on.
+	var downStmts []string
+	var warnings []string
 
+	// Tables the migration creates or drops hold no rows that matter, so
+	// their statements are generated without an algorithm.
+	fresh := make(map[string]bool)
 	for _, change := range changes {
+		if kind, table, _ := splitObject(change.Object); kind == "table" && change.Type != "modify" {
+			fresh[table] = true
+		}
+	}
+
+	for _, change := range changes {
+		if change.Warning != "" {
+			warnings = append(warnings, change.Warning)
+			upScript.WriteString(fmt.Sprintf("-- WARNING: %s\n", change.Warning))
+		}
+		var changeScript strings.Builder
+		downStart := len(downStmts)
 		switch change.Type {
 		case "add":
-			if strings.HasPrefix(change.Object, "table:") {
+			if kind, name, ok := routineObject(change.Object); ok {
+				changeScript.WriteString(createRoutine(change.After))
+				downStmts = append(downStmts, dropRoutine(kind, name))
+			} else if strings.HasPrefix(change.Object, "view:") {
+				view := strings.TrimPrefix(change.Object, "view:")
+				changeScript.WriteString(change.After + ";\n")
+				downStmts = append(downStmts, fmt.Sprintf("DROP VIEW IF EXISTS %s;\n", view))
+			} else if strings.HasPrefix(change.Object, "table:") {
 				table := strings.TrimPrefix(change.Object, "table:")
 				tableDefinition := strings.TrimSpace(change.Detail)
 			 	if tableDefinition == "" || strings.ToLower(tableDefinition) == "table added" {
 			 		tableDefinition = "id INT AUTO_INCREMENT PRIMARY KEY"
 				}
-				upScript.WriteString(fmt.Sprintf("CREATE TABLE %s (\n%s\n);\n", table, tableDefinition))
-				downScript.WriteString(fmt.Sprintf("DROP TABLE %s;\n", table))
+				changeScript.WriteString(createTable("CREATE TABLE", table, tableDefinition, change.After))
+				downStmts = append(downStmts, fmt.Sprintf("DROP TABLE %s;\n", table))
 			} else if strings.HasPrefix(change.Object, "column:") {
-				parts := strings.Split(strings.TrimPrefix(change.Object, "column:"), ".")
-				if len(parts) != 2 {
-					return Migration{}, fmt.Errorf("formato inválido para coluna: %s", change.Object)
-				}
-				table, column := parts[0], parts[1]
-				colType := extractType(change.Detail)
-				upScript.WriteString(fmt.Sprintf("ALTER TABLE %s ADD %s %s;\n", table, column, colType))
-				downScript.WriteString(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;\n", table, column))
+				table, column, err := splitColumn(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				colType := change.After
+				if colType == "" {
+					colType = extractType(change.Detail)
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s ADD %s %s;\n", table, column, colType))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;\n", table, column))
+			} else if strings.HasPrefix(change.Object, "check:") {
+				table, check, err := splitCheck(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s;\n", table, check, change.After))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s DROP CHECK %s;\n", table, check))
+			} else if strings.HasPrefix(change.Object, "partition:") {
+				table, part, err := splitPartition(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s ADD PARTITION (%s);\n", table, change.After))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s DROP PARTITION %s;\n", table, part))
+			} else if strings.HasPrefix(change.Object, "index:") {
+				table, index, err := splitIndex(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s ADD %s;\n", table, change.After))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s %s;\n", table, dropIndex(index)))
+			} else if strings.HasPrefix(change.Object, "foreign_key:") {
+				table, fk, err := splitForeignKey(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s ADD %s;\n", table, change.After))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s;\n", table, fk))
 			}
 		case "remove":
-			if strings.HasPrefix(change.Object, "table:") {
+			if kind, name, ok := routineObject(change.Object); ok {
+				changeScript.WriteString(dropRoutine(kind, name))
+				downStmts = append(downStmts, createRoutine(change.Before))
+			} else if strings.HasPrefix(change.Object, "view:") {
+				view := strings.TrimPrefix(change.Object, "view:")
+				changeScript.WriteString(fmt.Sprintf("DROP VIEW IF EXISTS %s;\n", view))
+				downStmts = append(downStmts, change.Before+";\n")
+			} else if strings.HasPrefix(change.Object, "table:") {
 				table := strings.TrimPrefix(change.Object, "table:")
-				upScript.WriteString(fmt.Sprintf("DROP TABLE %s;\n", table))
+				changeScript.WriteString(fmt.Sprintf("DROP TABLE %s;\n", table))
 			 } else if strings.HasPrefix(change.Object, "column:") {
-				parts := strings.Split(strings.TrimPrefix(change.Object, "column:"), ".")
-				if len(parts) != 2 {
-					return Migration{}, fmt.Errorf("formato inválido para coluna: %s", change.Object)
+				table, column, err := splitColumn(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;\n", table, column))
+				if change.Before != "" {
+					downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s ADD %s %s;\n", table, column, change.Before))
+				}
+			 } else if strings.HasPrefix(change.Object, "check:") {
+				table, check, err := splitCheck(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s DROP CHECK %s;\n", table, check))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s;\n", table, check, change.Before))
+			 } else if strings.HasPrefix(change.Object, "partition:") {
+				table, part, err := splitPartition(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s DROP PARTITION %s;\n", table, part))
+				downStmts = append(downStmts, restorePartitions(table, part, change.Before))
+			} else if strings.HasPrefix(change.Object, "index:") {
+				table, index, err := splitIndex(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s %s;\n", table, dropIndex(index)))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s ADD %s;\n", table, change.Before))
+			} else if strings.HasPrefix(change.Object, "foreign_key:") {
+				table, fk, err := splitForeignKey(change.Object)
+				if err != nil {
+					return Migration{}, err
 				}
-				table, column := parts[0], parts[1]
-				upScript.WriteString(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;\n", table, column))
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s;\n", table, fk))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s ADD %s;\n", table, change.Before))
 			 }
 		case "modify":
-			if strings.HasPrefix(change.Object, "column:") {
-				parts := strings.Split(strings.TrimPrefix(change.Object, "column:"), ".")
-				if len(parts) != 2 {
-					return Migration{}, fmt.Errorf("formato inválido para coluna: %s", change.Object)
-				}
-				table, column := parts[0], parts[1]
-				newType := extractType(change.Detail)
-				upScript.WriteString(fmt.Sprintf("ALTER TABLE %s MODIFY %s %s;\n", table, column, newType))
-				oldType := extractOldType(change.Detail)
-				downScript.WriteString(fmt.Sprintf("ALTER TABLE %s MODIFY %s %s;\n", table, column, oldType))
+			if strings.HasPrefix(change.Object, "partitioning:") {
+				table := strings.TrimPrefix(change.Object, "partitioning:")
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s %s;\n", table, repartition(change.After)))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s %s;\n", table, repartition(change.Before)))
+			} else if strings.HasPrefix(change.Object, "partition:") {
+				table, parts, err := splitPartition(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s REORGANIZE PARTITION %s INTO (%s);\n", table, parts, change.After))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s REORGANIZE PARTITION %s INTO (%s);\n",
+					table, strings.Join(diff.PartitionNames(change.After), ","), change.Before))
+			} else if strings.HasPrefix(change.Object, "index:") {
+				table, index, err := splitIndex(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s %s, ADD %s;\n", table, dropIndex(index), change.After))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s %s, ADD %s;\n", table, dropIndex(index), change.Before))
+			} else if strings.HasPrefix(change.Object, "option:") {
+				table, _, err := splitMember(change.Object, "option", "opção")
+				if err != nil {
+					return Migration{}, err
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s %s;\n", table, change.After))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s %s;\n", table, change.Before))
+			} else if kind, name, ok := routineObject(change.Object); ok {
+				changeScript.WriteString(dropRoutine(kind, name) + createRoutine(change.After))
+				downStmts = append(downStmts, dropRoutine(kind, name)+createRoutine(change.Before))
+			} else if strings.HasPrefix(change.Object, "view:") {
+				changeScript.WriteString(change.After + ";\n")
+				downStmts = append(downStmts, change.Before+";\n")
+			} else if strings.HasPrefix(change.Object, "column:") {
+				table, column, err := splitColumn(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				newType := change.After
+				if newType == "" {
+					newType = extractType(change.Detail)
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s MODIFY %s %s;\n", table, column, newType))
+				oldType := change.Before
+				if oldType == "" {
+					oldType = extractOldType(change.Detail)
+				}
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s MODIFY %s %s;\n", table, column, oldType))
+			} else if strings.HasPrefix(change.Object, "check:") {
+				table, check, err := splitCheck(change.Object)
+				if err != nil {
+					return Migration{}, err
+				}
+				changeScript.WriteString(fmt.Sprintf("ALTER TABLE %s DROP CHECK %s;\nALTER TABLE %s ADD CONSTRAINT %s %s;\n", table, check, table, check, change.After))
+				downStmts = append(downStmts, fmt.Sprintf("ALTER TABLE %s DROP CHECK %s;\nALTER TABLE %s ADD CONSTRAINT %s %s;\n", table, check, table, check, change.Before))
 			}
 		default:
 			return Migration{}, fmt.Errorf("tipo de mudança não suportado: %s", change.Type)
 		}
+
+		upClause, downClause := "", ""
+		if _, table, _ := splitObject(change.Object); !fresh[table] {
+			var warning string
+			upClause, warning = algorithmFor(change)
+			downClause, _ = algorithmFor(reversed(change))
+			if warning != "" {
+				warnings = append(warnings, warning)
+				upScript.WriteString(fmt.Sprintf("-- WARNING: %s\n", warning))
+			}
+		}
+		upScript.WriteString(withAlgorithm(changeScript.String(), upClause))
+		for i := downStart; i < len(downStmts); i++ {
+			downStmts[i] = withAlgorithm(downStmts[i], downClause)
+		}
 	}
 
-	content := upScript.String() + "\n" + downScript.String()
-	checksum := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
-	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
-		return Migration{}, fmt.Errorf("falha ao escrever o arquivo de migração: %v", err)
+	for i := len(downStmts) - 1; i >= 0; i-- {
+		downScript.WriteString(downStmts[i])
 	}
 
-	return Migration{
-		Version:    version,
-		UpScript:   upScript.String(),
-		DownScript: downScript.String(),
-		Checksum:   checksum,
-	}, nil
-}
-
-func RollbackMigration(dbManager *db.DBManager, mig Migration) error {
-    lines := strings.Split(mig.UpScript+"\n"+mig.DownScript, "\n")
-    var downScript strings.Builder
-    inDownSection := false
-
-    for _, line := range lines {
-        if strings.HasPrefix(line, "-- Down migration") {
-            inDownSection = true
-            continue
-        }
-        if inDownSection && strings.TrimSpace(line) != "" {
-            downScript.WriteString(line + "\n")
-        }
-    }
-
-    if err := dbManager.ApplyMigration(downScript.String()); err != nil {
-        return fmt.Errorf("falha ao aplicar a migração down %s: %v", mig.Version, err)
-    }
-
-    delScript := fmt.Sprintf("DELETE FROM schema_migrations WHERE version = '%s'", mig.Version)
-    if err := dbManager.ApplyMigration(delScript); err != nil {
-        return fmt.Errorf("falha ao remover o registro da migração %s: %v", mig.Version, err)
-    }
-    return nil
-}
-
-func ApplyMigration(dbManager *db.DBManager, mig Migration) error {
-	lines := strings.Split(mig.UpScript+"\n"+mig.DownScript, "\n")
-	var upScript strings.Builder
-	inUpSection := false
-
-	for _, line := range lines {
-		if strings.HasPrefix(line, "-- Up migration") {
-			inUpSection = true
-			continue
-		}
-		if strings.HasPrefix(line, "-- Down migration") {
-			inUpSection = false
-			break
-		}
-		if inUpSection {
-			upScript.WriteString(line + "\n")
+	content := opts.Metadata.Header() + upScript.String()
+	if !opts.Irreversible {
+		content += "\n" + downScript.String()
+	}
+	mig, err := ParseMigration(file, []byte(content))
+	if err != nil {
+		return Migration{}, fmt.Errorf("migração gerada inválida: %v", err)
+	}
+	mig.Warnings = warnings
+	return mig, nil
+}
+
+// createTable renders a CREATE TABLE statement; create is the statement's
+// keywords, such as "CREATE TABLE IF NOT EXISTS".
+func createTable(create, table, definition, options string) string {
+	if options != "" {
+		options = " " + options
+	}
+	return fmt.Sprintf("%s %s (\n%s\n)%s;\n", create, table, definition, options)
+}
+
+// routineDelimiter ends CREATE statements for routines and triggers, whose
+// bodies contain semicolons.
+const routineDelimiter = "$$"
+
+// splitMember splits objects such as "column:table.name" into the table and
+// the member name. The table may itself be qualified as "schema.table", so
+// the split is at the last dot.
+func splitMember(object, kind, what string) (table, member string, err error) {
+	name := strings.TrimPrefix(object, kind+":")
+	i := strings.LastIndex(name, ".")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", fmt.Errorf("formato inválido para %s: %s", what, object)
+	}
+	return name[:i], name[i+1:], nil
+}
+
+func splitColumn(object string) (table, column string, err error) {
+	return splitMember(object, "column", "coluna")
+}
+
+func splitCheck(object string) (table, check string, err error) {
+	return splitMember(object, "check", "restrição")
+}
+
+func splitIndex(object string) (table, index string, err error) {
+	return splitMember(object, "index", "índice")
+}
+
+func splitForeignKey(object string) (table, fk string, err error) {
+	return splitMember(object, "foreign_key", "chave estrangeira")
+}
+
+// dropIndex is the ALTER TABLE clause that drops an index.
+func dropIndex(index string) string {
+	if index == "PRIMARY" {
+		return "DROP PRIMARY KEY"
+	}
+	return "DROP INDEX " + index
+}
+
+// splitPartition splits "partition:table.names" into the table and the
+// comma separated partition names.
+func splitPartition(object string) (table, partitions string, err error) {
+	return splitMember(object, "partition", "partição")
+}
+
+// restorePartitions undoes DROP PARTITION. Partitions in defs that were
+// not dropped took over the dropped ranges and are split back; otherwise
+// the dropped partitions are simply added again.
+func restorePartitions(table, dropped, defs string) string {
+	gone := make(map[string]bool)
+	for _, name := range strings.Split(dropped, ",") {
+		gone[name] = true
+	}
+	var kept []string
+	for _, name := range diff.PartitionNames(defs) {
+		if !gone[name] {
+			kept = append(kept, name)
 		}
 	}
+	if len(kept) == 0 {
+		return fmt.Sprintf("ALTER TABLE %s ADD PARTITION (%s);\n", table, defs)
+	}
+	return fmt.Sprintf("ALTER TABLE %s REORGANIZE PARTITION %s INTO (%s);\n", table, strings.Join(kept, ","), defs)
+}
+
+// repartition turns a PARTITION BY clause into the ALTER TABLE clause that
+// applies it. An empty clause means the table is not partitioned.
+func repartition(clause string) string {
+	if clause == "" {
+		return "REMOVE PARTITIONING"
+	}
+	return clause
+}
 
-	if err := dbManager.ApplyMigration(upScript.String()); err != nil {
-		return fmt.Errorf("falha ao aplicar a migração up %s: %v", mig.Version, err)
+func routineObject(object string) (kind, name string, ok bool) {
+	kind, name, found := strings.Cut(object, ":")
+	switch kind {
+	case "procedure", "function", "trigger":
+		return kind, name, found
 	}
+	return "", "", false
+}
+
+func createRoutine(create string) string {
+	return fmt.Sprintf("DELIMITER %s\n%s%s\nDELIMITER ;\n", routineDelimiter, create, routineDelimiter)
+}
+
+func dropRoutine(kind, name string) string {
+	return fmt.Sprintf("DROP %s IF EXISTS %s;\n", strings.ToUpper(kind), name)
+}
+
+// InterruptedError reports a migration that stopped because its context was
+// cancelled or timed out. Executed statements are not undone.
+type InterruptedError struct {
+	Version  string
+	Executed int
+	Total    int
+	Err      error
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("migração %s interrompida após %d de %d instruções: %v", e.Version, e.Executed, e.Total, e.Err)
+}
 
-	desc := fmt.Sprintf("Migration %s applied", mig.Version)
-	regScript := fmt.Sprintf("INSERT INTO schema_migrations (version, description, checksum) VALUES ('%s', '%s', '%s')", mig.Version, desc, mig.Checksum)
-	if err := dbManager.ApplyMigration(regScript); err != nil {
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// RollbackMigration runs the Down statements of mig and removes it from
+// schema_migrations. ALTER TABLE statements run online as configured by
+// online, which may be nil.
+func RollbackMigration(ctx context.Context, dbManager *db.DBManager, mig Migration, online *Online) error {
+	if !mig.Reversible {
+		return fmt.Errorf("migração %s não possui seção down", mig.Version)
+	}
+	record := adapters.Statement{Query: "DELETE FROM schema_migrations WHERE version = ?", Args: []interface{}{mig.Version}}
+	if err := execStatements(ctx, dbManager, mig, mig.Down, record, online); err != nil {
+		return fmt.Errorf("falha ao aplicar a migração down %s: %w", mig.Version, err)
+	}
+	return nil
+}
+
+// ApplyMigration runs the Up statements of mig and records it in
+// schema_migrations. ALTER TABLE statements run online as configured by
+// online, which may be nil.
+func ApplyMigration(ctx context.Context, dbManager *db.DBManager, mig Migration, online *Online) error {
+	if err := dbManager.UpgradeVersionTable(ctx); err != nil {
+		return err
+	}
+	if err := execStatements(ctx, dbManager, mig, mig.Up, appliedRecord(mig), online); err != nil {
+		return fmt.Errorf("falha ao aplicar a migração up %s: %w", mig.Version, err)
+	}
+	return nil
+}
+
+// MarkApplied records mig in schema_migrations without running it, for
+// migrations whose changes are already in the database.
+func MarkApplied(ctx context.Context, dbManager *db.DBManager, mig Migration) error {
+	if err := dbManager.UpgradeVersionTable(ctx); err != nil {
+		return err
+	}
+	if _, err := dbManager.ExecStatements(ctx, []adapters.Statement{appliedRecord(mig)}, false); err != nil {
 		return fmt.Errorf("falha ao registrar a migração %s: %v", mig.Version, err)
 	}
 	return nil
 }
 
+// appliedRecord is the schema_migrations row of an applied migration.
+func appliedRecord(mig Migration) adapters.Statement {
+	meta := mig.Metadata
+	desc := meta.Description
+	if desc == "" {
+		desc = fmt.Sprintf("Migration %s applied", mig.Version)
+	}
+	return adapters.Statement{
+		Query: `INSERT INTO schema_migrations
+			(version, description, checksum, name, author, tags, no_transaction, depends_on)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		Args: []interface{}{mig.Version, desc, mig.Checksum, mig.Name, meta.Author,
+			strings.Join(meta.Tags, ","), meta.NoTransaction, strings.Join(meta.DependsOn, ",")},
+	}
+}
+
+// execStatements runs the statements one at a time so that the statement
+// timeout applies to each of them and an interruption can report progress.
+// record updates schema_migrations afterwards; unless the migration is
+// marked no-transaction or changes a table online, everything runs in one
+// transaction. MySQL still commits DDL statements implicitly.
+func execStatements(ctx context.Context, dbManager *db.DBManager, mig Migration, script []string, record adapters.Statement, online *Online) error {
+	if online == nil {
+		online = &Online{}
+	}
+	steps, err := online.plan(ctx, dbManager, mig, script)
+	if err != nil {
+		return err
+	}
+	if steps != nil {
+		return online.execSteps(ctx, dbManager, mig, steps, record)
+	}
+	stmts := make([]adapters.Statement, 0, len(script)+1)
+	for _, stmt := range script {
+		stmts = append(stmts, adapters.Statement{Query: stmt})
+	}
+	total := len(script)
+	executed, err := dbManager.ExecStatements(ctx, append(stmts, record), !mig.Metadata.NoTransaction)
+	if err == nil {
+		return nil
+	}
+	if executed == total {
+		return fmt.Errorf("falha ao registrar a migração %s: %v", mig.Version, err)
+	}
+	if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+		return &InterruptedError{Version: mig.Version, Executed: executed, Total: total, Err: err}
+	}
+	return err
+}
 
 
 func extractType(detail string) string {
@@ -0,0 +1,650 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"db-pivot/internal/adapters"
+	"db-pivot/internal/db"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Online configures online schema changes. An online ALTER TABLE is applied
+// to an empty copy of the table, the shadow table; the rows are copied over
+// in primary key order, a chunk per statement, while triggers carry every
+// write to the original across; and RENAME TABLE swaps the two atomically.
+// The table stays writable throughout, and the copy can be throttled.
+type Online struct {
+	// ThresholdRows runs the ALTER TABLE statements of tables estimated to
+	// hold at least this many rows online. Zero leaves it to migrations
+	// whose header says "online: true".
+	ThresholdRows int64
+	// ChunkSize is the number of rows copied per statement. Zero means
+	// defaultChunkSize.
+	ChunkSize int
+	// MaxRowsPerSecond caps the copy rate. Zero means no limit.
+	MaxRowsPerSecond int
+	// Replicas are checked before every chunk; the copy waits while any of
+	// them lags more than MaxReplicaLag behind.
+	Replicas      []*db.DBManager
+	MaxReplicaLag time.Duration
+	// Logf reports progress. Nil discards it.
+	Logf func(format string, args ...interface{})
+}
+
+const (
+	defaultChunkSize = 1000
+	// progressInterval is how often the copy reports progress.
+	progressInterval = 10 * time.Second
+	// cleanupTimeout bounds the statements that remove the shadow table and
+	// triggers after a failure, which run even when ctx was cancelled.
+	cleanupTimeout = 30 * time.Second
+)
+
+func (o *Online) logf(format string, args ...interface{}) {
+	if o.Logf != nil {
+		o.Logf(format, args...)
+	}
+}
+
+// step is a statement of a migration, or consecutive ALTER TABLE statements
+// on one table run together as an online change.
+type step struct {
+	stmt   string
+	online *onlineChange
+	// count is the number of statements of the migration the step covers.
+	count int
+}
+
+// onlineChange is an ALTER TABLE run online. schema is empty for tables of
+// the connection's database.
+type onlineChange struct {
+	schema, table string
+	specs         []string
+}
+
+var (
+	alterTable = regexp.MustCompile("(?is)^\\s*ALTER\\s+TABLE\\s+(?:(`[^`]+`|[\\w$]+)\\.)?(`[^`]+`|[\\w$]+)\\s+(.+?)[\\s;]*$")
+	// offlineClause matches the leading keywords of the ALTER TABLE clauses
+	// a shadow table cannot take: renames, partition maintenance, foreign
+	// keys and tablespaces. Matching from the start of each clause keeps a
+	// column named change or partition from being taken for one.
+	offlineClause = regexp.MustCompile("(?i)^\\s*(?:ADD\\s+CONSTRAINT\\s+(?:`[^`]+`|\\w+)\\s+)?(RENAME\\s+(?:TO|AS|COLUMN)|CHANGE|(?:ADD|DROP|DISCARD|IMPORT|REORGANIZE|COALESCE|TRUNCATE|EXCHANGE|ANALYZE|CHECK|OPTIMIZE|REBUILD|REPAIR)\\s+PARTITION|(?:ADD\\s+|DROP\\s+)?FOREIGN\\s+KEY|(?:DISCARD|IMPORT)\\s+TABLESPACE|TABLESPACE)\\b")
+	// partitionOptions matches the partitioning options that follow the
+	// clauses without a comma.
+	partitionOptions = regexp.MustCompile(`(?i)\b(PARTITION\s+BY|REMOVE\s+PARTITIONING)\b`)
+	renameTarget     = regexp.MustCompile(`(?i)^\s*RENAME\s+(?:TO|AS)?\s*\S+\s*$`)
+	// algorithmClauses match the ALGORITHM and LOCK clauses a statement
+	// ends with. Nothing uses the shadow table, so they are dropped.
+	algorithmClauses = regexp.MustCompile(`(?i)(\s*,\s*(?:ALGORITHM|LOCK)\s*=\s*\w+)+$`)
+)
+
+// parseAlter splits an ALTER TABLE statement into its table and clauses.
+// Plain renames are left alone: they only change metadata.
+func parseAlter(stmt string) (schema, table, spec string, ok bool) {
+	m := alterTable.FindStringSubmatch(stmt)
+	if m == nil || renameTarget.MatchString(m[3]) {
+		return "", "", "", false
+	}
+	return strings.Trim(m[1], "`"), strings.Trim(m[2], "`"), algorithmClauses.ReplaceAllString(m[3], ""), true
+}
+
+// offlineSpecClause returns the keywords of the first clause of spec that
+// cannot run online, or "" when every clause can.
+func offlineSpecClause(spec string) string {
+	for _, clause := range SplitClauses(spec) {
+		if m := offlineClause.FindStringSubmatch(clause); m != nil {
+			return strings.Join(strings.Fields(m[1]), " ")
+		}
+	}
+	if m := partitionOptions.FindStringSubmatch(spec); m != nil {
+		return strings.Join(strings.Fields(m[1]), " ")
+	}
+	return ""
+}
+
+// runsOnline tells whether an ALTER TABLE of a table holding about rows
+// rows runs online, given the "-- online:" setting mode of its migration.
+// o may be nil.
+func (o *Online) runsOnline(mode *bool, rows int64) bool {
+	if mode != nil {
+		return *mode
+	}
+	return o != nil && o.ThresholdRows > 0 && rows >= o.ThresholdRows
+}
+
+// plan groups the statements of mig into steps when any of them runs
+// online, and returns nil when none does.
+func (o *Online) plan(ctx context.Context, dbManager *db.DBManager, mig Migration, script []string) ([]step, error) {
+	mode := mig.Metadata.Online
+	if mode != nil && !*mode || mode == nil && o.ThresholdRows <= 0 {
+		return nil, nil
+	}
+	var steps []step
+	hasOnline := false
+	for _, stmt := range script {
+		schema, table, spec, ok := parseAlter(stmt)
+		if ok && mode == nil {
+			rows, err := estimateRows(ctx, dbManager, schema, table)
+			if err != nil {
+				return nil, err
+			}
+			ok = o.runsOnline(mode, rows)
+		}
+		if !ok {
+			steps = append(steps, step{stmt: stmt, count: 1})
+			continue
+		}
+		if m := offlineSpecClause(spec); m != "" {
+			return nil, fmt.Errorf("the change to %s cannot run online (%s); mark migration %s with \"-- online: false\" to run it directly", table, strings.ToUpper(m), mig.Version)
+		}
+		hasOnline = true
+		if n := len(steps); n > 0 {
+			if last := steps[n-1].online; last != nil && last.schema == schema && last.table == table {
+				last.specs = append(last.specs, spec)
+				steps[n-1].count++
+				continue
+			}
+		}
+		steps = append(steps, step{online: &onlineChange{schema: schema, table: table, specs: []string{spec}}, count: 1})
+	}
+	if !hasOnline {
+		return nil, nil
+	}
+	return steps, nil
+}
+
+// estimateRows returns the row count information_schema estimates for a
+// table, or zero when it does not exist yet.
+func estimateRows(ctx context.Context, dbManager *db.DBManager, schema, table string) (int64, error) {
+	var rows sql.NullInt64
+	err := dbManager.QueryRow(ctx, `
+		SELECT TABLE_ROWS FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?`, schema, table).Scan(&rows)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to estimate the rows of %s: %v", table, err)
+	}
+	return rows.Int64, nil
+}
+
+// execSteps runs the steps of a migration that changes tables online.
+// Online changes cannot share a transaction, so every statement runs on its
+// own and record is written once all of them succeed.
+func (o *Online) execSteps(ctx context.Context, dbManager *db.DBManager, mig Migration, steps []step, record adapters.Statement) error {
+	total := 0
+	for _, s := range steps {
+		total += s.count
+	}
+	executed := 0
+	for _, s := range steps {
+		var err error
+		if s.online != nil {
+			err = o.run(ctx, dbManager, *s.online)
+		} else {
+			_, err = dbManager.ExecStatements(ctx, []adapters.Statement{{Query: s.stmt}}, false)
+		}
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+				return &InterruptedError{Version: mig.Version, Executed: executed, Total: total, Err: err}
+			}
+			return err
+		}
+		executed += s.count
+	}
+	if _, err := dbManager.ExecStatements(ctx, []adapters.Statement{record}, false); err != nil {
+		return fmt.Errorf("failed to record migration %s: %v", mig.Version, err)
+	}
+	return nil
+}
+
+// shadow names the tables and triggers of an online change.
+type shadow struct {
+	table, copy, old       string
+	insert, update, delete string
+	pk, columns            []string
+}
+
+// run applies an online change: it creates and alters the shadow table,
+// installs the triggers, copies the rows and swaps the tables. Until the
+// swap, a failure drops the shadow table and triggers again and leaves the
+// original untouched.
+func (o *Online) run(ctx context.Context, dbManager *db.DBManager, c onlineChange) error {
+	qualify := func(name string) string {
+		if c.schema != "" {
+			return quoteIdent(c.schema) + "." + quoteIdent(name)
+		}
+		return quoteIdent(name)
+	}
+	if len(c.table) > 58 {
+		return fmt.Errorf("table name %s is too long for an online change", c.table)
+	}
+	s := shadow{
+		table:  qualify(c.table),
+		copy:   qualify("_" + c.table + "_new"),
+		old:    qualify("_" + c.table + "_old"),
+		insert: qualify("_" + c.table + "_ins"),
+		update: qualify("_" + c.table + "_upd"),
+		delete: qualify("_" + c.table + "_del"),
+	}
+	if err := o.check(ctx, dbManager, c); err != nil {
+		return err
+	}
+	pk, err := primaryKey(ctx, dbManager, c.schema, c.table)
+	if err != nil {
+		return err
+	}
+	if len(pk) == 0 {
+		return fmt.Errorf("table %s has no primary key, which an online change needs", c.table)
+	}
+	s.pk = pk
+
+	alter := fmt.Sprintf("ALTER TABLE %s %s", s.copy, strings.Join(c.specs, ", "))
+	o.logf("Altering %s online: %s", c.table, strings.Join(c.specs, ", "))
+	if err := exec(ctx, dbManager, fmt.Sprintf("CREATE TABLE %s LIKE %s", s.copy, s.table)); err != nil {
+		return fmt.Errorf("failed to create the shadow table of %s: %v", c.table, err)
+	}
+	if err := o.copyTable(ctx, dbManager, c, &s, alter); err != nil {
+		cleanup(dbManager, o, s)
+		return err
+	}
+
+	if err := exec(ctx, dbManager, fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s", s.table, s.old, s.copy, s.table)); err != nil {
+		cleanup(dbManager, o, s)
+		return fmt.Errorf("failed to swap %s with its shadow table: %v", c.table, err)
+	}
+	// The swap is done; what is left only tidies up and must not fail the
+	// migration.
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	for _, stmt := range []string{
+		"DROP TRIGGER IF EXISTS " + s.insert,
+		"DROP TRIGGER IF EXISTS " + s.update,
+		"DROP TRIGGER IF EXISTS " + s.delete,
+		"DROP TABLE IF EXISTS " + s.old,
+	} {
+		if err := exec(cleanupCtx, dbManager, stmt); err != nil {
+			o.logf("WARNING: %s failed: %v", stmt, err)
+		}
+	}
+	o.logf("Online change of %s done", c.table)
+	return nil
+}
+
+// check refuses tables an online change would break: triggers and foreign
+// keys stay with the original table when it is renamed away, and a shadow
+// table left by an earlier run is not overwritten.
+func (o *Online) check(ctx context.Context, dbManager *db.DBManager, c onlineChange) error {
+	var count int
+	err := dbManager.QueryRow(ctx, `
+		SELECT COUNT(*) FROM information_schema.TRIGGERS
+		WHERE EVENT_OBJECT_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND EVENT_OBJECT_TABLE = ?`, c.schema, c.table).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %v", c.table, err)
+	}
+	if count > 0 {
+		return fmt.Errorf("table %s has triggers, which an online change would lose", c.table)
+	}
+	err = dbManager.QueryRow(ctx, `
+		SELECT COUNT(*) FROM information_schema.KEY_COLUMN_USAGE
+		WHERE REFERENCED_TABLE_NAME IS NOT NULL AND (
+		      TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?
+		   OR REFERENCED_TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND REFERENCED_TABLE_NAME = ?)`,
+		c.schema, c.table, c.schema, c.table).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %v", c.table, err)
+	}
+	if count > 0 {
+		return fmt.Errorf("table %s has foreign keys, which an online change does not keep", c.table)
+	}
+	err = dbManager.QueryRow(ctx, `
+		SELECT COUNT(*) FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME IN (?, ?)`,
+		c.schema, "_"+c.table+"_new", "_"+c.table+"_old").Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %v", c.table, err)
+	}
+	if count > 0 {
+		return fmt.Errorf("_%s_new or _%s_old already exists, left by an interrupted online change; drop it before trying again", c.table, c.table)
+	}
+	return nil
+}
+
+// copyTable alters the shadow table, installs the triggers and copies the
+// rows.
+func (o *Online) copyTable(ctx context.Context, dbManager *db.DBManager, c onlineChange, s *shadow, alter string) error {
+	if err := exec(ctx, dbManager, alter); err != nil {
+		return fmt.Errorf("failed to alter the shadow table of %s: %v", c.table, err)
+	}
+	shadowPK, err := primaryKey(ctx, dbManager, c.schema, "_"+c.table+"_new")
+	if err != nil {
+		return err
+	}
+	if strings.Join(shadowPK, ",") != strings.Join(s.pk, ",") {
+		return fmt.Errorf("the change alters the primary key of %s, which an online change does not support", c.table)
+	}
+	if s.columns, err = sharedColumns(ctx, dbManager, c); err != nil {
+		return err
+	}
+
+	for _, stmt := range triggers(*s) {
+		if err := exec(ctx, dbManager, stmt); err != nil {
+			return fmt.Errorf("failed to create the triggers of %s: %v", c.table, err)
+		}
+	}
+
+	estimate, err := estimateRows(ctx, dbManager, c.schema, c.table)
+	if err != nil {
+		return err
+	}
+	return o.copyRows(ctx, dbManager, c.table, *s, estimate)
+}
+
+// triggers keep the shadow table in step with writes to the original while
+// the rows are copied. REPLACE and DELETE IGNORE make them agree with the
+// copy whichever of the two reaches a row first.
+func triggers(s shadow) []string {
+	cols := quoteList(s.columns)
+	newValues := prefixList("NEW.", s.columns)
+	pk := "(" + quoteList(s.pk) + ")"
+	oldPK := "(" + prefixList("OLD.", s.pk) + ")"
+	newPK := "(" + prefixList("NEW.", s.pk) + ")"
+	replace := fmt.Sprintf("REPLACE INTO %s (%s) VALUES (%s)", s.copy, cols, newValues)
+	return []string{
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s FOR EACH ROW %s", s.insert, s.table, replace),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s FOR EACH ROW BEGIN DELETE IGNORE FROM %s WHERE NOT (%s <=> %s) AND %s <=> %s; %s; END",
+			s.update, s.table, s.copy, oldPK, newPK, pk, oldPK, replace),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s FOR EACH ROW DELETE IGNORE FROM %s WHERE %s <=> %s", s.delete, s.table, s.copy, pk, oldPK),
+	}
+}
+
+// copyRows copies the rows of the original table into the shadow table, a
+// chunk of primary keys at a time. Rows the triggers already wrote are
+// newer and are kept.
+func (o *Online) copyRows(ctx context.Context, dbManager *db.DBManager, table string, s shadow, estimate int64) error {
+	chunk := o.ChunkSize
+	if chunk <= 0 {
+		chunk = defaultChunkSize
+	}
+	pk := "(" + quoteList(s.pk) + ")"
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(s.pk)), ", ") + ")"
+	cols := quoteList(s.columns)
+
+	started := time.Now()
+	reported := started
+	var copied int64
+	var lower []interface{}
+	for {
+		if err := o.throttle(ctx, copied, started); err != nil {
+			return err
+		}
+		where := ""
+		if lower != nil {
+			where = fmt.Sprintf(" WHERE %s > %s", pk, placeholders)
+		}
+		upper, err := chunkEnd(ctx, dbManager, fmt.Sprintf("SELECT %s FROM %s FORCE INDEX (PRIMARY)%s ORDER BY %s LIMIT 1 OFFSET %d",
+			quoteList(s.pk), s.table, where, quoteList(s.pk), chunk-1), lower, len(s.pk))
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %v", table, err)
+		}
+
+		conds := []string{}
+		args := append([]interface{}{}, lower...)
+		if lower != nil {
+			conds = append(conds, fmt.Sprintf("%s > %s", pk, placeholders))
+		}
+		if upper != nil {
+			conds = append(conds, fmt.Sprintf("%s <= %s", pk, placeholders))
+			args = append(args, upper...)
+		}
+		stmt := fmt.Sprintf("INSERT IGNORE INTO %s (%s) SELECT %s FROM %s FORCE INDEX (PRIMARY)", s.copy, cols, cols, s.table)
+		if len(conds) > 0 {
+			stmt += " WHERE " + strings.Join(conds, " AND ")
+		}
+		if _, err := dbManager.ExecStatements(ctx, []adapters.Statement{{Query: stmt, Args: args}}, false); err != nil {
+			return fmt.Errorf("failed to copy %s: %v", table, err)
+		}
+		if upper == nil {
+			break
+		}
+		copied += int64(chunk)
+		lower = upper
+		if time.Since(reported) >= progressInterval {
+			reported = time.Now()
+			if estimate > 0 {
+				o.logf("Copying %s: %d of ~%d rows (%d%%)", table, copied, estimate, min(copied*100/estimate, 99))
+			} else {
+				o.logf("Copying %s: %d rows", table, copied)
+			}
+		}
+	}
+	o.logf("Copy of %s done in %s", table, time.Since(started).Round(time.Second))
+	return nil
+}
+
+// chunkEnd returns the primary key that ends the next chunk, or nil when
+// fewer rows than a chunk are left.
+func chunkEnd(ctx context.Context, dbManager *db.DBManager, query string, args []interface{}, n int) ([]interface{}, error) {
+	rows, err := dbManager.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	raw := make([]sql.RawBytes, n)
+	dest := make([]interface{}, n)
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	key := make([]interface{}, n)
+	for i, b := range raw {
+		key[i] = string(b)
+	}
+	return key, rows.Err()
+}
+
+// throttle waits until the copy is back under MaxRowsPerSecond and no
+// replica lags more than MaxReplicaLag.
+func (o *Online) throttle(ctx context.Context, copied int64, started time.Time) error {
+	if o.MaxRowsPerSecond > 0 {
+		due := started.Add(time.Duration(float64(copied) / float64(o.MaxRowsPerSecond) * float64(time.Second)))
+		if err := sleep(ctx, time.Until(due)); err != nil {
+			return err
+		}
+	}
+	waiting := false
+	for {
+		lagging, err := o.lagging(ctx)
+		if err != nil {
+			return err
+		}
+		if lagging == "" {
+			if waiting {
+				o.logf("Replicas caught up; resuming the copy")
+			}
+			return nil
+		}
+		if !waiting {
+			o.logf("Copy paused: %s", lagging)
+			waiting = true
+		}
+		if err := sleep(ctx, time.Second); err != nil {
+			return err
+		}
+	}
+}
+
+// lagging describes the first replica that is more than MaxReplicaLag
+// behind or not replicating, or returns "" when all of them keep up.
+func (o *Online) lagging(ctx context.Context) (string, error) {
+	for i, replica := range o.Replicas {
+		lag, running, err := replicaLag(ctx, replica)
+		if err != nil {
+			return "", fmt.Errorf("failed to query replica %d: %v", i+1, err)
+		}
+		if !running {
+			return fmt.Sprintf("replica %d is not replicating", i+1), nil
+		}
+		if lag > o.MaxReplicaLag {
+			return fmt.Sprintf("replica %d is %s behind", i+1, lag), nil
+		}
+	}
+	return "", nil
+}
+
+// replicaLag reads Seconds_Behind_Source from SHOW REPLICA STATUS, or from
+// SHOW SLAVE STATUS on servers older than MySQL 8.0.22. running is false
+// when replication is stopped.
+func replicaLag(ctx context.Context, replica *db.DBManager) (lag time.Duration, running bool, err error) {
+	rows, err := replica.Query(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		rows, err = replica.Query(ctx, "SHOW SLAVE STATUS")
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, false, err
+	}
+	if !rows.Next() {
+		return 0, false, errors.New("the server is not a replica")
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, false, err
+	}
+	for i, col := range columns {
+		if col != "Seconds_Behind_Source" && col != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, false, nil
+		}
+		var seconds int64
+		if _, err := fmt.Sscan(values[i].String, &seconds); err != nil {
+			return 0, false, err
+		}
+		return time.Duration(seconds) * time.Second, true, nil
+	}
+	return 0, false, errors.New("Seconds_Behind_Source not found")
+}
+
+// primaryKey lists the primary key columns of a table in key order.
+func primaryKey(ctx context.Context, dbManager *db.DBManager, schema, table string) ([]string, error) {
+	rows, err := dbManager.Query(ctx, `
+		SELECT COLUMN_NAME FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ? AND INDEX_NAME = 'PRIMARY'
+		ORDER BY SEQ_IN_INDEX`, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the primary key of %s: %v", table, err)
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// sharedColumns lists the columns the original and shadow tables have in
+// common, in the original's order. Columns the change adds get their
+// defaults; generated columns of the shadow table compute themselves.
+func sharedColumns(ctx context.Context, dbManager *db.DBManager, c onlineChange) ([]string, error) {
+	rows, err := dbManager.Query(ctx, `
+		SELECT o.COLUMN_NAME FROM information_schema.COLUMNS o
+		JOIN information_schema.COLUMNS s
+		  ON s.TABLE_SCHEMA = o.TABLE_SCHEMA AND s.TABLE_NAME = ? AND s.COLUMN_NAME = o.COLUMN_NAME
+		WHERE o.TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND o.TABLE_NAME = ?
+		  AND s.EXTRA NOT LIKE '%VIRTUAL GENERATED%' AND s.EXTRA NOT LIKE '%STORED GENERATED%'
+		ORDER BY o.ORDINAL_POSITION`, "_"+c.table+"_new", c.schema, c.table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the columns of %s: %v", c.table, err)
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// cleanup drops the triggers and shadow table of a failed online change.
+// It runs on a fresh context so that an interrupted change is cleaned up
+// too.
+func cleanup(dbManager *db.DBManager, o *Online, s shadow) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	for _, stmt := range []string{
+		"DROP TRIGGER IF EXISTS " + s.insert,
+		"DROP TRIGGER IF EXISTS " + s.update,
+		"DROP TRIGGER IF EXISTS " + s.delete,
+		"DROP TABLE IF EXISTS " + s.copy,
+	} {
+		if err := exec(ctx, dbManager, stmt); err != nil {
+			o.logf("WARNING: %s failed: %v", stmt, err)
+		}
+	}
+}
+
+func exec(ctx context.Context, dbManager *db.DBManager, query string) error {
+	_, err := dbManager.ExecStatements(ctx, []adapters.Statement{{Query: query}}, false)
+	return err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func quoteList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func prefixList(prefix string, names []string) string {
+	prefixed := make([]string, len(names))
+	for i, name := range names {
+		prefixed[i] = prefix + quoteIdent(name)
+	}
+	return strings.Join(prefixed, ", ")
+}
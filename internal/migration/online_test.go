@@ -0,0 +1,146 @@
+package migration
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAlter(t *testing.T) {
+	tests := []struct {
+		stmt                string
+		schema, table, spec string
+		ok                  bool
+	}{
+		{"ALTER TABLE users ADD email VARCHAR(255);", "", "users", "ADD email VARCHAR(255)", true},
+		{"ALTER TABLE `app`.`users` DROP COLUMN email", "app", "users", "DROP COLUMN email", true},
+		{"ALTER TABLE users MODIFY name VARCHAR(200) NOT NULL, ALGORITHM=INPLACE, LOCK=NONE;", "", "users", "MODIFY name VARCHAR(200) NOT NULL", true},
+		{"alter table users\n  add index idx_name (name),\n  algorithm=instant ;", "", "users", "add index idx_name (name)", true},
+		{"ALTER TABLE users RENAME TO accounts;", "", "", "", false},
+		{"ALTER TABLE users RENAME accounts", "", "", "", false},
+		{"CREATE TABLE users (id INT);", "", "", "", false},
+	}
+	for _, tt := range tests {
+		schema, table, spec, ok := parseAlter(tt.stmt)
+		if schema != tt.schema || table != tt.table || spec != tt.spec || ok != tt.ok {
+			t.Errorf("parseAlter(%q) = %q, %q, %q, %v, want %q, %q, %q, %v", tt.stmt, schema, table, spec, ok, tt.schema, tt.table, tt.spec, tt.ok)
+		}
+	}
+}
+
+func TestOfflineSpecClause(t *testing.T) {
+	tests := []struct {
+		spec, want string
+	}{
+		{"ADD email VARCHAR(255), ADD INDEX idx_email (email)", ""},
+		{"MODIFY name VARCHAR(200) NOT NULL", ""},
+		{"ADD `change` INT, ADD partition_key INT", ""},
+		{"MODIFY tablespace_name VARCHAR(64)", ""},
+		{"CHANGE name full_name VARCHAR(200)", "CHANGE"},
+		{"ADD email VARCHAR(255), RENAME COLUMN name TO full_name", "RENAME COLUMN"},
+		{"ADD CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id)", "FOREIGN KEY"},
+		{"DROP FOREIGN KEY fk_user", "DROP FOREIGN KEY"},
+		{"DROP PARTITION p2020", "DROP PARTITION"},
+		{"REORGANIZE PARTITION pmax INTO (PARTITION p1 VALUES LESS THAN (10))", "REORGANIZE PARTITION"},
+		{"ADD id2 INT PARTITION BY HASH (id) PARTITIONS 4", "PARTITION BY"},
+		{"REMOVE PARTITIONING", "REMOVE PARTITIONING"},
+		{"DISCARD TABLESPACE", "DISCARD TABLESPACE"},
+	}
+	for _, tt := range tests {
+		if got := offlineSpecClause(tt.spec); got != tt.want {
+			t.Errorf("offlineSpecClause(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestRunsOnline(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name   string
+		online *Online
+		mode   *bool
+		rows   int64
+		want   bool
+	}{
+		{"no config", nil, nil, 1e9, false},
+		{"no threshold", &Online{}, nil, 1e9, false},
+		{"below the threshold", &Online{ThresholdRows: 1000}, nil, 999, false},
+		{"at the threshold", &Online{ThresholdRows: 1000}, nil, 1000, true},
+		{"forced on", nil, &yes, 0, true},
+		{"forced off", &Online{ThresholdRows: 1}, &no, 1e9, false},
+	}
+	for _, tt := range tests {
+		if got := tt.online.runsOnline(tt.mode, tt.rows); got != tt.want {
+			t.Errorf("%s: runsOnline = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestPlan plans migrations marked "online: true", which needs no row
+// estimates from the server.
+func TestPlan(t *testing.T) {
+	online := true
+	mig := Migration{Version: "0002", Metadata: Metadata{Online: &online}}
+	o := &Online{}
+
+	steps, err := o.plan(context.Background(), nil, mig, []string{
+		"ALTER TABLE users ADD email VARCHAR(255);",
+		"ALTER TABLE users ADD INDEX idx_email (email), ALGORITHM=INPLACE, LOCK=NONE;",
+		"UPDATE users SET email = '';",
+		"ALTER TABLE users RENAME TO accounts;",
+		"ALTER TABLE app.orders DROP COLUMN note;",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type summary struct {
+		stmt, table string
+		specs       []string
+		count       int
+	}
+	var got []summary
+	for _, s := range steps {
+		if s.online == nil {
+			got = append(got, summary{stmt: s.stmt, count: s.count})
+			continue
+		}
+		got = append(got, summary{table: s.online.schema + "." + s.online.table, specs: s.online.specs, count: s.count})
+	}
+	want := []summary{
+		{table: ".users", specs: []string{"ADD email VARCHAR(255)", "ADD INDEX idx_email (email)"}, count: 2},
+		{stmt: "UPDATE users SET email = '';", count: 1},
+		{stmt: "ALTER TABLE users RENAME TO accounts;", count: 1},
+		{table: "app.orders", specs: []string{"DROP COLUMN note"}, count: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("plan\n%+v\nwant\n%+v", got, want)
+	}
+
+	if _, err := o.plan(context.Background(), nil, mig, []string{"ALTER TABLE users CHANGE name full_name VARCHAR(200);"}); err == nil || !strings.Contains(err.Error(), "CHANGE") {
+		t.Errorf("plan of a CHANGE clause: %v", err)
+	}
+
+	offline := false
+	steps, err = o.plan(context.Background(), nil, Migration{Metadata: Metadata{Online: &offline}}, []string{"ALTER TABLE users ADD email VARCHAR(255);"})
+	if err != nil || steps != nil {
+		t.Errorf("plan of an offline migration = %+v, %v", steps, err)
+	}
+}
+
+func TestTriggers(t *testing.T) {
+	s := shadow{
+		table: "`users`", copy: "`_users_new`",
+		insert: "`_users_ins`", update: "`_users_upd`", delete: "`_users_del`",
+		pk: []string{"id"}, columns: []string{"id", "name"},
+	}
+	want := []string{
+		"CREATE TRIGGER `_users_ins` AFTER INSERT ON `users` FOR EACH ROW REPLACE INTO `_users_new` (`id`, `name`) VALUES (NEW.`id`, NEW.`name`)",
+		"CREATE TRIGGER `_users_upd` AFTER UPDATE ON `users` FOR EACH ROW BEGIN DELETE IGNORE FROM `_users_new` WHERE NOT ((OLD.`id`) <=> (NEW.`id`)) AND (`id`) <=> (OLD.`id`); " +
+			"REPLACE INTO `_users_new` (`id`, `name`) VALUES (NEW.`id`, NEW.`name`); END",
+		"CREATE TRIGGER `_users_del` AFTER DELETE ON `users` FOR EACH ROW DELETE IGNORE FROM `_users_new` WHERE (`id`) <=> (OLD.`id`)",
+	}
+	if got := triggers(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("triggers\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,375 @@
+package migration
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// Annotations understood in SQL migration files, in addition to the
+// "-- Up migration" and "-- Down migration" markers written by
+// GenerateMigration:
+//
+//	-- +dbpivot Up
+//	-- +dbpivot Down
+//	-- +dbpivot StatementBegin
+//	-- +dbpivot StatementEnd
+//
+// Everything between StatementBegin and StatementEnd is one statement, so
+// routine bodies need no DELIMITER lines.
+const annotationPrefix = "-- +dbpivot"
+
+type section int
+
+const (
+	noSection section = iota
+	upSection
+	downSection
+)
+
+func (s section) String() string {
+	switch s {
+	case upSection:
+		return "Up"
+	case downSection:
+		return "Down"
+	}
+	return "none"
+}
+
+// parsedScript is a migration script split into statements.
+type parsedScript struct {
+	up, down []string
+	hasDown  bool
+}
+
+// parseScript splits script into the statements of its Up and Down
+// sections. A single migration file starts in noSection and needs section
+// markers; the files of an up/down pair start in their own section and may
+// not contain any. Markers and annotations are only recognized between
+// statements, so a statement that happens to contain one is left alone.
+func parseScript(script string, start section) (parsedScript, error) {
+	var parsed parsedScript
+	var current strings.Builder
+	sec := start
+	seen := map[section]bool{start: true}
+	delimiter := ";"
+	inBlock := false
+	blockLine := 0
+	var scan scanner
+
+	add := func(stmt string) {
+		if sec == downSection {
+			parsed.down = append(parsed.down, stmt)
+		} else {
+			parsed.up = append(parsed.up, stmt)
+		}
+	}
+
+	for i, line := range strings.Split(script, "\n") {
+		lineNo := i + 1
+		trimmed := strings.TrimSpace(line)
+
+		if inBlock {
+			if annotation(trimmed) == "statementend" {
+				add(strings.TrimSpace(current.String()))
+				current.Reset()
+				inBlock = false
+				continue
+			}
+			current.WriteString(line + "\n")
+			continue
+		}
+
+		if current.Len() == 0 {
+			if marker := sectionMarker(trimmed); marker != noSection {
+				if start != noSection {
+					return parsedScript{}, fmt.Errorf("linha %d: marcador de seção %s em um arquivo .%s.sql", lineNo, marker, strings.ToLower(start.String()))
+				}
+				if seen[marker] {
+					return parsedScript{}, fmt.Errorf("linha %d: seção %s repetida", lineNo, marker)
+				}
+				if marker == upSection && seen[downSection] {
+					return parsedScript{}, fmt.Errorf("linha %d: seção Up depois da seção Down", lineNo)
+				}
+				seen[marker] = true
+				sec = marker
+				if marker == downSection {
+					parsed.hasDown = true
+				}
+				continue
+			}
+			switch annotation(trimmed) {
+			case "":
+			case "statementbegin":
+				if sec == noSection {
+					return parsedScript{}, fmt.Errorf("linha %d: StatementBegin fora de uma seção Up ou Down", lineNo)
+				}
+				inBlock = true
+				blockLine = lineNo
+				continue
+			case "statementend":
+				return parsedScript{}, fmt.Errorf("linha %d: StatementEnd sem StatementBegin", lineNo)
+			default:
+				return parsedScript{}, fmt.Errorf("linha %d: anotação desconhecida %q", lineNo, trimmed)
+			}
+			if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+				continue
+			}
+			if fields := strings.Fields(trimmed); len(fields) == 2 && strings.EqualFold(fields[0], "DELIMITER") {
+				delimiter = fields[1]
+				continue
+			}
+			if sec == noSection {
+				return parsedScript{}, fmt.Errorf("linha %d: instrução fora de uma seção Up ou Down", lineNo)
+			}
+		}
+
+		if end := scan.statementEnd(line, delimiter); end >= 0 {
+			current.WriteString(line[:end])
+			stmt := strings.TrimSpace(current.String())
+			if delimiter == ";" {
+				stmt += ";"
+			}
+			add(stmt)
+			current.Reset()
+			scan = scanner{}
+			continue
+		}
+		current.WriteString(line + "\n")
+	}
+
+	if inBlock {
+		return parsedScript{}, fmt.Errorf("linha %d: StatementBegin sem StatementEnd", blockLine)
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		add(rest)
+	}
+	if start == downSection {
+		parsed.hasDown = true
+	}
+	return parsed, nil
+}
+
+// scanner follows the quotes and comments of a statement across lines, so
+// that a delimiter inside them does not end it.
+type scanner struct {
+	quote   byte // the open quote, backtick or 0
+	comment bool // inside /* */
+}
+
+// statementEnd returns the offset of the delimiter that ends the statement
+// on line, or -1 when the statement goes on. The delimiter must be the last
+// thing on the line outside quotes, apart from comments.
+func (s *scanner) statementEnd(line, delimiter string) int {
+	end := -1
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case s.comment:
+			if strings.HasPrefix(line[i:], "*/") {
+				s.comment = false
+				i++
+			}
+		case s.quote != 0:
+			if c == '\\' && s.quote != '`' {
+				i++
+			} else if c == s.quote {
+				s.quote = 0
+			}
+		case strings.HasPrefix(line[i:], delimiter):
+			end = i
+			i += len(delimiter) - 1
+		case c == '#' || lineComment(line[i:]):
+			return end
+		case strings.HasPrefix(line[i:], "/*"):
+			s.comment = true
+			i++
+		case c == '\'' || c == '"' || c == '`':
+			s.quote = c
+			end = -1
+		case c != ' ' && c != '\t' && c != '\r':
+			end = -1
+		}
+	}
+	return end
+}
+
+// lineComment tells whether s starts a "-- " comment. MySQL needs the
+// dashes to be followed by whitespace or the end of the line.
+func lineComment(s string) bool {
+	return strings.HasPrefix(s, "--") && (len(s) == 2 || s[2] == ' ' || s[2] == '\t' || s[2] == '\r')
+}
+
+// sectionMarker returns the section a marker line starts.
+func sectionMarker(line string) section {
+	switch {
+	case strings.HasPrefix(line, upMarker):
+		return upSection
+	case strings.HasPrefix(line, downMarker):
+		return downSection
+	}
+	switch annotation(line) {
+	case "up":
+		return upSection
+	case "down":
+		return downSection
+	}
+	return noSection
+}
+
+// annotation returns the lower-cased keyword of a "-- +dbpivot" line.
+func annotation(line string) string {
+	rest, ok := strings.CutPrefix(line, annotationPrefix)
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(rest))
+}
+
+// ParseMigration parses a single migration file with Up and Down sections.
+func ParseMigration(file string, script []byte) (Migration, error) {
+	version, name, ok := ParseFileName(file)
+	if !ok {
+		return Migration{}, fmt.Errorf("%s não é um arquivo de migração", file)
+	}
+	parsed, err := parseScript(string(script), noSection)
+	if err != nil {
+		return Migration{}, fmt.Errorf("%s: %v", file, err)
+	}
+	return newMigration(version, name, []string{file}, string(script), "", parsed)
+}
+
+// ParseMigrationPair parses a migration split into an up file and an
+// optional down file. down is ignored when downFile is empty.
+func ParseMigrationPair(upFile string, up []byte, downFile string, down []byte) (Migration, error) {
+	version, name, ok := ParseFileName(upFile)
+	if !ok {
+		return Migration{}, fmt.Errorf("%s não é um arquivo de migração", upFile)
+	}
+	parsed, err := parseScript(string(up), upSection)
+	if err != nil {
+		return Migration{}, fmt.Errorf("%s: %v", upFile, err)
+	}
+	files := []string{upFile}
+	if downFile != "" {
+		parsedDown, err := parseScript(string(down), downSection)
+		if err != nil {
+			return Migration{}, fmt.Errorf("%s: %v", downFile, err)
+		}
+		parsed.down, parsed.hasDown = parsedDown.down, true
+		files = append(files, downFile)
+	}
+	return newMigration(version, name, files, string(up), string(down), parsed)
+}
+
+func newMigration(version, name string, files []string, upScript, downScript string, parsed parsedScript) (Migration, error) {
+	if len(parsed.up) == 0 {
+		return Migration{}, fmt.Errorf("%s: migração sem instruções Up", files[0])
+	}
+	meta, err := ParseMetadata(upScript)
+	if err != nil {
+		return Migration{}, fmt.Errorf("%s: %v", files[0], err)
+	}
+	return Migration{
+		Version:    version,
+		Name:       name,
+		Files:      files,
+		UpScript:   upScript,
+		DownScript: downScript,
+		Up:         parsed.up,
+		Down:       parsed.down,
+		Reversible: parsed.hasDown,
+		Checksum:   fmt.Sprintf("%x", sha256.Sum256([]byte(upScript+downScript))),
+		Metadata:   meta,
+	}, nil
+}
+
+// LoadMigrations reads and validates every SQL migration at the root of
+// fsys, ordered by version. A migration is either one "<version>_<name>.sql"
+// file with Up and Down sections, or a "<version>_<name>.up.sql" file with
+// an optional matching ".down.sql" file. SQL files with any other name are
+// returned in skipped.
+func LoadMigrations(fsys fs.FS) (migs []Migration, skipped []string, err error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type files struct{ single, up, down string }
+	byVersion := make(map[string]*files)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		file := entry.Name()
+		version, _, ok := ParseFileName(file)
+		if !ok {
+			if strings.HasSuffix(file, ".sql") {
+				skipped = append(skipped, file)
+			}
+			continue
+		}
+		f := byVersion[version]
+		if f == nil {
+			f = &files{}
+			byVersion[version] = f
+		}
+		slot := &f.single
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			slot = &f.up
+		case strings.HasSuffix(file, ".down.sql"):
+			slot = &f.down
+		}
+		if *slot != "" {
+			return nil, nil, fmt.Errorf("a migração %s está definida em %s e em %s", version, *slot, file)
+		}
+		*slot = file
+	}
+
+	migs = make([]Migration, 0, len(byVersion))
+	for version, f := range byVersion {
+		var mig Migration
+		switch {
+		case f.single != "" && (f.up != "" || f.down != ""):
+			return nil, nil, fmt.Errorf("a migração %s está definida em %s e em arquivos .up.sql/.down.sql", version, f.single)
+		case f.single != "":
+			script, err := fs.ReadFile(fsys, f.single)
+			if err != nil {
+				return nil, nil, err
+			}
+			if mig, err = ParseMigration(f.single, script); err != nil {
+				return nil, nil, err
+			}
+		case f.up == "":
+			return nil, nil, fmt.Errorf("%s não tem um arquivo .up.sql correspondente", f.down)
+		default:
+			up, err := fs.ReadFile(fsys, f.up)
+			if err != nil {
+				return nil, nil, err
+			}
+			var down []byte
+			if f.down != "" {
+				if down, err = fs.ReadFile(fsys, f.down); err != nil {
+					return nil, nil, err
+				}
+			}
+			if mig, err = ParseMigrationPair(f.up, up, f.down, down); err != nil {
+				return nil, nil, err
+			}
+		}
+		migs = append(migs, mig)
+	}
+	sort.Slice(migs, func(i, j int) bool {
+		return CompareVersions(migs[i].Version, migs[j].Version) < 0
+	})
+	for i := 1; i < len(migs); i++ {
+		if CompareVersions(migs[i-1].Version, migs[i].Version) == 0 {
+			return nil, nil, fmt.Errorf("as versões de %s e %s são o mesmo número", migs[i-1].Files[0], migs[i].Files[0])
+		}
+	}
+	return migs, skipped, nil
+}
@@ -0,0 +1,94 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseScriptStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "one per line",
+			script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			want:   []string{"CREATE TABLE a (id INT);", "CREATE TABLE b (id INT);"},
+		},
+		{
+			name:   "multi-line statement",
+			script: "CREATE TABLE a (\n  id INT\n);\n",
+			want:   []string{"CREATE TABLE a (\n  id INT\n);"},
+		},
+		{
+			name:   "trailing dash comment",
+			script: "ALTER TABLE t ADD c INT; -- why\nALTER TABLE t ADD d INT;\n",
+			want:   []string{"ALTER TABLE t ADD c INT;", "ALTER TABLE t ADD d INT;"},
+		},
+		{
+			name:   "trailing hash comment",
+			script: "ALTER TABLE t ADD c INT; # why\nALTER TABLE t ADD d INT;\n",
+			want:   []string{"ALTER TABLE t ADD c INT;", "ALTER TABLE t ADD d INT;"},
+		},
+		{
+			name:   "trailing block comment",
+			script: "ALTER TABLE t ADD c INT; /* why */\nALTER TABLE t ADD d INT;\n",
+			want:   []string{"ALTER TABLE t ADD c INT;", "ALTER TABLE t ADD d INT;"},
+		},
+		{
+			name:   "delimiter inside a comment",
+			script: "ALTER TABLE t -- first;\n  ADD c INT;\n",
+			want:   []string{"ALTER TABLE t -- first;\n  ADD c INT;"},
+		},
+		{
+			name:   "delimiter at the end of a string line",
+			script: "INSERT INTO t (v) VALUES ('a;\nb');\nINSERT INTO t (v) VALUES ('c');\n",
+			want:   []string{"INSERT INTO t (v) VALUES ('a;\nb');", "INSERT INTO t (v) VALUES ('c');"},
+		},
+		{
+			name:   "escaped and doubled quotes",
+			script: "INSERT INTO t (v) VALUES ('it\\'s;\n'), ('it''s;\n');\n",
+			want:   []string{"INSERT INTO t (v) VALUES ('it\\'s;\n'), ('it''s;\n');"},
+		},
+		{
+			name:   "delimiter in a quoted identifier",
+			script: "CREATE TABLE `a;\nb` (id INT);\n",
+			want:   []string{"CREATE TABLE `a;\nb` (id INT);"},
+		},
+		{
+			name:   "dashes without a space are not a comment",
+			script: "UPDATE t SET n = n--1;\n",
+			want:   []string{"UPDATE t SET n = n--1;"},
+		},
+		{
+			name: "delimiter block",
+			script: "DELIMITER $$\n" +
+				"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND$$ -- done\n" +
+				"DELIMITER ;\n" +
+				"CREATE TABLE a (id INT);\n",
+			want: []string{
+				"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND",
+				"CREATE TABLE a (id INT);",
+			},
+		},
+		{
+			name: "statement block",
+			script: "-- +dbpivot StatementBegin\n" +
+				"CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW\nBEGIN\n  SET NEW.v = 'x;';\nEND;\n" +
+				"-- +dbpivot StatementEnd\n",
+			want: []string{"CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW\nBEGIN\n  SET NEW.v = 'x;';\nEND;"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseScript(tt.script, upSection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed.up, tt.want) {
+				t.Errorf("got %q, want %q", parsed.up, tt.want)
+			}
+		})
+	}
+}
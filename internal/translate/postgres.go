@@ -0,0 +1,459 @@
+package translate
+
+import (
+	"db-pivot/internal/diff"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pgTranslator collects the statements and issues of a Postgres
+// translation.
+type pgTranslator struct {
+	schema   map[string]interface{}
+	issues   []Issue
+	tables   []string
+	indexes  []string
+	keys     []string
+	comments []string
+	// relations holds the index and table names taken in each Postgres
+	// schema. MySQL index names only need to be unique per table.
+	relations map[string]bool
+}
+
+func postgres(schema map[string]interface{}) Result {
+	t := &pgTranslator{schema: schema, relations: make(map[string]bool)}
+	var tables, schemas []string
+	seen := make(map[string]bool)
+	for _, name := range sortedNames(schema) {
+		switch kind := objectKind(schema[name]); kind {
+		case "table":
+			tables = append(tables, name)
+			t.relations[pgRelation(name, name)] = true
+			if db, _, qualified := strings.Cut(name, "."); qualified && !seen[db] {
+				seen[db] = true
+				schemas = append(schemas, db)
+			}
+		case "procedure", "function", "trigger":
+			t.report(name, strings.ToUpper(kind), "stored programs are written in MySQL's procedural SQL; rewrite it in PL/pgSQL")
+		}
+	}
+
+	var up []string
+	for _, db := range schemas {
+		up = append(up, "CREATE SCHEMA IF NOT EXISTS "+pgIdent(db))
+	}
+	for _, name := range tables {
+		t.table(name, schema[name].(map[string]interface{}))
+	}
+	up = append(up, t.tables...)
+	up = append(up, t.indexes...)
+	up = append(up, t.keys...)
+	up = append(up, t.comments...)
+
+	views := diff.ViewOrder(schema)
+	for _, name := range views {
+		up = append(up, t.view(name, schema[name].(map[string]interface{})))
+	}
+	t.collations(tables)
+
+	var down []string
+	for i := len(views) - 1; i >= 0; i-- {
+		down = append(down, "DROP VIEW IF EXISTS "+pgTable(views[i]))
+	}
+	for i := len(tables) - 1; i >= 0; i-- {
+		down = append(down, fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE", pgTable(tables[i])))
+	}
+	return Result{To: "postgres", Up: up, Down: down, Unmapped: t.issues}
+}
+
+func (t *pgTranslator) report(object, construct, reason string) {
+	t.issues = append(t.issues, Issue{Object: object, Construct: construct, Reason: reason})
+}
+
+// table translates a table into its CREATE TABLE statement, and queues its
+// indexes, foreign keys and comments, which follow every table.
+func (t *pgTranslator) table(name string, table map[string]interface{}) {
+	columns, _ := table["columns"].(map[string]interface{})
+	var defs []string
+	for _, col := range diff.ColumnOrder(columns) {
+		def, check := t.column(name, col, columns[col].(map[string]interface{}))
+		defs = append(defs, def)
+		if check != "" {
+			defs = append(defs, check)
+		}
+	}
+
+	indexes, _ := table["indexes"].(map[string]interface{})
+	for _, index := range sortedNames(indexes) {
+		data := indexes[index].(map[string]interface{})
+		if index == "PRIMARY" {
+			defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(t.keyParts(name, index, data), ", ")))
+			continue
+		}
+		t.index(name, index, data)
+	}
+
+	checks, _ := table["checks"].(map[string]interface{})
+	for _, check := range sortedNames(checks) {
+		def := fmt.Sprint(checks[check])
+		object := name + "." + check
+		if strings.HasSuffix(def, " NOT ENFORCED") {
+			t.report(object, "NOT ENFORCED", "Postgres enforces every CHECK constraint; left out")
+			continue
+		}
+		defs = append(defs, fmt.Sprintf("CONSTRAINT %s %s", pgIdent(check), t.expression(object, "CHECK", def)))
+	}
+
+	keys, _ := table["foreign_keys"].(map[string]interface{})
+	for _, key := range sortedNames(keys) {
+		t.keys = append(t.keys, fmt.Sprintf("ALTER TABLE %s ADD %s", pgTable(name), pgForeignKey(key, keys[key].(map[string]interface{}))))
+	}
+
+	options, _ := table["options"].(map[string]interface{})
+	if engine, _ := options["engine"].(string); engine != "" && !strings.EqualFold(engine, "InnoDB") {
+		t.report(name, "ENGINE="+engine, "Postgres has a single storage engine; created as a regular table")
+	}
+	if comment, _ := options["comment"].(string); comment != "" {
+		t.comments = append(t.comments, fmt.Sprintf("COMMENT ON TABLE %s IS %s", pgTable(name), pgLiteral(comment)))
+	}
+	if scheme, ok := table["partitioning"].(map[string]interface{}); ok {
+		t.report(name, fmt.Sprintf("PARTITION BY %v", scheme["method"]), "partitioning is not translated; declare Postgres partitions by hand")
+	}
+
+	t.tables = append(t.tables, fmt.Sprintf("CREATE TABLE %s (\n%s\n)", pgTable(name), strings.Join(defs, ",\n")))
+}
+
+// column translates a column definition. ENUM columns also return the CHECK
+// constraint that limits them to their values.
+func (t *pgTranslator) column(table, name string, col map[string]interface{}) (def, check string) {
+	object := table + "." + name
+	colType := fmt.Sprint(col["type"])
+	extra, _ := col["extra"].(string)
+	lowerExtra := strings.ToLower(extra)
+	pgType, values := t.columnType(object, colType, strings.Contains(lowerExtra, "auto_increment"))
+
+	def = pgIdent(name) + " " + pgType
+	if expr, _ := col["generated"].(string); expr != "" {
+		if storage, _ := col["storage"].(string); storage != "STORED" {
+			t.report(object, "VIRTUAL generated column", "Postgres only stores generated columns; translated as STORED")
+		}
+		def += fmt.Sprintf(" GENERATED ALWAYS AS (%s) STORED", t.expression(object, "generated column", expr))
+	}
+	if strings.Contains(lowerExtra, "auto_increment") {
+		switch pgType {
+		case "smallint", "integer", "bigint":
+			def += " GENERATED BY DEFAULT AS IDENTITY"
+		default:
+			t.report(object, "AUTO_INCREMENT", fmt.Sprintf("Postgres identity columns must be integers, not %s", pgType))
+		}
+	}
+	if null, _ := col["null"].(bool); !null {
+		def += " NOT NULL"
+	}
+	if defaultSQL, _ := col["default_sql"].(string); defaultSQL != "" {
+		def += " DEFAULT " + t.defaultValue(object, pgType, defaultSQL)
+	}
+	if strings.Contains(lowerExtra, "on update") {
+		t.report(object, "ON UPDATE CURRENT_TIMESTAMP", "Postgres needs a trigger to update the column; left out")
+	}
+	if comment, _ := col["comment"].(string); comment != "" {
+		t.comments = append(t.comments, fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s", pgTable(table), pgIdent(name), pgLiteral(comment)))
+	}
+	if values != "" {
+		check = fmt.Sprintf("CHECK (%s IN (%s))", pgIdent(name), values)
+	}
+	return def, check
+}
+
+var mysqlType = regexp.MustCompile(`^(\w+)(?:\((.*)\))?\s*(.*)$`)
+
+// columnType maps a MySQL column type to Postgres. For ENUM columns it also
+// returns the list of values, which become a CHECK constraint.
+func (t *pgTranslator) columnType(object, colType string, autoIncrement bool) (pgType, values string) {
+	m := mysqlType.FindStringSubmatch(strings.TrimSpace(colType))
+	if m == nil {
+		t.report(object, colType, "unrecognized type; copied as is")
+		return colType, ""
+	}
+	base, args, attrs := strings.ToLower(m[1]), m[2], strings.ToLower(m[3])
+	unsigned := strings.Contains(attrs, "unsigned")
+	if strings.Contains(attrs, "zerofill") {
+		t.report(object, "ZEROFILL", "Postgres does not pad numbers; format them when reading")
+	}
+	withArgs := func(pgType string) string {
+		if args == "" {
+			return pgType
+		}
+		return pgType + "(" + args + ")"
+	}
+
+	switch base {
+	case "tinyint":
+		if args == "1" && !unsigned {
+			return "boolean", ""
+		}
+		return "smallint", ""
+	case "smallint":
+		if unsigned {
+			return "integer", ""
+		}
+		return "smallint", ""
+	case "mediumint":
+		return "integer", ""
+	case "int", "integer":
+		if unsigned {
+			return "bigint", ""
+		}
+		return "integer", ""
+	case "bigint":
+		if unsigned && !autoIncrement {
+			t.report(object, colType, "Postgres has no unsigned bigint; values above 9223372036854775807 do not fit in bigint")
+		}
+		return "bigint", ""
+	case "decimal", "numeric", "dec", "fixed":
+		return withArgs("numeric"), ""
+	case "float":
+		if args != "" {
+			t.report(object, colType, "precision and scale are not kept; translated as real")
+		}
+		return "real", ""
+	case "double", "real":
+		return "double precision", ""
+	case "bit":
+		return withArgs("bit"), ""
+	case "char":
+		return withArgs("char"), ""
+	case "varchar":
+		return withArgs("varchar"), ""
+	case "tinytext", "text", "mediumtext", "longtext":
+		return "text", ""
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "bytea", ""
+	case "date":
+		return "date", ""
+	case "datetime":
+		return withArgs("timestamp"), ""
+	case "timestamp":
+		// MySQL converts TIMESTAMP values to and from UTC, which is what
+		// timestamp with time zone does.
+		return withArgs("timestamptz"), ""
+	case "time":
+		return withArgs("time"), ""
+	case "year":
+		return "smallint", ""
+	case "json":
+		return "jsonb", ""
+	case "enum":
+		return "text", args
+	case "set":
+		t.report(object, colType, "Postgres has no SET type; translated as text holding the comma-separated values")
+		return "text", ""
+	case "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection", "geomcollection":
+		t.report(object, colType, "spatial types need the PostGIS extension; translated as geometry")
+		return "geometry", ""
+	}
+	t.report(object, colType, "no Postgres equivalent; copied as is")
+	return colType, ""
+}
+
+// defaultValue translates the DEFAULT clause of a column.
+func (t *pgTranslator) defaultValue(object, pgType, value string) string {
+	switch {
+	case pgType == "boolean":
+		if strings.Trim(value, "'") == "0" {
+			return "FALSE"
+		}
+		return "TRUE"
+	case strings.HasPrefix(value, "("):
+		return t.expression(object, "DEFAULT", value)
+	case strings.HasPrefix(value, "'"):
+		// MySQL escapes backslashes in string literals; Postgres does not.
+		return strings.ReplaceAll(value, `\\`, `\`)
+	}
+	return value
+}
+
+// index queues the CREATE INDEX statement of a secondary index.
+func (t *pgTranslator) index(table, name string, index map[string]interface{}) {
+	object := table + "." + name
+	indexType, _ := index["type"].(string)
+	method := ""
+	switch indexType {
+	case "FULLTEXT":
+		t.report(object, "FULLTEXT index", "use a GIN index over to_tsvector(...) instead; left out")
+		return
+	case "SPATIAL":
+		method = " USING gist"
+	}
+	create := "CREATE INDEX"
+	if index["unique"] == true {
+		create = "CREATE UNIQUE INDEX"
+	}
+
+	pgName := name
+	if t.relations[pgRelation(table, pgName)] {
+		pgName = table[strings.LastIndex(table, ".")+1:] + "_" + name
+		t.report(object, "index name", fmt.Sprintf("index names are unique per schema in Postgres; renamed to %s", pgName))
+	}
+	t.relations[pgRelation(table, pgName)] = true
+
+	t.indexes = append(t.indexes, fmt.Sprintf("%s %s ON %s%s (%s)", create, pgIdent(pgName), pgTable(table), method,
+		strings.Join(t.keyParts(table, name, index), ", ")))
+}
+
+var prefixPart = regexp.MustCompile(`^(.+)\((\d+)\)$`)
+
+// keyParts translates the key parts of an index.
+func (t *pgTranslator) keyParts(table, name string, index map[string]interface{}) []string {
+	object := table + "." + name
+	var parts []string
+	for _, part := range stringList(index["columns"]) {
+		part, desc := strings.CutSuffix(part, " DESC")
+		switch {
+		case strings.HasPrefix(part, "("):
+			part = t.expression(object, "functional key part", part)
+		case prefixPart.MatchString(part):
+			m := prefixPart.FindStringSubmatch(part)
+			t.report(object, part, "Postgres has no prefix indexes; the whole column is indexed")
+			part = pgIdent(m[1])
+		default:
+			part = pgIdent(part)
+		}
+		if desc {
+			part += " DESC"
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+func pgForeignKey(name string, fk map[string]interface{}) string {
+	columns := stringList(fk["columns"])
+	refs := stringList(fk["referenced_columns"])
+	for i := range columns {
+		columns[i] = pgIdent(columns[i])
+	}
+	for i := range refs {
+		refs[i] = pgIdent(refs[i])
+	}
+	def := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)", pgIdent(name),
+		strings.Join(columns, ", "), pgTable(fmt.Sprint(fk["references"])), strings.Join(refs, ", "))
+	for _, rule := range []struct{ key, clause string }{{"on_delete", "ON DELETE"}, {"on_update", "ON UPDATE"}} {
+		switch action, _ := fk[rule.key].(string); action {
+		case "", "RESTRICT", "NO ACTION":
+		default:
+			def += " " + rule.clause + " " + action
+		}
+	}
+	return def
+}
+
+// view translates a view. Its definition keeps MySQL's SQL, with identifier
+// quoting and string literals converted.
+func (t *pgTranslator) view(name string, view map[string]interface{}) string {
+	object := "view:" + name
+	stmt := "CREATE VIEW " + pgTable(name)
+	if security, _ := view["securityType"].(string); strings.EqualFold(security, "INVOKER") {
+		stmt += " WITH (security_invoker = true)"
+	}
+	stmt += " AS " + t.expression(object, "definition", fmt.Sprint(view["definition"]))
+	if check, _ := view["checkOption"].(string); check != "" && !strings.EqualFold(check, "NONE") {
+		stmt += fmt.Sprintf(" WITH %s CHECK OPTION", strings.ToUpper(check))
+	}
+	return stmt
+}
+
+// collations reports the case-insensitive collations in use: MySQL compares
+// text in them ignoring case, Postgres' default collations do not.
+func (t *pgTranslator) collations(tables []string) {
+	seen := make(map[string]bool)
+	for _, name := range tables {
+		table := t.schema[name].(map[string]interface{})
+		options, _ := table["options"].(map[string]interface{})
+		collation, _ := options["collation"].(string)
+		if strings.HasSuffix(collation, "_ci") && !seen[collation] {
+			seen[collation] = true
+			t.report(name, "COLLATE "+collation, "comparisons and unique indexes become case-sensitive in Postgres; use citext or a nondeterministic collation where that matters")
+		}
+	}
+}
+
+var (
+	charsetIntroducer = regexp.MustCompile(`\b_[a-z0-9]+'`)
+	mysqlFunction     = regexp.MustCompile(`(?i)\b(IFNULL|IF|GROUP_CONCAT|DATE_FORMAT|DATE_ADD|DATE_SUB|DATEDIFF|STR_TO_DATE|UNIX_TIMESTAMP|FROM_UNIXTIME|CURDATE|CURTIME|UUID|JSON_EXTRACT|JSON_UNQUOTE|CONVERT)\s*\(`)
+)
+
+// expression converts identifier quoting and string literals of a MySQL
+// expression and reports the MySQL functions it uses, which are left for
+// the user to rewrite.
+func (t *pgTranslator) expression(object, construct, expr string) string {
+	expr = strings.ReplaceAll(expr, "`", `"`)
+	expr = charsetIntroducer.ReplaceAllString(expr, "'")
+	expr = strings.ReplaceAll(expr, `\'`, "''")
+	seen := make(map[string]bool)
+	for _, m := range mysqlFunction.FindAllStringSubmatch(expr, -1) {
+		fn := strings.ToUpper(m[1])
+		if !seen[fn] {
+			seen[fn] = true
+			t.report(object, construct, fmt.Sprintf("uses MySQL function %s; rewrite it for Postgres", fn))
+		}
+	}
+	return expr
+}
+
+// pgRelation is the name a relation takes in its Postgres schema, used to
+// detect index names that clash.
+func pgRelation(table, name string) string {
+	if db, _, qualified := strings.Cut(table, "."); qualified {
+		return db + "." + name
+	}
+	return name
+}
+
+// pgTable quotes a table key, which is "schema.table" when several MySQL
+// databases are captured. Each database becomes a Postgres schema.
+func pgTable(key string) string {
+	parts := strings.Split(key, ".")
+	for i := range parts {
+		parts[i] = pgIdent(parts[i])
+	}
+	return strings.Join(parts, ".")
+}
+
+var plainIdent = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// pgIdent quotes an identifier unless Postgres reads it as is: lower case
+// and not reserved.
+func pgIdent(name string) string {
+	if plainIdent.MatchString(name) && !pgReserved[name] {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func pgLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// pgReserved lists the Postgres keywords that cannot be used as column or
+// table names without quotes.
+var pgReserved = map[string]bool{
+	"all": true, "analyse": true, "analyze": true, "and": true, "any": true, "array": true, "as": true,
+	"asc": true, "asymmetric": true, "authorization": true, "binary": true, "both": true, "case": true,
+	"cast": true, "check": true, "collate": true, "collation": true, "column": true, "concurrently": true,
+	"constraint": true, "create": true, "cross": true, "current_catalog": true, "current_date": true,
+	"current_role": true, "current_schema": true, "current_time": true, "current_timestamp": true,
+	"current_user": true, "default": true, "deferrable": true, "desc": true, "distinct": true, "do": true,
+	"else": true, "end": true, "except": true, "false": true, "fetch": true, "for": true, "foreign": true,
+	"freeze": true, "from": true, "full": true, "grant": true, "group": true, "having": true, "ilike": true,
+	"in": true, "initially": true, "inner": true, "intersect": true, "into": true, "is": true,
+	"isnull": true, "join": true, "lateral": true, "leading": true, "left": true, "like": true,
+	"limit": true, "localtime": true, "localtimestamp": true, "natural": true, "not": true,
+	"notnull": true, "null": true, "offset": true, "on": true, "only": true, "or": true, "order": true,
+	"outer": true, "overlaps": true, "placing": true, "primary": true, "references": true,
+	"returning": true, "right": true, "select": true, "session_user": true, "similar": true,
+	"some": true, "symmetric": true, "table": true, "tablesample": true, "then": true, "to": true,
+	"trailing": true, "true": true, "union": true, "unique": true, "user": true, "using": true,
+	"variadic": true, "verbose": true, "when": true, "where": true, "window": true, "with": true,
+}
@@ -0,0 +1,193 @@
+package translate
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestColumnType(t *testing.T) {
+	tests := []struct {
+		mysql         string
+		autoIncrement bool
+		want, values  string
+		issue         bool
+	}{
+		{mysql: "tinyint(1)", want: "boolean"},
+		{mysql: "tinyint(1) unsigned", want: "smallint"},
+		{mysql: "tinyint(4)", want: "smallint"},
+		{mysql: "smallint unsigned", want: "integer"},
+		{mysql: "mediumint", want: "integer"},
+		{mysql: "int", want: "integer"},
+		{mysql: "int unsigned", want: "bigint"},
+		{mysql: "int(10) unsigned zerofill", want: "bigint", issue: true},
+		{mysql: "bigint unsigned", want: "bigint", issue: true},
+		{mysql: "bigint unsigned", autoIncrement: true, want: "bigint"},
+		{mysql: "decimal(10,2)", want: "numeric(10,2)"},
+		{mysql: "float", want: "real"},
+		{mysql: "float(7,3)", want: "real", issue: true},
+		{mysql: "double", want: "double precision"},
+		{mysql: "varchar(255)", want: "varchar(255)"},
+		{mysql: "char(2)", want: "char(2)"},
+		{mysql: "longtext", want: "text"},
+		{mysql: "varbinary(16)", want: "bytea"},
+		{mysql: "datetime", want: "timestamp"},
+		{mysql: "datetime(6)", want: "timestamp(6)"},
+		{mysql: "timestamp", want: "timestamptz"},
+		{mysql: "year", want: "smallint"},
+		{mysql: "json", want: "jsonb"},
+		{mysql: "enum('a','b')", want: "text", values: "'a','b'"},
+		{mysql: "set('a','b')", want: "text", issue: true},
+		{mysql: "point", want: "geometry", issue: true},
+		{mysql: "vector(3)", want: "vector(3)", issue: true},
+	}
+	for _, tt := range tests {
+		tr := &pgTranslator{}
+		got, values := tr.columnType("t.c", tt.mysql, tt.autoIncrement)
+		if got != tt.want || values != tt.values {
+			t.Errorf("columnType(%q) = %q, %q, want %q, %q", tt.mysql, got, values, tt.want, tt.values)
+		}
+		if issue := len(tr.issues) > 0; issue != tt.issue {
+			t.Errorf("columnType(%q) reported %v, want an issue: %v", tt.mysql, tr.issues, tt.issue)
+		}
+	}
+}
+
+func TestDefaultValue(t *testing.T) {
+	tests := []struct {
+		pgType, value, want string
+	}{
+		{"boolean", "'0'", "FALSE"},
+		{"boolean", "1", "TRUE"},
+		{"text", `'C:\\temp'`, `'C:\temp'`},
+		{"integer", "0", "0"},
+		{"timestamptz", "CURRENT_TIMESTAMP", "CURRENT_TIMESTAMP"},
+		{"varchar(36)", "(uuid())", "(uuid())"},
+	}
+	for _, tt := range tests {
+		tr := &pgTranslator{}
+		if got := tr.defaultValue("t.c", tt.pgType, tt.value); got != tt.want {
+			t.Errorf("defaultValue(%q, %q) = %q, want %q", tt.pgType, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPgIdent(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"users", "users"},
+		{"created_at", "created_at"},
+		{"user", `"user"`},
+		{"Users", `"Users"`},
+		{"order-items", `"order-items"`},
+		{`a"b`, `"a""b"`},
+	}
+	for _, tt := range tests {
+		if got := pgIdent(tt.name); got != tt.want {
+			t.Errorf("pgIdent(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if got := pgTable("billing.user"); got != `billing."user"` {
+		t.Errorf(`pgTable("billing.user") = %s`, got)
+	}
+}
+
+// snapshot is a MySQL snapshot as dbpivot writes it.
+const snapshot = `{
+	"users": {
+		"columns": {
+			"id": {"type": "bigint unsigned", "null": false, "extra": "auto_increment", "position": 1},
+			"email": {"type": "varchar(255)", "null": false, "position": 2, "comment": "login"},
+			"active": {"type": "tinyint(1)", "null": false, "default_sql": "'1'", "position": 3},
+			"role": {"type": "enum('admin','member')", "null": true, "position": 4},
+			"updated_at": {"type": "datetime", "null": true, "default_sql": "CURRENT_TIMESTAMP", "extra": "DEFAULT_GENERATED on update CURRENT_TIMESTAMP", "position": 5}
+		},
+		"indexes": {
+			"PRIMARY": {"columns": ["id"], "unique": true},
+			"email": {"columns": ["email(20)"], "unique": true},
+			"body": {"columns": ["email"], "type": "FULLTEXT"}
+		},
+		"options": {"engine": "InnoDB", "collation": "utf8mb4_0900_ai_ci"}
+	},
+	"orders": {
+		"columns": {
+			"id": {"type": "int", "null": false, "extra": "auto_increment", "position": 1},
+			"user_id": {"type": "bigint unsigned", "null": false, "position": 2}
+		},
+		"indexes": {
+			"PRIMARY": {"columns": ["id"], "unique": true},
+			"email": {"columns": ["user_id"]}
+		},
+		"foreign_keys": {
+			"fk_user": {"columns": ["user_id"], "references": "users", "referenced_columns": ["id"], "on_delete": "CASCADE", "on_update": "RESTRICT"}
+		},
+		"options": {"engine": "MyISAM"}
+	},
+	"active_users": {
+		"type": "view",
+		"definition": "select ` + "`id`" + `, IFNULL(` + "`role`" + `, _utf8mb4'member') AS ` + "`role`" + ` from ` + "`users`" + ` where ` + "`active`" + ` = 1",
+		"dependsOn": ["users"]
+	},
+	"procedure:purge": {"type": "procedure", "definition": "BEGIN DELETE FROM orders; END"}
+}`
+
+func TestTranslate(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(snapshot), &schema); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Translate(schema, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantUp := []string{
+		"CREATE TABLE orders (\n" +
+			"id integer GENERATED BY DEFAULT AS IDENTITY NOT NULL,\n" +
+			"user_id bigint NOT NULL,\n" +
+			"PRIMARY KEY (id)\n)",
+		"CREATE TABLE users (\n" +
+			"id bigint GENERATED BY DEFAULT AS IDENTITY NOT NULL,\n" +
+			"email varchar(255) NOT NULL,\n" +
+			"active boolean NOT NULL DEFAULT TRUE,\n" +
+			"role text,\n" +
+			"CHECK (role IN ('admin','member')),\n" +
+			"updated_at timestamp DEFAULT CURRENT_TIMESTAMP,\n" +
+			"PRIMARY KEY (id)\n)",
+		"CREATE INDEX email ON orders (user_id)",
+		"CREATE UNIQUE INDEX users_email ON users (email)",
+		"ALTER TABLE orders ADD CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE",
+		"COMMENT ON COLUMN users.email IS 'login'",
+		`CREATE VIEW active_users AS select "id", IFNULL("role", 'member') AS "role" from "users" where "active" = 1`,
+	}
+	if !reflect.DeepEqual(result.Up, wantUp) {
+		t.Errorf("Up:\n%s\nwant:\n%s", strings.Join(result.Up, ";\n"), strings.Join(wantUp, ";\n"))
+	}
+	wantDown := []string{"DROP VIEW IF EXISTS active_users", "DROP TABLE IF EXISTS users CASCADE", "DROP TABLE IF EXISTS orders CASCADE"}
+	if !reflect.DeepEqual(result.Down, wantDown) {
+		t.Errorf("Down: %q, want %q", result.Down, wantDown)
+	}
+
+	var issues []string
+	for _, issue := range result.Unmapped {
+		issues = append(issues, issue.Object+": "+issue.Construct)
+	}
+	wantIssues := []string{
+		"procedure:purge: PROCEDURE",
+		"orders.user_id: bigint unsigned",
+		"orders: ENGINE=MyISAM",
+		"users.updated_at: ON UPDATE CURRENT_TIMESTAMP",
+		"users.body: FULLTEXT index",
+		"users.email: index name",
+		"users.email: email(20)",
+		"view:active_users: definition",
+		"users: COLLATE utf8mb4_0900_ai_ci",
+	}
+	if !reflect.DeepEqual(issues, wantIssues) {
+		t.Errorf("Unmapped:\n%s\nwant:\n%s", strings.Join(issues, "\n"), strings.Join(wantIssues, "\n"))
+	}
+
+	if _, err := Translate(schema, "oracle"); err == nil {
+		t.Error("Translate accepted an unknown dialect")
+	}
+}
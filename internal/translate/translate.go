@@ -0,0 +1,123 @@
+// Package translate converts MySQL snapshots into the DDL of other database
+// systems.
+package translate
+
+import (
+	"db-pivot/internal/migration"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Issue is a construct of the snapshot that was left out or only
+// approximated in the translation.
+type Issue struct {
+	// Object is the snapshot object, e.g. "users", "users.created_at" or
+	// "procedure:refresh_totals".
+	Object string
+	// Construct is what could not be mapped, e.g. "ON UPDATE
+	// CURRENT_TIMESTAMP".
+	Construct string
+	Reason    string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Object, i.Construct, i.Reason)
+}
+
+// Result is a translated schema.
+type Result struct {
+	// To is the dialect translated to.
+	To string
+	// Up creates the schema, in dependency order; Down drops it again.
+	Up   []string
+	Down []string
+	// Unmapped lists what the statements leave out or approximate.
+	Unmapped []Issue
+}
+
+// Script renders the statements that create the schema as one script.
+func (r Result) Script() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- %s schema translated from MySQL by dbpivot.\n\n", dialectNames[r.To])
+	for _, stmt := range r.Up {
+		b.WriteString(stmt + ";\n")
+	}
+	return b.String()
+}
+
+// Migration renders the schema as a dbpivot migration file whose Down
+// section drops it again.
+func (r Result) Migration(meta migration.Metadata) string {
+	var b strings.Builder
+	b.WriteString(meta.Header())
+	b.WriteString("-- Up migration\n")
+	for _, stmt := range r.Up {
+		b.WriteString(stmt + ";\n")
+	}
+	b.WriteString("\n-- Down migration\n")
+	for _, stmt := range r.Down {
+		b.WriteString(stmt + ";\n")
+	}
+	return b.String()
+}
+
+var dialects = map[string]func(schema map[string]interface{}) Result{
+	"postgres": postgres,
+}
+
+var dialectNames = map[string]string{
+	"postgres": "PostgreSQL",
+}
+
+// Dialects lists the systems Translate writes DDL for.
+func Dialects() []string {
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Translate converts a MySQL snapshot into DDL for the dialect to. Tables,
+// indexes, foreign keys, CHECK constraints, comments and views are
+// translated; stored routines and triggers are reported, not converted.
+func Translate(schema map[string]interface{}, to string) (Result, error) {
+	translate, ok := dialects[to]
+	if !ok {
+		return Result{}, fmt.Errorf("unknown dialect %q (want one of %s)", to, strings.Join(Dialects(), ", "))
+	}
+	return translate(schema), nil
+}
+
+// objectKind returns the kind of a snapshot entry. Tables have no "type".
+func objectKind(data interface{}) string {
+	obj, ok := data.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if kind, ok := obj["type"].(string); ok && kind != "" {
+		return kind
+	}
+	return "table"
+}
+
+func sortedNames(m map[string]interface{}) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stringList reads a list of strings from a snapshot.
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		list = append(list, fmt.Sprint(item))
+	}
+	return list
+}
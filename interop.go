@@ -0,0 +1,96 @@
+package dbpivot
+
+import (
+	"context"
+	"db-pivot/internal/interop"
+	"db-pivot/internal/migration"
+	"fmt"
+	"os"
+)
+
+// ImportOptions controls Import.
+type ImportOptions struct {
+	// From names the tool: "golang-migrate", "flyway", "goose" or
+	// "liquibase-sql".
+	From string
+	// Dir is the tool's migration directory.
+	Dir string
+	// HistoryTable overrides the name of the tool's history table, for
+	// projects that configured a custom one.
+	HistoryTable string
+}
+
+// ImportResult reports the files Import wrote and the versions it marked
+// as applied.
+type ImportResult = interop.ImportResult
+
+// ImportFormats lists the tools Import reads from.
+func ImportFormats() []string {
+	return interop.ImportFormats()
+}
+
+// Import converts the migrations of another tool into dbpivot migrations
+// in the migration directory, and records those the tool's history table
+// lists as applied in schema_migrations without running them. Versions are
+// padded to the width of dbpivot timestamps so they keep their order.
+//
+// golang-migrate keeps its history in a table called schema_migrations;
+// Import renames it to schema_migrations_golang_migrate to make room for
+// dbpivot's own.
+func (p *Pivot) Import(ctx context.Context, opts ImportOptions) (ImportResult, error) {
+	if err := os.MkdirAll(p.cfg.MigrationDir, 0755); err != nil {
+		return ImportResult{}, fmt.Errorf("failed to create directory %s: %v", p.cfg.MigrationDir, err)
+	}
+	migs, err := p.collectMigrations()
+	if err != nil {
+		return ImportResult{}, err
+	}
+	existing := make(map[string]bool, len(migs))
+	for _, m := range migs {
+		existing[m.version] = true
+	}
+	return interop.Import(ctx, p.db, interop.ImportOptions{
+		From:         opts.From,
+		Dir:          opts.Dir,
+		HistoryTable: opts.HistoryTable,
+		MigrationDir: p.cfg.MigrationDir,
+		Existing:     existing,
+	})
+}
+
+// ExportOptions controls Export.
+type ExportOptions struct {
+	// To names the tool: "golang-migrate", "flyway", "goose" or "liquibase".
+	To string
+	// Dir is the directory the files are written to.
+	Dir string
+}
+
+// ExportResult reports the files Export wrote.
+type ExportResult = interop.ExportResult
+
+// ExportFormats lists the tools Export writes for.
+func ExportFormats() []string {
+	return interop.ExportFormats()
+}
+
+// Export writes the SQL migrations in the file layout and annotations of
+// another tool, keeping their order and down scripts. Go migrations exist
+// only in the program that registers them and are reported as warnings.
+func (p *Pivot) Export(opts ExportOptions) (ExportResult, error) {
+	migs, skipped, err := migration.LoadMigrations(p.migrations)
+	if err != nil {
+		return ExportResult{}, fmt.Errorf("failed to load migrations: %v", err)
+	}
+	result, err := interop.Export(migs, interop.ExportOptions{To: opts.To, Dir: opts.Dir})
+	if err != nil {
+		return result, err
+	}
+	for _, file := range skipped {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("skipped %s: not a migration file name", file))
+	}
+	for _, gm := range migration.GoMigrations() {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Go migration %s was not exported", gm.Version))
+	}
+	return result, nil
+}
@@ -0,0 +1,140 @@
+package dbpivot
+
+import (
+	"context"
+	"db-pivot/internal/lint"
+	"db-pivot/internal/migration"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+)
+
+// LintRule is a check run by Lint. Register custom rules with AddLintRule.
+type LintRule = lint.Rule
+
+// LintFinding is a problem Lint found in a migration.
+type LintFinding = lint.Finding
+
+// LintTarget is the migration a LintRule checks.
+type LintTarget = lint.Target
+
+// LintProject is what a LintRule knows besides the migration it checks.
+type LintProject = lint.Project
+
+// LintSeverity is how serious a LintFinding is.
+type LintSeverity = lint.Severity
+
+// Severities of lint findings.
+const (
+	LintError   = lint.SeverityError
+	LintWarning = lint.SeverityWarning
+	LintInfo    = lint.SeverityInfo
+	LintOff     = lint.SeverityOff
+)
+
+// AddLintRule registers a rule that Lint runs along with the built-in ones.
+// Like AddMigration, it is meant to be called from init functions and
+// panics if the rule's ID is taken.
+func AddLintRule(rule LintRule) {
+	lint.Register(rule)
+}
+
+// LintRules lists the built-in and registered rules, ordered by ID.
+func LintRules() []LintRule {
+	return lint.Rules()
+}
+
+// LintFormats lists the report formats of WriteLintReport.
+func LintFormats() []string {
+	return lint.Formats()
+}
+
+// WriteLintReport writes findings to w as "human", "json" or "sarif".
+func WriteLintReport(w io.Writer, format string, findings []LintFinding) error {
+	return lint.Write(w, format, findings)
+}
+
+// LintOptions controls Lint.
+type LintOptions struct {
+	// Files limits the lint to the named migration files. Empty lints every
+	// migration from the config's lint.since version on.
+	Files []string
+	// Changes also lints the migration that Generate would write for the
+	// changes since the latest snapshot. It is skipped without a snapshot
+	// and needs a Pivot opened with a database connection.
+	Changes bool
+}
+
+// Lint checks migrations with the rules the config's lint section leaves
+// on and returns what they found. Nothing is executed.
+func (p *Pivot) Lint(ctx context.Context, opts LintOptions) ([]LintFinding, error) {
+	severities := make(map[string]LintSeverity)
+	since := ""
+	if cfg := p.cfg.Lint; cfg != nil {
+		for id, s := range cfg.Rules {
+			severity, err := lint.ParseSeverity(s)
+			if err != nil {
+				return nil, fmt.Errorf("lint.rules.%s: %v", id, err)
+			}
+			severities[id] = severity
+		}
+		since = cfg.Since
+	}
+
+	migs, err := p.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	byFile := make(map[string]migration.Migration)
+	for _, mig := range migs {
+		byFile[mig.Files[0]] = mig
+	}
+	var targets []lint.Target
+	target := func(mig migration.Migration) lint.Target {
+		return lint.Target{Migration: mig, File: filepath.Join(p.cfg.MigrationDir, mig.Files[0])}
+	}
+	for _, file := range opts.Files {
+		mig, ok := byFile[filepath.Base(file)]
+		if !ok {
+			return nil, fmt.Errorf("no migration file named %s in %s", filepath.Base(file), p.cfg.MigrationDir)
+		}
+		targets = append(targets, target(mig))
+	}
+	if len(opts.Files) == 0 {
+		for _, mig := range migs {
+			if since == "" || migration.CompareVersions(mig.Version, since) >= 0 {
+				targets = append(targets, target(mig))
+			}
+		}
+	}
+
+	// A checkout may lack the snapshot directory; the rules that need the
+	// snapshot then find nothing.
+	schema, err := loadPreviousSnapshot(p.snapshots)
+	if errors.Is(err, fs.ErrNotExist) {
+		schema, err = make(map[string]interface{}), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load previous snapshot: %v", err)
+	}
+	if opts.Changes && p.db == nil {
+		return nil, fmt.Errorf("linting the pending changes needs a database connection")
+	}
+	if opts.Changes && len(schema) > 0 {
+		changes, err := p.DiffContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 {
+			pending, err := migration.RenderMigration(changes, GenerateOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to render pending changes: %v", err)
+			}
+			targets = append(targets, lint.Target{Migration: pending, Pending: true})
+		}
+	}
+
+	return lint.Run(&lint.Project{Schema: schema}, targets, severities)
+}
@@ -0,0 +1,284 @@
+package dbpivot
+
+import (
+	"context"
+	"db-pivot/internal/db"
+	"db-pivot/internal/migration"
+	"fmt"
+	"sort"
+)
+
+// MigrationFunc is one direction of a Go migration. It runs inside the
+// transaction that records the migration in schema_migrations, so returning
+// an error leaves both the schema and the history untouched.
+type MigrationFunc = migration.GoMigrationFunc
+
+// AddMigration registers a Go migration under version. Go migrations are
+// applied interleaved by version with the .sql files in the migration
+// directory and tracked in schema_migrations the same way. down may be nil,
+// in which case the migration cannot be rolled back.
+//
+// AddMigration is meant to be called from init functions and panics if the
+// version is registered twice.
+func AddMigration(version string, up, down MigrationFunc) {
+	migration.RegisterGoMigration(version, "", up, down)
+}
+
+// AddNamedMigration is like AddMigration but stores description in
+// schema_migrations instead of the default one.
+func AddNamedMigration(version, description string, up, down MigrationFunc) {
+	migration.RegisterGoMigration(version, description, up, down)
+}
+
+// InterruptedError is returned by Apply and Rollback when the context is
+// cancelled or a statement times out in the middle of a migration.
+type InterruptedError = migration.InterruptedError
+
+// MigrationStatus reports whether a known migration has been applied.
+type MigrationStatus struct {
+	Version string
+	Source  string // "sql" or "go"
+	Applied bool
+}
+
+// ApplyOptions controls Apply.
+type ApplyOptions struct {
+	// Target stops Apply after this version. Empty applies everything pending.
+	Target string
+}
+
+// RollbackOptions controls Rollback.
+type RollbackOptions struct {
+	// Steps is the number of migrations to roll back. Zero means one.
+	Steps int
+}
+
+type pendingMigration struct {
+	version string
+	sqlMig  *migration.Migration
+	goMig   *migration.GoMigration
+}
+
+// Status lists every SQL and Go migration ordered by version.
+func (p *Pivot) Status() ([]MigrationStatus, error) {
+	return p.StatusContext(context.Background())
+}
+
+// StatusContext is like Status but gives up querying when ctx is done.
+func (p *Pivot) StatusContext(ctx context.Context) ([]MigrationStatus, error) {
+	migs, err := p.collectMigrations()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(migs))
+	for _, m := range migs {
+		applied, err := p.db.IsMigrationApplied(ctx, m.version)
+		if err != nil {
+			return nil, err
+		}
+		source := "sql"
+		if m.goMig != nil {
+			source = "go"
+		}
+		statuses = append(statuses, MigrationStatus{Version: m.version, Source: source, Applied: applied})
+	}
+	return statuses, nil
+}
+
+// Apply runs pending migrations in version order and returns the versions it
+// applied. On failure the versions applied before the error are returned
+// along with it. If ctx is cancelled the running statement is aborted and the
+// error is a *InterruptedError naming the migration.
+func (p *Pivot) Apply(ctx context.Context, opts ApplyOptions) ([]string, error) {
+	migs, err := p.collectMigrations()
+	if err != nil {
+		return nil, err
+	}
+	online, closeOnline, err := p.online(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeOnline()
+
+	var applied []string
+	for _, m := range migs {
+		if err := ctx.Err(); err != nil {
+			return applied, err
+		}
+		if opts.Target != "" && migration.CompareVersions(m.version, opts.Target) > 0 {
+			break
+		}
+		done, err := p.db.IsMigrationApplied(ctx, m.version)
+		if err != nil {
+			return applied, err
+		}
+		if done {
+			continue
+		}
+
+		if m.goMig != nil {
+			if err := migration.ApplyGoMigration(ctx, p.db, m.goMig); err != nil {
+				return applied, fmt.Errorf("failed to apply migration %s: %w", m.version, err)
+			}
+		} else {
+			if err := p.checkDependencies(ctx, *m.sqlMig); err != nil {
+				return applied, err
+			}
+			if err := migration.ApplyMigration(ctx, p.db, *m.sqlMig, online); err != nil {
+				return applied, fmt.Errorf("failed to apply migration %s: %w", m.version, err)
+			}
+		}
+		applied = append(applied, m.version)
+	}
+	return applied, nil
+}
+
+// Rollback reverts the most recently applied migrations and returns the
+// versions it rolled back, newest first.
+func (p *Pivot) Rollback(ctx context.Context, opts RollbackOptions) ([]string, error) {
+	steps := opts.Steps
+	if steps <= 0 {
+		steps = 1
+	}
+	online, closeOnline, err := p.online(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeOnline()
+
+	var rolledBack []string
+	for i := 0; i < steps; i++ {
+		if err := ctx.Err(); err != nil {
+			return rolledBack, err
+		}
+		lastVersion, err := p.db.GetLastAppliedMigration(ctx)
+		if err != nil {
+			return rolledBack, fmt.Errorf("failed to get last applied migration: %v", err)
+		}
+		if lastVersion == "" {
+			break
+		}
+
+		if gm, ok := migration.LookupGoMigration(lastVersion); ok {
+			if err := migration.RollbackGoMigration(ctx, p.db, gm); err != nil {
+				return rolledBack, fmt.Errorf("failed to rollback migration %s: %w", lastVersion, err)
+			}
+		} else {
+			mig, err := p.sqlMigration(lastVersion)
+			if err != nil {
+				return rolledBack, err
+			}
+			if err := migration.RollbackMigration(ctx, p.db, mig, online); err != nil {
+				return rolledBack, fmt.Errorf("failed to rollback migration %s: %w", lastVersion, err)
+			}
+		}
+		rolledBack = append(rolledBack, lastVersion)
+	}
+	return rolledBack, nil
+}
+
+// online returns the online schema change settings of the config, connected
+// to the replicas whose lag throttles the copy. closeOnline disconnects
+// them again.
+func (p *Pivot) online(ctx context.Context) (online *migration.Online, closeOnline func(), err error) {
+	online = &migration.Online{Logf: p.logf}
+	cfg := p.cfg.Online
+	if cfg == nil {
+		return online, func() {}, nil
+	}
+	if online.MaxReplicaLag, err = cfg.ReplicaLag(); err != nil {
+		return nil, nil, err
+	}
+	online.ThresholdRows = cfg.ThresholdRows
+	online.ChunkSize = cfg.ChunkSize
+	online.MaxRowsPerSecond = cfg.MaxRowsPerSecond
+	closeOnline = func() {
+		for _, replica := range online.Replicas {
+			replica.Close()
+		}
+	}
+	for i, conn := range cfg.Replicas {
+		replica, err := db.NewDBManagerContext(ctx, p.cfg.DBMS, conn)
+		if err != nil {
+			closeOnline()
+			return nil, nil, fmt.Errorf("failed to connect to replica %d: %v", i+1, err)
+		}
+		online.Replicas = append(online.Replicas, replica)
+	}
+	return online, closeOnline, nil
+}
+
+// loadMigrations reads the SQL migrations and logs the SQL files that are
+// skipped because their names are not migration names.
+func (p *Pivot) loadMigrations() ([]migration.Migration, error) {
+	migs, skipped, err := migration.LoadMigrations(p.migrations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %v", err)
+	}
+	if p.logf != nil {
+		for _, file := range skipped {
+			p.logf("WARNING: skipped %s: not a migration file name (<version>_<name>.sql, with a numeric version)", file)
+		}
+	}
+	return migs, nil
+}
+
+func (p *Pivot) collectMigrations() ([]pendingMigration, error) {
+	sqlMigs, err := p.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	migs := make([]pendingMigration, 0, len(sqlMigs))
+	for i := range sqlMigs {
+		migs = append(migs, pendingMigration{version: sqlMigs[i].Version, sqlMig: &sqlMigs[i]})
+	}
+	for _, gm := range migration.GoMigrations() {
+		migs = append(migs, pendingMigration{version: gm.Version, goMig: gm})
+	}
+
+	sort.SliceStable(migs, func(i, j int) bool {
+		return migration.CompareVersions(migs[i].version, migs[j].version) < 0
+	})
+	// SQL migrations are unique among themselves and so are Go ones, so
+	// any clash is between the two.
+	for i := 1; i < len(migs); i++ {
+		if migration.CompareVersions(migs[i-1].version, migs[i].version) == 0 {
+			sqlMig, goMig := migs[i-1].sqlMig, migs[i].goMig
+			if sqlMig == nil {
+				sqlMig, goMig = migs[i].sqlMig, migs[i-1].goMig
+			}
+			return nil, fmt.Errorf("migration %s is defined both in %s and in Go", goMig.Version, sqlMig.Files[0])
+		}
+	}
+	return migs, nil
+}
+
+// sqlMigration returns the SQL migration of version.
+func (p *Pivot) sqlMigration(version string) (migration.Migration, error) {
+	migs, err := p.collectMigrations()
+	if err != nil {
+		return migration.Migration{}, err
+	}
+	for _, m := range migs {
+		if m.version == version && m.sqlMig != nil {
+			return *m.sqlMig, nil
+		}
+	}
+	return migration.Migration{}, fmt.Errorf("no migration file found for version %s", version)
+}
+
+// checkDependencies fails if a migration named in the depends-on header of
+// mig has not been applied.
+func (p *Pivot) checkDependencies(ctx context.Context, mig migration.Migration) error {
+	for _, dep := range mig.Metadata.DependsOn {
+		done, err := p.db.IsMigrationApplied(ctx, dep)
+		if err != nil {
+			return err
+		}
+		if !done {
+			return fmt.Errorf("migration %s depends on %s, which has not been applied", mig.Version, dep)
+		}
+	}
+	return nil
+}
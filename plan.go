@@ -0,0 +1,82 @@
+package dbpivot
+
+import (
+	"context"
+	"db-pivot/internal/migration"
+	"fmt"
+)
+
+// StatementAnalysis predicts the impact of one statement of a pending
+// migration.
+type StatementAnalysis = migration.StatementAnalysis
+
+// TableSize is the estimated size of a table.
+type TableSize = migration.TableSize
+
+// Impact is what a statement does to the table it changes, such as
+// "metadata-only" or "table copy".
+type Impact = migration.Impact
+
+// PlanOptions controls Plan.
+type PlanOptions struct {
+	// Target stops the plan after this version. Empty covers every pending
+	// migration.
+	Target string
+	// Analyze predicts the impact of every statement from the row counts
+	// and sizes in information_schema.TABLES.
+	Analyze bool
+}
+
+// PlannedMigration is a migration Apply would run.
+type PlannedMigration struct {
+	Version string
+	Name    string
+	Source  string // "sql" or "go"
+	// Statements are the Up statements of a SQL migration. The statements
+	// of a Go migration are not known before it runs.
+	Statements []string
+	// Analysis holds one entry per statement when PlanOptions.Analyze is
+	// set.
+	Analysis []StatementAnalysis
+}
+
+// Plan lists the migrations Apply would run, in order, without running
+// them.
+func (p *Pivot) Plan(ctx context.Context, opts PlanOptions) ([]PlannedMigration, error) {
+	migs, err := p.collectMigrations()
+	if err != nil {
+		return nil, err
+	}
+	// Only the thresholds matter for the plan, so no replica is connected.
+	online := &migration.Online{}
+	if cfg := p.cfg.Online; cfg != nil {
+		online.ThresholdRows = cfg.ThresholdRows
+		online.MaxRowsPerSecond = cfg.MaxRowsPerSecond
+	}
+
+	var planned []PlannedMigration
+	for _, m := range migs {
+		if opts.Target != "" && migration.CompareVersions(m.version, opts.Target) > 0 {
+			break
+		}
+		done, err := p.db.IsMigrationApplied(ctx, m.version)
+		if err != nil {
+			return planned, err
+		}
+		if done {
+			continue
+		}
+		if m.goMig != nil {
+			planned = append(planned, PlannedMigration{Version: m.version, Name: m.goMig.Description, Source: "go"})
+			continue
+		}
+		plan := PlannedMigration{Version: m.version, Name: m.sqlMig.Name, Source: "sql", Statements: m.sqlMig.Up}
+		if opts.Analyze {
+			if plan.Analysis, err = migration.Analyze(ctx, p.db, *m.sqlMig, online); err != nil {
+				return planned, fmt.Errorf("failed to analyze migration %s: %v", m.version, err)
+			}
+		}
+		planned = append(planned, plan)
+	}
+	return planned, nil
+}
@@ -0,0 +1,87 @@
+package dbpivot
+
+import (
+	"context"
+	"db-pivot/internal/migration"
+	"db-pivot/internal/translate"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TranslateOptions controls Translate.
+type TranslateOptions struct {
+	// To names the target system. Only "postgres" is supported.
+	To string
+	// Dir is the directory the script and migration are written to.
+	Dir string
+	// Live reads the schema from the database instead of a snapshot.
+	Live bool
+	// Snapshot is the snapshot file to translate. Empty means the latest
+	// one in the snapshot directory.
+	Snapshot string
+	Metadata Metadata
+}
+
+// TranslateIssue is a construct Translate left out or approximated.
+type TranslateIssue = translate.Issue
+
+// TranslateResult reports the files Translate wrote and what it could not
+// map.
+type TranslateResult struct {
+	// Script creates the whole schema; Migration does the same as a
+	// migration with a Down section.
+	Script    string
+	Migration string
+	Unmapped  []TranslateIssue
+}
+
+// TranslateDialects lists the systems Translate writes DDL for.
+func TranslateDialects() []string {
+	return translate.Dialects()
+}
+
+// Translate converts a MySQL schema into the DDL of another system and
+// writes it to opts.Dir twice: as schema.sql and as a migration that a
+// project on the new system can start from. Types are mapped to their
+// closest equivalent; stored programs, and anything else without one, are
+// listed in the result instead.
+func (p *Pivot) Translate(ctx context.Context, opts TranslateOptions) (TranslateResult, error) {
+	var result TranslateResult
+	schema, err := p.loadSchema(ctx, opts.Live, opts.Snapshot)
+	if err != nil {
+		return result, err
+	}
+	schema = p.filter.Apply(schema)
+	translated, err := translate.Translate(schema, opts.To)
+	if err != nil {
+		return result, err
+	}
+	result.Unmapped = translated.Unmapped
+
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return result, fmt.Errorf("failed to create directory %s: %v", opts.Dir, err)
+	}
+	script := filepath.Join(opts.Dir, "schema.sql")
+	if err := os.WriteFile(script, []byte(translated.Script()), 0644); err != nil {
+		return result, fmt.Errorf("failed to write %s: %v", script, err)
+	}
+	result.Script = script
+
+	meta := opts.Metadata
+	if meta.Description == "" {
+		meta.Description = fmt.Sprintf("Schema translated from MySQL to %s", opts.To)
+	}
+	file := migration.FileName(time.Now().Format("20060102150405"), "create_schema")
+	content := translated.Migration(meta)
+	if _, err := migration.ParseMigration(file, []byte(content)); err != nil {
+		return result, fmt.Errorf("translated migration is invalid: %v", err)
+	}
+	mig := filepath.Join(opts.Dir, file)
+	if err := os.WriteFile(mig, []byte(content), 0644); err != nil {
+		return result, fmt.Errorf("failed to write %s: %v", mig, err)
+	}
+	result.Migration = mig
+	return result, nil
+}